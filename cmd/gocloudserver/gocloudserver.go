@@ -10,9 +10,17 @@ import (
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/application"
 
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/rest"
 
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/firmware"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/influx"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/metering"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/playback"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/streaming"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tlsutil"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/webhooks"
 
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/broker"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
@@ -44,6 +52,70 @@ func main() {
 		logger.Fatal("error connecting to database", "error", err)
 	}
 
+	// Create time-series sensor sink with buffered writer
+	sensorTLS, err := tlsutil.FromViper("db.sensor.tls").ClientConfig()
+	if err != nil {
+		logger.Fatal("wrong sensor storage TLS configuration", "error", err)
+	}
+	sensorScheme := "http"
+	if sensorTLS != nil {
+		sensorScheme = "https"
+	}
+	sink, err := influx.NewSensorSink(influx.Config{
+		Backend: viper.GetString("db.sensor.backend"),
+		Addr: fmt.Sprintf("%s://%s:%d",
+			sensorScheme,
+			viper.GetString("db.sensor.host"),
+			viper.GetInt("db.sensor.port")),
+		Username:      viper.GetString("db.sensor.username"),
+		Password:      viper.GetString("db.sensor.password"),
+		Org:           viper.GetString("db.sensor.org"),
+		Bucket:        viper.GetString("db.sensor.bucket"),
+		Token:         viper.GetString("db.sensor.token"),
+		Target:        viper.GetString("db.sensor.target"),
+		BatchSize:     viper.GetInt("db.sensor.batchSize"),
+		FlushInterval: viper.GetDuration("db.sensor.flushInterval"),
+		MaxRetries:    viper.GetInt("db.sensor.maxRetries"),
+		RetryBackoff:  viper.GetDuration("db.sensor.retryBackoff"),
+		SpoolDir:      viper.GetString("db.sensor.spoolDir"),
+		SpoolMaxSize:  viper.GetInt64("db.sensor.spoolMaxSize"),
+		TLSConfig:     sensorTLS,
+	})
+	if err != nil {
+		logger.Fatal("error creating sensor sink", "error", err)
+	}
+
+	// Start webhook dispatcher for platform events
+	hooks := webhooks.NewDispatcher(conn, webhooks.Config{
+		Workers:      viper.GetInt("webhooks.workers"),
+		QueueSize:    viper.GetInt("webhooks.queueSize"),
+		QueueTimeout: viper.GetDuration("webhooks.queueTimeout"),
+		Timeout:      viper.GetDuration("webhooks.timeout"),
+		MaxAttempts:  viper.GetInt("webhooks.maxAttempts"),
+		RetryBackoff: viper.GetDuration("webhooks.retryBackoff"),
+		MaxFailures:  viper.GetInt("webhooks.maxFailures"),
+		CacheTTL:     viper.GetDuration("webhooks.cacheTTL"),
+		AllowPrivate: viper.GetBool("webhooks.allowPrivate"),
+	})
+	hooks.Start()
+
+	// Create services shared by gateways business logic
+	services := logic.NewServices(conn, sink, hooks)
+
+	// Meter recording, streaming and stored sensor points for billing
+	meter := metering.NewMeter(conn, metering.Config{
+		FlushInterval: viper.GetDuration("metering.flushInterval"),
+	})
+	services.Meter = meter
+	meter.Start()
+
+	// Load tariff features, legacy ones are used for tariffs not defined
+	tariffsCtx, tariffsCancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	if err := services.Tariffs.Load(tariffsCtx, conn); err != nil {
+		logger.Error("failed loading tariffs", "error", err)
+	}
+	tariffsCancel()
+
 	// Create and initialize broker
 	manager := broker.NewManager(
 		serverID,
@@ -53,28 +125,107 @@ func main() {
 		viper.GetString("amqp.host"),
 		viper.GetInt("amqp.port"),
 		viper.GetInt("amqp.ctlPort"),
+		services,
+		broker.NewGatewayAuth(conn, viper.GetString("amqp.gatewayAuth"),
+			viper.GetDuration("amqp.gatewaySecretTTL"), viper.GetDuration("amqp.gatewayAuthMaxAge")),
 	)
+
+	// Follow gateway firmware and run rollout campaigns
+	var fw *firmware.Orchestrator
+	if viper.GetBool("firmware.enabled") {
+		fw = firmware.NewOrchestrator(conn, manager, firmware.Config{
+			CheckInterval: viper.GetDuration("firmware.checkInterval"),
+			UpdateTimeout: viper.GetDuration("firmware.updateTimeout"),
+			MinSamples:    viper.GetInt("firmware.minSamples"),
+			BatchSize:     viper.GetInt("firmware.batchSize"),
+		})
+		services.Trackers = append(services.Trackers, fw)
+	}
+
+	// Follow camera streaming and start it on demand for live view
+	streams := streaming.NewManager(manager, streaming.Config{
+		StartTimeout: viper.GetDuration("streaming.startTimeout"),
+		IdleTimeout:  viper.GetDuration("streaming.idleTimeout"),
+		SessionTTL:   viper.GetDuration("streaming.sessionTTL"),
+	})
+	services.Trackers = append(services.Trackers, streams)
+
 	if err := manager.Open(); err != nil {
 		logger.Fatal("could not open broker", "error", err)
 	}
 
+	// Connect to MQTT broker for gateways speaking MQTT
+	if viper.GetBool("mqtt.enabled") {
+		mqttTLS, err := tlsutil.FromViper("mqtt.tls").ClientConfig()
+		if err != nil {
+			logger.Fatal("wrong MQTT TLS configuration", "error", err)
+		}
+		err = manager.MqttInit(broker.MqttConfig{
+			Broker:            viper.GetString("mqtt.broker"),
+			User:              viper.GetString("mqtt.user"),
+			Password:          viper.GetString("mqtt.password"),
+			ShareGroup:        viper.GetString("mqtt.shareGroup"),
+			KeepAlive:         uint16(viper.GetUint("mqtt.keepAlive")),
+			ReconnectInterval: viper.GetDuration("mqtt.reconnectInterval"),
+			TLSConfig:         mqttTLS,
+		})
+		if err != nil {
+			logger.Fatal("could not connect to MQTT broker", "error", err)
+		}
+	}
+
 	// Restart connected gateways to renew their statuses
 	manager.RestartGateways()
 
+	// Close virtual gateways of direct-to-cloud devices gone silent
+	manager.VirtualGatewaysInit(viper.GetDuration("rest.ingestIdleTimeout"))
+
 	// Initialize event exchange to process gateways statuses
 	if err := manager.EventExchangeInit(); err != nil {
 		logger.Fatal("could not initialize event exchange", "error", err)
 	}
 
+	// Apply account changes made by billing to gateways held by all servers
+	if exchange := viper.GetString("accounts.exchange"); len(exchange) > 0 {
+		if err := manager.AccountEventsInit(exchange); err != nil {
+			logger.Fatal("could not initialize account events exchange", "error", err)
+		}
+	}
+
 	// Make cancel context
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
 	// Start RabbitMQ events processor
-	go manager.ProcessExchangeEvents(ctx, conn)
+	go manager.ProcessExchangeEvents(ctx)
+
+	// Start firmware rollouts when gateways are connected
+	if fw != nil {
+		fw.Start()
+	}
+
+	// Expire live view sessions of gone viewers
+	streams.Start()
+
+	// Sign playback URLs issued to clients
+	signer, err := playback.NewSigner(playback.Config{
+		Signing:       viper.GetString("playback.signing"),
+		Secret:        viper.GetString("playback.secret"),
+		TokenPrefix:   viper.GetString("playback.tokenPrefix"),
+		HashAlgorithm: viper.GetString("playback.hashAlgorithm"),
+		BindClientIP:  viper.GetBool("playback.bindClientIp"),
+		TTL:           viper.GetDuration("playback.ttl"),
+		Templates: playback.Templates{
+			HLS:  viper.GetString("playback.hlsUrl"),
+			DASH: viper.GetString("playback.dashUrl"),
+		},
+	})
+	if err != nil {
+		logger.Fatal("wrong playback configuration", "error", err)
+	}
 
 	// Create RESTful API server
-	restAPI := rest.NewServer(manager)
+	restAPI := rest.NewServer(manager, conn, sink, hooks, streams, signer)
 	if restAPI == nil {
 		logger.Fatal("could not initialize RESTful API server")
 	}
@@ -101,16 +252,43 @@ func main() {
 		cancel()
 	}
 
+	// Stop firmware rollouts
+	if fw != nil {
+		if err := fw.Close(); err != nil {
+			logger.Error("failed closing firmware orchestrator", "error", err)
+		}
+	}
+
+	// Stop live stream sessions
+	if err := streams.Close(); err != nil {
+		logger.Error("failed closing live stream sessions", "error", err)
+	}
+
 	// Make RabbitMQ connection shutdown
 	if err := manager.Close(); err != nil {
 		logger.Error("error while closing connection", "error", err)
 	}
 
+	// Write usage of gateways gone with broker connection
+	if err := meter.Close(); err != nil {
+		logger.Error("failed storing usage", "error", err)
+	}
+
 	// Stop RESTful server
 	if err := restAPI.Stop(); err != nil {
 		logger.Error("could not stop RESTful API server", "error", err)
 	}
 
+	// Stop webhook deliveries
+	if err := hooks.Close(); err != nil {
+		logger.Error("failed closing webhook dispatcher", "error", err)
+	}
+
+	// Drain buffered points to time-series storage
+	if err := sink.Close(); err != nil {
+		logger.Error("failed closing sensor sink", "error", err)
+	}
+
 	// Close database connection
 	if err := conn.Close(); err != nil {
 		logger.Error("failed closing database connection", "error", err)
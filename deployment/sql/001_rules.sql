@@ -0,0 +1,14 @@
+-- Automation rules of gateway devices
+CREATE TABLE IF NOT EXISTS v3_rules (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id     BIGINT UNSIGNED NOT NULL,
+    gateway_id  VARCHAR(36)     NOT NULL,
+    title       VARCHAR(255)    NOT NULL DEFAULT '',
+    enabled     TINYINT(1)      NOT NULL DEFAULT 1,
+    definition  TEXT            NOT NULL,
+    created_at  DATETIME        NOT NULL,
+    updated_at  DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_rules_user (user_id),
+    KEY idx_rules_gateway (gateway_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
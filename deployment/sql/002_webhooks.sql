@@ -0,0 +1,29 @@
+-- User webhooks for platform events
+CREATE TABLE IF NOT EXISTS v3_webhooks (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id     BIGINT UNSIGNED NOT NULL,
+    url         VARCHAR(2048)   NOT NULL,
+    secret      VARCHAR(255)    NOT NULL,
+    events      VARCHAR(1024)   NOT NULL,
+    enabled     TINYINT(1)      NOT NULL DEFAULT 1,
+    failures    INT             NOT NULL DEFAULT 0,
+    created_at  DATETIME        NOT NULL,
+    updated_at  DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_webhooks_user (user_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Webhook delivery attempts log
+CREATE TABLE IF NOT EXISTS v3_webhook_deliveries (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    webhook_id  BIGINT UNSIGNED NOT NULL,
+    event_id    VARCHAR(36)     NOT NULL,
+    event_type  VARCHAR(64)     NOT NULL,
+    attempt     INT             NOT NULL,
+    status_code INT             NOT NULL DEFAULT 0,
+    error       VARCHAR(1024)   NOT NULL DEFAULT '',
+    duration_ms BIGINT          NOT NULL DEFAULT 0,
+    created_at  DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_webhook_deliveries_webhook (webhook_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,14 @@
+-- Access tokens of direct-to-cloud devices posting readings over HTTP.
+-- Such devices are registered in v3_devices under a virtual gateway:
+-- an ordinary v3_gateways record without hardware behind it.
+CREATE TABLE IF NOT EXISTS v3_device_tokens (
+    id           BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    device_id    VARCHAR(36)     NOT NULL,
+    token_hash   CHAR(64)        NOT NULL,
+    title        VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at   DATETIME        NOT NULL,
+    last_used_at DATETIME        NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_device_tokens_hash (token_hash),
+    KEY idx_device_tokens_device (device_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,23 @@
+-- Per-gateway secrets for HMAC signatures of gateway messages
+CREATE TABLE IF NOT EXISTS v3_gateway_secrets (
+    gateway_id  VARCHAR(36)     NOT NULL,
+    secret      VARCHAR(128)    NOT NULL,
+    created_at  DATETIME        NOT NULL,
+    rotated_at  DATETIME        NOT NULL,
+    PRIMARY KEY (gateway_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Audit log of rejected gateway traffic
+CREATE TABLE IF NOT EXISTS v3_gateway_audit (
+    id                 BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gateway_id         VARCHAR(64)     NOT NULL,
+    claimed_gateway_id VARCHAR(64)     NOT NULL DEFAULT '',
+    transport          VARCHAR(16)     NOT NULL,
+    reason             VARCHAR(255)    NOT NULL,
+    message_type       VARCHAR(64)     NOT NULL DEFAULT '',
+    device_id          VARCHAR(64)     NOT NULL DEFAULT '',
+    created_at         DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_gateway_audit_gateway (gateway_id),
+    KEY idx_gateway_audit_claimed (claimed_gateway_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
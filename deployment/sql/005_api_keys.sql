@@ -0,0 +1,15 @@
+-- REST API keys of partners and services.
+-- role is one of readonly, integrator, operator, admin;
+-- user_ids holds JSON array of users the key is scoped to.
+CREATE TABLE IF NOT EXISTS v3_api_keys (
+    id           BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name         VARCHAR(255)    NOT NULL,
+    key_hash     CHAR(64)        NOT NULL,
+    role         VARCHAR(16)     NOT NULL,
+    user_ids     TEXT            NOT NULL,
+    enabled      TINYINT(1)      NOT NULL DEFAULT 1,
+    created_at   DATETIME        NOT NULL,
+    last_used_at DATETIME        NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_api_keys_hash (key_hash)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
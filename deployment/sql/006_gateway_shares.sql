@@ -0,0 +1,10 @@
+-- Access of other users (e.g. family members) to gateway and its devices.
+-- access is "read" for viewing data or "full" for commanding devices.
+CREATE TABLE IF NOT EXISTS v3_gateway_shares (
+    gateway_id VARCHAR(36)     NOT NULL,
+    user_id    BIGINT UNSIGNED NOT NULL,
+    access     VARCHAR(8)      NOT NULL,
+    created_at DATETIME        NOT NULL,
+    PRIMARY KEY (gateway_id, user_id),
+    KEY idx_gateway_shares_user (user_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
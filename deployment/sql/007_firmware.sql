@@ -0,0 +1,50 @@
+-- Gateway firmware catalog. models is comma separated list of gateway
+-- models firmware fits, empty for any model.
+CREATE TABLE IF NOT EXISTS v3_firmware (
+    id         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    version    VARCHAR(32)     NOT NULL,
+    url        VARCHAR(1024)   NOT NULL,
+    checksum   VARCHAR(128)    NOT NULL,
+    models     VARCHAR(512)    NOT NULL DEFAULT '',
+    notes      TEXT            NOT NULL,
+    created_at DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_firmware_version (version)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Staged firmware rollouts. definition is JSON with stages (cumulative
+-- percentages of target gateways), failure threshold and target filters.
+CREATE TABLE IF NOT EXISTS v3_firmware_campaigns (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    firmware_id BIGINT UNSIGNED NOT NULL,
+    title       VARCHAR(255)    NOT NULL,
+    definition  TEXT            NOT NULL,
+    stage       INT             NOT NULL DEFAULT 0,
+    status      VARCHAR(16)     NOT NULL,
+    reason      VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at  DATETIME        NOT NULL,
+    updated_at  DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_firmware_campaigns_status (status)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Firmware update of every campaign target gateway
+CREATE TABLE IF NOT EXISTS v3_firmware_updates (
+    campaign_id  BIGINT UNSIGNED NOT NULL,
+    gateway_id   VARCHAR(36)     NOT NULL,
+    from_version VARCHAR(32)     NOT NULL,
+    status       VARCHAR(16)     NOT NULL,
+    error        VARCHAR(255)    NOT NULL DEFAULT '',
+    updated_at   DATETIME        NOT NULL,
+    PRIMARY KEY (campaign_id, gateway_id),
+    KEY idx_firmware_updates_gateway (gateway_id, status)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Firmware version and model last reported by gateway status
+CREATE TABLE IF NOT EXISTS v3_gateway_firmware (
+    gateway_id  VARCHAR(36) NOT NULL,
+    model       VARCHAR(64) NOT NULL DEFAULT '',
+    version     VARCHAR(32) NOT NULL,
+    reported_at DATETIME    NOT NULL,
+    PRIMARY KEY (gateway_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,13 @@
+-- Gateway configuration taken before remote configuration change.
+-- patch holds camera fields sent to gateway, config is used for rollback.
+CREATE TABLE IF NOT EXISTS v3_gateway_config_snapshots (
+    id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    gateway_id  VARCHAR(36)     NOT NULL,
+    config      MEDIUMTEXT      NOT NULL,
+    patch       TEXT            NOT NULL,
+    created_by  VARCHAR(255)    NOT NULL,
+    rolled_back TINYINT(1)      NOT NULL DEFAULT 0,
+    created_at  DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_gateway_config_snapshots_gateway (gateway_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
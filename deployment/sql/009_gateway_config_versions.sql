@@ -0,0 +1,14 @@
+-- Every distinct configuration reported by gateway. version is numbered
+-- for each gateway separately, source is RPC command made (get or set).
+CREATE TABLE IF NOT EXISTS v3_gateway_config_versions (
+    gateway_id VARCHAR(36)     NOT NULL,
+    version    INT             NOT NULL,
+    source     VARCHAR(16)     NOT NULL,
+    config     MEDIUMTEXT      NOT NULL,
+    checksum   CHAR(64)        NOT NULL,
+    cameras    INT             NOT NULL DEFAULT 0,
+    zwave      INT             NOT NULL DEFAULT 0,
+    created_by VARCHAR(255)    NOT NULL,
+    created_at DATETIME        NOT NULL,
+    PRIMARY KEY (gateway_id, version)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,31 @@
+-- Uploads of camera local archive time ranges to cloud storage.
+-- range_start and range_end are UNIX time in milliseconds.
+CREATE TABLE IF NOT EXISTS v3_archive_uploads (
+    id          VARCHAR(36)     NOT NULL,
+    device_id   VARCHAR(36)     NOT NULL,
+    gateway_id  VARCHAR(36)     NOT NULL,
+    user_id     BIGINT UNSIGNED NOT NULL,
+    range_start BIGINT          NOT NULL,
+    range_end   BIGINT          NOT NULL,
+    status      VARCHAR(16)     NOT NULL,
+    progress    INT             NOT NULL DEFAULT 0,
+    segments    INT             NOT NULL DEFAULT 0,
+    error       VARCHAR(255)    NOT NULL DEFAULT '',
+    created_at  DATETIME        NOT NULL,
+    updated_at  DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_archive_uploads_device (device_id, created_at)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Uploaded archive segments indexed for playback
+CREATE TABLE IF NOT EXISTS v3_archive_segments (
+    upload_id  VARCHAR(36)   NOT NULL,
+    device_id  VARCHAR(36)   NOT NULL,
+    start_ms   BIGINT        NOT NULL,
+    end_ms     BIGINT        NOT NULL,
+    size       BIGINT        NOT NULL DEFAULT 0,
+    url        VARCHAR(1024) NOT NULL,
+    created_at DATETIME      NOT NULL,
+    PRIMARY KEY (upload_id, start_ms),
+    KEY idx_archive_segments_device (device_id, start_ms)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
@@ -0,0 +1,22 @@
+-- Tariff features evaluated by billing policy. Tariff id matches users.tfid.
+-- Zero limits mean no limit. Recording of paid tariffs requires positive balance.
+CREATE TABLE IF NOT EXISTS v3_tariffs (
+    id                   BIGINT UNSIGNED NOT NULL,
+    title                VARCHAR(255)    NOT NULL,
+    continuous_recording TINYINT(1)      NOT NULL DEFAULT 0,
+    motion_recording     TINYINT(1)      NOT NULL DEFAULT 0,
+    schedule_recording   TINYINT(1)      NOT NULL DEFAULT 0,
+    retention_days       INT             NOT NULL DEFAULT 0,
+    max_cameras          INT             NOT NULL DEFAULT 0,
+    push_allowed         TINYINT(1)      NOT NULL DEFAULT 1,
+    sensor_history_days  INT             NOT NULL DEFAULT 0,
+    paid                 TINYINT(1)      NOT NULL DEFAULT 0,
+    updated_at           DATETIME        NOT NULL,
+    PRIMARY KEY (id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Online tariff without cloud recording
+INSERT IGNORE INTO v3_tariffs
+    (id, title, continuous_recording, motion_recording, schedule_recording,
+     retention_days, max_cameras, push_allowed, sensor_history_days, paid, updated_at)
+VALUES (1, 'Online', 0, 0, 0, 0, 0, 1, 0, 0, now());
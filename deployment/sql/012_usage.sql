@@ -0,0 +1,22 @@
+-- Camera recording and streaming intervals metered for billing
+CREATE TABLE IF NOT EXISTS v3_usage_intervals (
+    id         BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id    BIGINT UNSIGNED NOT NULL,
+    device_id  VARCHAR(36)     NOT NULL,
+    kind       VARCHAR(16)     NOT NULL,
+    started_at DATETIME        NOT NULL,
+    ended_at   DATETIME        NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_usage_intervals_user (user_id, started_at)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
+-- Daily usage per user device. Day is server local date.
+CREATE TABLE IF NOT EXISTS v3_usage_daily (
+    user_id           BIGINT UNSIGNED NOT NULL,
+    device_id         VARCHAR(36)     NOT NULL,
+    day               DATE            NOT NULL,
+    recording_seconds BIGINT          NOT NULL DEFAULT 0,
+    streaming_seconds BIGINT          NOT NULL DEFAULT 0,
+    sensor_points     BIGINT          NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day, device_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
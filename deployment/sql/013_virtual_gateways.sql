@@ -0,0 +1,8 @@
+-- Virtual gateways of direct-to-cloud devices. Only gateways listed here get
+-- virtual channels created by ingested messages, hardware gateways are
+-- processed by servers holding their broker channels.
+CREATE TABLE IF NOT EXISTS v3_virtual_gateways (
+    gateway_id VARCHAR(36) NOT NULL,
+    created_at DATETIME    NOT NULL,
+    PRIMARY KEY (gateway_id)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
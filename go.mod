@@ -3,8 +3,10 @@ module github.com/ahamtat/iot-cloud-server
 go 1.13
 
 require (
-	github.com/gin-gonic/gin v1.5.0
+	github.com/eclipse/paho.golang v0.9.0
+	github.com/gin-gonic/gin v1.7.7
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/google/uuid v1.1.1
 	github.com/influxdata/influxdb1-client v0.0.0-20191209144304-8bf82d3c094d
 	github.com/jmoiron/sqlx v1.2.0
@@ -0,0 +1,52 @@
+package entities
+
+import "time"
+
+// Account event types sent by billing
+const (
+	AccountBalanceChanged = "balanceChanged"
+	AccountBlocked        = "blocked"
+	AccountUnblocked      = "unblocked"
+	AccountTariffChanged  = "tariffChanged"
+)
+
+// AccountEvent structure to represent user account change made by billing.
+// Missing money and tariff are read from database.
+type AccountEvent struct {
+	Type      string  `json:"type"`
+	UserID    uint64  `json:"userId"`
+	Money     *uint64 `json:"money,omitempty"`
+	TariffID  *uint64 `json:"tariffId,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+	Timestamp string  `json:"timestampMs,omitempty"`
+}
+
+// IsValidAccountEventType checks if account event type is known
+func IsValidAccountEventType(eventType string) bool {
+	switch eventType {
+	case AccountBalanceChanged, AccountBlocked, AccountUnblocked, AccountTariffChanged:
+		return true
+	}
+	return false
+}
+
+// ToMessage makes message describing account event for platform event data
+func (e *AccountEvent) ToMessage() *IotMessage {
+	message := &IotMessage{
+		Timestamp:   e.Timestamp,
+		MessageType: "account",
+		Status:      e.Type,
+		UserId:      e.UserID,
+		Content:     e.Reason,
+	}
+	if len(message.Timestamp) == 0 {
+		message.Timestamp = CreateTimestampMs(time.Now().Local())
+	}
+	if e.Money != nil {
+		message.Money = *e.Money
+	}
+	if e.TariffID != nil {
+		message.TariffId = *e.TariffID
+	}
+	return message
+}
@@ -0,0 +1,74 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Platform event types
+const (
+	EventGatewayStatus   = "gateway.status"
+	EventGatewayOffline  = "gateway.offline"
+	EventSensorData      = "sensor.data"
+	EventCameraMotion    = "camera.motion"
+	EventCameraState     = "camera.state"
+	EventCameraStreaming = "camera.streaming"
+	EventArchiveUpload   = "camera.archiveUpload"
+	EventAccountChanged  = "account.changed"
+	EventRuleFired       = "rule.fired"
+)
+
+// EventTypes lists all platform event types
+var EventTypes = []string{
+	EventGatewayStatus,
+	EventGatewayOffline,
+	EventSensorData,
+	EventCameraMotion,
+	EventCameraState,
+	EventCameraStreaming,
+	EventArchiveUpload,
+	EventAccountChanged,
+	EventRuleFired,
+}
+
+// Event structure to represent platform event delivered to integrators
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Timestamp string      `json:"timestampMs"`
+	UserID    uint64      `json:"userId"`
+	GatewayID string      `json:"gatewayId,omitempty"`
+	DeviceID  string      `json:"deviceId,omitempty"`
+	RuleID    uint64      `json:"ruleId,omitempty"`
+	Data      *IotMessage `json:"data,omitempty"`
+}
+
+// NewEvent creates platform event from gateway message
+func NewEvent(eventType string, userID uint64, message *IotMessage) *Event {
+	event := &Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Timestamp: CreateTimestampMs(time.Now().Local()),
+		UserID:    userID,
+	}
+	if message != nil {
+		// Do not send long preview images to integrators
+		data := *message
+		data.Preview = ""
+		event.GatewayID = data.GatewayId
+		event.DeviceID = data.DeviceId
+		event.Data = &data
+	}
+	return event
+}
+
+// IsValidEventType checks if event type is known
+func IsValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
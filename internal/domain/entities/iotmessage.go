@@ -49,40 +49,58 @@ type ZWaveParams struct {
 	Status        string `json:"status,omitempty"`
 }
 
+// ArchiveSegment holds data of camera local archive segment.
+// Start and end are UNIX time in milliseconds, URL is set for uploaded segments.
+type ArchiveSegment struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Size  int64  `json:"size,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
 // IotMessage structure to represent IoT-gateway message
 type IotMessage struct {
-	Timestamp       string         `json:"timestampMs,omitempty"`
-	Vendor          string         `json:"vendor,omitempty"`
-	Version         string         `json:"version,omitempty"`
-	GatewayId       string         `json:"gatewayId,omitempty"`
-	ClientType      string         `json:"clientType,omitempty"`
-	DeviceId        string         `json:"deviceId,omitempty"`
-	DeviceType      string         `json:"deviceType,omitempty"`
-	DeviceState     string         `json:"deviceState,omitempty"`
-	DeviceTableId   uint64         `json:"deviceTableId,omitempty"`
-	Protocol        string         `json:"protocol,omitempty"`
-	MessageType     string         `json:"messageType,omitempty"`
-	SensorType      string         `json:"sensorType,omitempty"`
-	SensorData      string         `json:"sensorData,omitempty"`
-	Preview         string         `json:"preview,omitempty"`
-	Label           string         `json:"label,omitempty"`
-	Value           string         `json:"value,omitempty"`
-	Units           string         `json:"units,omitempty"`
-	MediaserverIp   string         `json:"mediaserverIp,omitempty"`
-	ApplicationName string         `json:"applicationName,omitempty"`
-	Recording       string         `json:"recording,omitempty"`
-	Command         string         `json:"command,omitempty"`
-	Attribute       string         `json:"attribute,omitempty"`
-	TariffId        uint64         `json:"tariffId,omitempty"`
-	Money           uint64         `json:"money,omitempty"`
-	Vip             bool           `json:"vip,omitempty"`
-	LegalEntity     bool           `json:"isLegalEntity,omitempty"`
-	UserId          uint64         `json:"userId,omitempty"`
-	Title           string         `json:"title,omitempty"`
-	Content         string         `json:"content,omitempty"`
-	Status          string         `json:"status,omitempty"`
-	Cameras         []CameraParams `json:"cameras,omitempty"`
-	ZWave           []ZWaveParams  `json:"zwave,omitempty"`
+	Timestamp       string           `json:"timestampMs,omitempty"`
+	Vendor          string           `json:"vendor,omitempty"`
+	Version         string           `json:"version,omitempty"`
+	GatewayId       string           `json:"gatewayId,omitempty"`
+	ClientType      string           `json:"clientType,omitempty"`
+	DeviceId        string           `json:"deviceId,omitempty"`
+	DeviceType      string           `json:"deviceType,omitempty"`
+	DeviceState     string           `json:"deviceState,omitempty"`
+	DeviceTableId   uint64           `json:"deviceTableId,omitempty"`
+	Protocol        string           `json:"protocol,omitempty"`
+	MessageType     string           `json:"messageType,omitempty"`
+	SensorType      string           `json:"sensorType,omitempty"`
+	SensorData      string           `json:"sensorData,omitempty"`
+	Preview         string           `json:"preview,omitempty"`
+	Label           string           `json:"label,omitempty"`
+	Value           string           `json:"value,omitempty"`
+	Units           string           `json:"units,omitempty"`
+	MediaserverIp   string           `json:"mediaserverIp,omitempty"`
+	ApplicationName string           `json:"applicationName,omitempty"`
+	Recording       string           `json:"recording,omitempty"`
+	Command         string           `json:"command,omitempty"`
+	Attribute       string           `json:"attribute,omitempty"`
+	TariffId        uint64           `json:"tariffId,omitempty"`
+	Money           uint64           `json:"money,omitempty"`
+	Vip             bool             `json:"vip,omitempty"`
+	LegalEntity     bool             `json:"isLegalEntity,omitempty"`
+	UserId          uint64           `json:"userId,omitempty"`
+	Title           string           `json:"title,omitempty"`
+	Content         string           `json:"content,omitempty"`
+	Status          string           `json:"status,omitempty"`
+	Model           string           `json:"model,omitempty"`
+	FirmwareUrl     string           `json:"firmwareUrl,omitempty"`
+	Checksum        string           `json:"checksum,omitempty"`
+	UploadId        string           `json:"uploadId,omitempty"`
+	UploadUrl       string           `json:"uploadUrl,omitempty"`
+	RangeStart      string           `json:"rangeStart,omitempty"`
+	RangeEnd        string           `json:"rangeEnd,omitempty"`
+	Progress        int              `json:"progress,omitempty"`
+	Segments        []ArchiveSegment `json:"segments,omitempty"`
+	Cameras         []CameraParams   `json:"cameras,omitempty"`
+	ZWave           []ZWaveParams    `json:"zwave,omitempty"`
 }
 
 // GetSensorType returns type of sensor
@@ -0,0 +1,38 @@
+package entities
+
+import "time"
+
+// SensorHistoryQuery holds parameters for reading sensor values back from time-series storage
+type SensorHistoryQuery struct {
+	GatewayID  string
+	DeviceID   string
+	DeviceType string
+	Label      string
+	From       time.Time
+	To         time.Time
+	Step       time.Duration
+	Aggregate  string
+}
+
+// SensorHistoryPoint structure to represent one aggregated sensor value
+type SensorHistoryPoint struct {
+	Timestamp int64   `json:"timestampMs"`
+	Value     float64 `json:"value"`
+}
+
+// Sensor history aggregate functions
+const (
+	AggregateMean = "mean"
+	AggregateMin  = "min"
+	AggregateMax  = "max"
+	AggregateLast = "last"
+)
+
+// IsValidAggregate checks if aggregate function is supported
+func IsValidAggregate(agg string) bool {
+	switch agg {
+	case AggregateMean, AggregateMin, AggregateMax, AggregateLast:
+		return true
+	}
+	return false
+}
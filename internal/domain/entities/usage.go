@@ -0,0 +1,8 @@
+package entities
+
+// Metered usage kinds
+const (
+	UsageRecording    = "recording"
+	UsageStreaming    = "streaming"
+	UsageSensorPoints = "sensorPoints"
+)
@@ -11,4 +11,6 @@ type Logic interface {
 	LoadParams(writer io.Writer) error
 	Process(message *entities.IotMessage) error
 	SetPush(state bool)
+	SetOffline()
+	Release()
 }
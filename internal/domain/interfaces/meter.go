@@ -0,0 +1,12 @@
+package interfaces
+
+// UsageMeter interface for metering camera recording and streaming time
+// and stored sensor points billed to users
+type UsageMeter interface {
+	// Begin opens usage interval of device, opened one is kept
+	Begin(kind string, userID uint64, deviceID string)
+	// End closes usage interval of device if opened
+	End(kind string, userID uint64, deviceID string)
+	// Count adds number of used items, e.g. stored sensor points
+	Count(kind string, userID uint64, deviceID string, n int64)
+}
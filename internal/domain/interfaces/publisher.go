@@ -0,0 +1,9 @@
+package interfaces
+
+import "github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+
+// EventPublisher interface for delivering platform events to external subscribers
+type EventPublisher interface {
+	Publish(event *entities.Event)
+	PublishTo(webhookID uint64, event *entities.Event)
+}
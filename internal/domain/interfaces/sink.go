@@ -0,0 +1,12 @@
+package interfaces
+
+import "github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+
+// SensorSink interface for storing sensor data in time-series backend
+// and reading aggregated history back. Points are stored asynchronously,
+// written callback is called once point is persisted and may be nil.
+type SensorSink interface {
+	Store(message *entities.IotMessage, written func()) error
+	QueryHistory(query *entities.SensorHistoryQuery) ([]entities.SensorHistoryPoint, error)
+	Close() error
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+
+// MessageTracker interface for server-wide services following gateway messages,
+// e.g. firmware update progress or camera streaming state
+type MessageTracker interface {
+	Track(message *entities.IotMessage)
+}
@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/messages"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/tariffs"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tasks"
+)
+
+// UpdateAccount applies account params changed by billing. Cloud recording
+// of streaming cameras is started or stopped when account changes allow it.
+func (l *GatewayLogic) UpdateAccount(user params.UserLogicParams) {
+	previous := l.updateUser(func(current *params.UserLogicParams) { *current = user })
+	before, after := l.policyFor(&previous), l.policyFor(&user)
+
+	l.CameraParams.Range(func(deviceID string, value interface{}) {
+		p, ok := value.(*params.CameraLogicParams)
+		if !ok || !p.State().MediaserverParamsSet {
+			return
+		}
+		wasRecording := accountRecording(before, previous.Blocked, p)
+		isRecording := accountRecording(after, user.Blocked, p)
+		if wasRecording == isRecording {
+			return
+		}
+		// Start or stop recording on Wowza
+		go tasks.NewRecordMediaStreamTask(l.meter, user.UserId).Run(p.ToMessage(isRecording))
+		logger.Info("Camera recording changed by account update", "device", deviceID,
+			"recording", isRecording, "gateway", l.gatewayId, "caller", "GatewayLogic")
+	})
+}
+
+// accountRecording checks that streaming camera is recorded in cloud
+// for account, cameras of blocked account are not recorded
+func accountRecording(policy tariffs.Policy, blocked bool, p *params.CameraLogicParams) bool {
+	return !blocked && cameraRecording(policy, p)
+}
+
+// cameraRecording checks that streaming camera is recorded in cloud with policy
+func cameraRecording(policy tariffs.Policy, p *params.CameraLogicParams) bool {
+	state := p.State()
+	if !policy.CanRecord(state.RecordingMode) {
+		return false
+	}
+	switch state.RecordingMode {
+	case params.RecordingModeContinuous:
+		return true
+	case params.RecordingModeMotion:
+		return state.MotionInProcess
+	}
+	return false
+}
+
+// NotifyAccountEvent sends account event to user webhooks and informs user
+// with push notification if user has them enabled
+func NotifyAccountEvent(services *Services, user *params.UserLogicParams, event *entities.AccountEvent) {
+	if services.Events != nil {
+		services.Events.Publish(entities.NewEvent(entities.EventAccountChanged, event.UserID, event.ToMessage()))
+	}
+	if !user.Push {
+		return
+	}
+
+	var content string
+	switch event.Type {
+	case entities.AccountBlocked:
+		content = "Аккаунт заблокирован"
+	case entities.AccountUnblocked:
+		content = "Аккаунт разблокирован"
+	case entities.AccountTariffChanged:
+		content = "Тариф изменён"
+	case entities.AccountBalanceChanged:
+		// Only empty balance matters to user
+		if user.Money > 0 {
+			return
+		}
+		content = "Баланс исчерпан, пополните счёт"
+	default:
+		return
+	}
+	pushMessage := messages.NewPushMessage("account", "Аккаунт", content, 0, event.UserID)
+	go tasks.NewSendPushNotificationTask(services.Conn).Run(pushMessage)
+}
@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"testing"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/tariffs"
+)
+
+func TestAccountRecordingTransition(t *testing.T) {
+	paid := params.UserLogicParams{TarifId: 2, Money: 100}
+	empty := params.UserLogicParams{TarifId: 2}
+	online := params.UserLogicParams{TarifId: tariffs.TariffOnline, Money: 100}
+	blocked := params.UserLogicParams{TarifId: 2, Money: 100, Blocked: true}
+	vipEmpty := params.UserLogicParams{TarifId: 2, Vip: true}
+
+	tests := []struct {
+		name         string
+		before       params.UserLogicParams
+		after        params.UserLogicParams
+		mode         params.CloudCameraRecordingMode
+		motion       bool
+		wasRecording bool
+		isRecording  bool
+	}{
+		{"balance exhausted stops recording", paid, empty, params.RecordingModeContinuous, false, true, false},
+		{"balance topped up starts recording", empty, paid, params.RecordingModeContinuous, false, false, true},
+		{"upgrade from online tariff starts recording", online, paid, params.RecordingModeContinuous, false, false, true},
+		{"downgrade to online tariff stops recording", paid, online, params.RecordingModeContinuous, false, true, false},
+		{"blocking stops recording", paid, blocked, params.RecordingModeContinuous, false, true, false},
+		{"unblocking starts recording", blocked, paid, params.RecordingModeContinuous, false, false, true},
+		{"VIP keeps recording with empty balance", paid, vipEmpty, params.RecordingModeContinuous, false, true, true},
+		{"motion camera is idle without motion", empty, paid, params.RecordingModeMotion, false, false, false},
+		{"motion camera records motion in process", empty, paid, params.RecordingModeMotion, true, false, true},
+		{"camera without recording mode is not recorded", empty, paid, params.RecordingModeNoRecord, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &params.CameraLogicParams{CameraState: params.CameraState{
+				RecordingMode:        tt.mode,
+				MotionInProcess:      tt.motion,
+				MediaserverParamsSet: true,
+			}}
+			before := tariffs.Evaluate(nil, &tt.before)
+			after := tariffs.Evaluate(nil, &tt.after)
+
+			if got := accountRecording(before, tt.before.Blocked, p); got != tt.wasRecording {
+				t.Errorf("was recording = %v, want %v", got, tt.wasRecording)
+			}
+			if got := accountRecording(after, tt.after.Blocked, p); got != tt.isRecording {
+				t.Errorf("is recording = %v, want %v", got, tt.isRecording)
+			}
+		})
+	}
+}
@@ -42,35 +42,32 @@ func (l *GatewayLogic) processCameraState(message *entities.IotMessage) error {
 	case "off":
 		return nil
 	case "streamingOn":
-		// Check tariff restrictions first
-		if !l.UserParams.CanBeRecorded() {
+		// Store mediaserver params to start recording when account allows it
+		cameraLogicParams.SetMediaserver(message.MediaserverIp, message.ApplicationName)
+		// Check tariff restrictions
+		if !l.policy().Recording() {
 			return nil
 		}
 		message.Recording = "on"
-		// Store mediaserver params
-		cameraLogicParams.MediaserverIp = message.MediaserverIp
-		cameraLogicParams.ApplicationName = message.ApplicationName
-		cameraLogicParams.MediaserverParamsSet = true
 	case "streamingOff":
 		message.Recording = "off"
-		// Restore mediaserver params
-		message.MediaserverIp = cameraLogicParams.MediaserverIp
-		message.ApplicationName = cameraLogicParams.ApplicationName
-		// Clear mediaserver params
-		cameraLogicParams.MediaserverIp = ""
-		cameraLogicParams.ApplicationName = ""
-		cameraLogicParams.MediaserverParamsSet = false
+		// Restore and clear mediaserver params
+		message.MediaserverIp, message.ApplicationName = cameraLogicParams.ClearMediaserver()
 	default:
 		return errors.New("wrong deviceState: " + message.DeviceState)
 	}
 
 	// Check recording mode
-	switch cameraLogicParams.RecordingMode {
+	state := cameraLogicParams.State()
+	if !l.policy().CanRecord(state.RecordingMode) {
+		return nil
+	}
+	switch state.RecordingMode {
 	case params.RecordingModeContinuous:
-		go tasks.NewRecordMediaStreamTask().Run(message)
+		go tasks.NewRecordMediaStreamTask(l.meter, l.user().UserId).Run(message)
 	case params.RecordingModeMotion:
-		if cameraLogicParams.MotionInProcess {
-			go tasks.NewRecordMediaStreamTask().Run(message)
+		if state.MotionInProcess {
+			go tasks.NewRecordMediaStreamTask(l.meter, l.user().UserId).Run(message)
 		}
 	}
 
@@ -84,22 +81,23 @@ func (l *GatewayLogic) processCameraData(message *entities.IotMessage) error {
 	}
 
 	// If recording is motion and detector message then do recording
-	if message.Label == "motionDetector" && cameraLogicParams.RecordingMode == params.RecordingModeMotion {
-		cameraLogicParams.MotionInProcess = message.SensorData == "on"
+	if message.Label == "motionDetector" && cameraLogicParams.State().RecordingMode == params.RecordingModeMotion &&
+		l.policy().CanRecord(params.RecordingModeMotion) {
+		cameraLogicParams.SetMotionInProcess(message.SensorData == "on")
 		//if cameraLogicParams.MediaserverParamsSet {
 		message.Recording = message.SensorData
 		//// Restore mediaserver params
 		//message.MediaserverIp = cameraLogicParams.MediaserverIp
 		//message.ApplicationName = cameraLogicParams.ApplicationName
-		go tasks.NewRecordMediaStreamTask().Run(message)
+		go tasks.NewRecordMediaStreamTask(l.meter, l.user().UserId).Run(message)
 		//}
 	}
 
 	// Save camera sensors events in InfluxDB
-	go tasks.NewStoreSensorDataInfluxTask().Run(message)
+	go tasks.NewStoreSensorDataInfluxTask(l.sink, l.meter, l.user().UserId).Run(message)
 
 	// Inform user about motion detection
-	if message.Label == "motionDetector" && message.SensorData == "on" && l.UserParams.Push {
+	if message.Label == "motionDetector" && message.SensorData == "on" && l.policy().CanPush() {
 		pushMessage := messages.NewPushMessage(
 			"camera",
 			cameraLogicParams.Title,
@@ -120,41 +118,52 @@ func (l *GatewayLogic) processCameraCommand(message *entities.IotMessage) error
 
 	if message.Command == "setRecording" {
 		newRecordingMode := cameraLogicParams.ConvertRecordingMode(message.Attribute)
-		currentRecordingMode := cameraLogicParams.RecordingMode
-
-		prevTariffId := l.UserParams.TarifId
-
-		// Update user params
-		l.UserParams.TarifId = message.TariffId
-		l.UserParams.Money = message.Money
-		l.UserParams.Vip = message.Vip
-		l.UserParams.LegalEntity = message.LegalEntity
-
-		if currentRecordingMode == params.RecordingModeMotion &&
-			newRecordingMode == params.RecordingModeContinuous &&
-			l.UserParams.CanBeRecorded() {
-			// Start recording on Wowza
-			recordingCommand := cameraLogicParams.ToMessage(true)
-			go tasks.NewRecordMediaStreamTask().Run(recordingCommand)
-		} else if currentRecordingMode == params.RecordingModeContinuous &&
-			newRecordingMode == params.RecordingModeMotion {
-			// Stop recording on Wowza
-			recordingCommand := cameraLogicParams.ToMessage(false)
-			go tasks.NewRecordMediaStreamTask().Run(recordingCommand)
-		} else if currentRecordingMode == newRecordingMode {
-			// Process user with online tariff
-			if prevTariffId == params.UserTarifOnline && l.UserParams.CanBeRecorded() {
-				// Start recording on Wowza
-				recordingCommand := cameraLogicParams.ToMessage(true)
-				go tasks.NewRecordMediaStreamTask().Run(recordingCommand)
-			}
-			if prevTariffId > params.UserTarifOnline && message.TariffId == params.UserTarifOnline {
-				// Stop recording on Wowza
-				recordingCommand := cameraLogicParams.ToMessage(false)
-				go tasks.NewRecordMediaStreamTask().Run(recordingCommand)
-			}
+
+		// Camera is recorded continuously by Wowza only if tariff allows it
+		wasRecording := cameraLogicParams.State().RecordingMode == params.RecordingModeContinuous &&
+			l.policy().CanRecord(params.RecordingModeContinuous)
+
+		// Account data is changed by billing account events only
+		cameraLogicParams.SetRecordingMode(message.Attribute)
+
+		isRecording := newRecordingMode == params.RecordingModeContinuous &&
+			l.policy().CanRecord(params.RecordingModeContinuous)
+
+		if wasRecording != isRecording {
+			// Start or stop recording on Wowza
+			recordingCommand := cameraLogicParams.ToMessage(isRecording)
+			go tasks.NewRecordMediaStreamTask(l.meter, l.user().UserId).Run(recordingCommand)
 		}
 	}
 
 	return nil
 }
+
+// meterStreaming meters camera cloud streaming time of gateway owner
+func (l *GatewayLogic) meterStreaming(message *entities.IotMessage) {
+	if l.meter == nil || message.DeviceType != "camera" {
+		return
+	}
+	if message.MessageType != "deviceState" && message.MessageType != "cloudStreaming" {
+		return
+	}
+	switch message.DeviceState {
+	case "streamingOn":
+		l.meter.Begin(entities.UsageStreaming, l.user().UserId, message.DeviceId)
+	case "streamingOff":
+		l.meter.End(entities.UsageStreaming, l.user().UserId, message.DeviceId)
+	}
+}
+
+// endCameraUsage ends metered streaming and recording of all gateway cameras
+// as their streams are gone with gateway
+func (l *GatewayLogic) endCameraUsage() {
+	if l.meter == nil {
+		return
+	}
+	userID := l.user().UserId
+	l.CameraParams.Range(func(deviceID string, _ interface{}) {
+		l.meter.End(entities.UsageStreaming, userID, deviceID)
+		l.meter.End(entities.UsageRecording, userID, deviceID)
+	})
+}
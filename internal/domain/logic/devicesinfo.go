@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+)
+
+// CameraInfo holds camera params and runtime state of gateway business logic
+type CameraInfo struct {
+	DeviceID        string `json:"deviceId"`
+	Title           string `json:"title"`
+	UserID          uint64 `json:"userId"`
+	RecordingMode   string `json:"recordingMode"`
+	Schedule        string `json:"schedule,omitempty"`
+	MotionInProcess bool   `json:"motionInProcess"`
+	Recorded        bool   `json:"recorded"`
+	MediaserverIP   string `json:"mediaserverIp,omitempty"`
+	ApplicationName string `json:"applicationName,omitempty"`
+}
+
+// SensorValueInfo holds last value of one sensor of device
+type SensorValueInfo struct {
+	Label       string     `json:"label"`
+	Description string     `json:"description,omitempty"`
+	Value       string     `json:"value,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+	Influx      bool       `json:"influx"`
+	Notify      bool       `json:"notify"`
+}
+
+// SensorInfo holds sensor device params and its last values
+type SensorInfo struct {
+	DeviceID string            `json:"deviceId"`
+	Title    string            `json:"title"`
+	UserID   uint64            `json:"userId"`
+	Values   []SensorValueInfo `json:"values"`
+}
+
+// OwnerID returns id of user owning gateway
+func (l *GatewayLogic) OwnerID() uint64 {
+	return l.user().UserId
+}
+
+// Cameras returns gateway cameras with their runtime state
+func (l *GatewayLogic) Cameras() []CameraInfo {
+	list := make([]CameraInfo, 0)
+	policy := l.policy()
+	l.CameraParams.Range(func(_ string, value interface{}) {
+		p, ok := value.(*params.CameraLogicParams)
+		if !ok {
+			return
+		}
+		state := p.State()
+		list = append(list, CameraInfo{
+			DeviceID:        p.DeviceId,
+			Title:           p.Title,
+			UserID:          p.UserId,
+			RecordingMode:   state.RecordingMode.String(),
+			Schedule:        p.Schedule,
+			MotionInProcess: state.MotionInProcess,
+			Recorded:        policy.CanRecord(state.RecordingMode),
+			MediaserverIP:   state.MediaserverIp,
+			ApplicationName: state.ApplicationName,
+		})
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// Sensors returns gateway sensor devices with their last values
+func (l *GatewayLogic) Sensors() []SensorInfo {
+	list := make([]SensorInfo, 0)
+	l.SensorParams.Range(func(_ string, value interface{}) {
+		p, ok := value.(*params.SensorLogicParams)
+		if !ok {
+			return
+		}
+		info := SensorInfo{
+			DeviceID: p.DeviceId,
+			Title:    p.Title,
+			UserID:   p.UserId,
+			Values:   make([]SensorValueInfo, 0),
+		}
+		p.Inner.Range(func(label string, value interface{}) {
+			ip, ok := value.(*params.InnerParams)
+			if !ok {
+				return
+			}
+			lastValue, timestamp := ip.LastValue()
+			v := SensorValueInfo{
+				Label:       label,
+				Description: ip.Desc,
+				Value:       lastValue,
+				Influx:      ip.Influx,
+				Notify:      ip.Notify,
+			}
+			if !timestamp.IsZero() {
+				v.Timestamp = &timestamp
+			}
+			info.Values = append(info.Values, v)
+		})
+		sort.Slice(info.Values, func(i, j int) bool { return info.Values[i].Label < info.Values[j].Label })
+		list = append(list, info)
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"io"
+	"sync"
 
 	"github.com/spf13/viper"
 
@@ -20,24 +21,43 @@ import (
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
 	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
 	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/rules"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/shadow"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/tariffs"
 )
 
 type GatewayLogic struct {
 	ctx          context.Context
 	conn         *database.Connection
+	sink         interfaces.SensorSink
+	events       interfaces.EventPublisher
+	trackers     []interfaces.MessageTracker
+	writer       io.Writer
 	gatewayId    string
 	CameraParams *params.GuardedParamsMap
 	SensorParams *params.GuardedParamsMap
-	UserParams   params.UserLogicParams
+	userMx       sync.RWMutex
+	userParams   params.UserLogicParams // read with user() as account updates change it
+	Shadow       *shadow.GatewayShadow
+	Rules        *rules.Engine
+	tariffs      *tariffs.Registry
+	meter        interfaces.UsageMeter
 }
 
-func NewGatewayLogic(ctx context.Context, conn *database.Connection, gatewayId string) interfaces.Logic {
+func NewGatewayLogic(ctx context.Context, services *Services, gatewayId string) interfaces.Logic {
 	return &GatewayLogic{
 		ctx:          ctx,
-		conn:         conn,
+		conn:         services.Conn,
+		sink:         services.Sink,
+		events:       services.Events,
+		trackers:     services.Trackers,
 		gatewayId:    gatewayId,
 		CameraParams: params.NewGuardedParamsMap(),
 		SensorParams: params.NewGuardedParamsMap(),
+		Shadow:       services.Shadows.Get(gatewayId),
+		Rules:        services.Rules.Get(gatewayId),
+		tariffs:      services.Tariffs,
+		meter:        services.Meter,
 	}
 }
 
@@ -48,22 +68,18 @@ func (l *GatewayLogic) LoadParams(writer io.Writer) error {
 	if writer == nil {
 		return errors.New("wrong input parameter")
 	}
+	l.writer = writer
 
 	// Wrap context with timeout value for database interactions
 	ctx1, cancel1 := context.WithTimeout(l.ctx, viper.GetDuration("db.cloud.timeout"))
 	defer cancel1()
 
 	// Load user params
-	userParamsQueryText :=
-		`SELECT usr.id AS user_id, usr.tfid AS tarif_id, usr.amount AS money, 
-			usr.vip, usr.isLegalEntity, usr.blocked, usr.push
-		FROM v3_gateways AS gw
-			INNER JOIN users AS usr
-				ON gw.user_id = usr.id
-		WHERE gw.gateway_id = ?;`
-	if err = l.conn.Db.GetContext(ctx1, &l.UserParams, userParamsQueryText, l.gatewayId); err != nil {
-		return errors.Wrap(err, "failed to query user params")
+	userParams, err := tariffs.LoadGatewayAccount(ctx1, l.conn, l.gatewayId)
+	if err != nil {
+		return err
 	}
+	l.updateUser(func(user *params.UserLogicParams) { *user = *userParams })
 
 	// Wrap context with timeout value for database interactions
 	ctx2, cancel2 := context.WithTimeout(l.ctx, viper.GetDuration("db.cloud.timeout"))
@@ -155,6 +171,17 @@ func (l *GatewayLogic) LoadParams(writer io.Writer) error {
 	}
 	_ = sensorRows.Close()
 
+	// Wrap context with timeout value for database interactions
+	ctx4, cancel4 := context.WithTimeout(l.ctx, viper.GetDuration("db.cloud.timeout"))
+	defer cancel4()
+
+	// Load automation rules. Gateway can operate without them.
+	if err = l.Rules.Load(ctx4, l.conn); err != nil {
+		logger.Error("failed loading automation rules", "error", err,
+			"gateway", l.gatewayId, "caller", "GatewayLogic")
+	}
+	go l.runSchedule()
+
 	logger.Debug("Params for business logic were loaded successfully",
 		"gateway", l.gatewayId, "caller", "GatewayLogic")
 
@@ -171,9 +198,35 @@ func (l *GatewayLogic) LoadParams(writer io.Writer) error {
 	logger.Debug("Registered message were sent to gateway",
 		"gateway", l.gatewayId, "caller", "GatewayLogic")
 
+	// Resend commands which were not applied before gateway reconnection
+	l.sendShadowDeltas(writer)
+
 	return nil
 }
 
+// sendShadowDeltas sends commands for devices which desired state differs from reported one
+func (l *GatewayLogic) sendShadowDeltas(writer io.Writer) {
+	if l.Shadow == nil {
+		return
+	}
+	for _, command := range l.Shadow.Deltas() {
+		jsonMessage, err := json.Marshal(command)
+		if err != nil {
+			logger.Error("error marshalling JSON", "error", err,
+				"gateway", l.gatewayId, "caller", "GatewayLogic")
+			continue
+		}
+		if _, err = writer.Write(jsonMessage); err != nil {
+			logger.Error("error sending shadow delta to gateway", "error", err,
+				"gateway", l.gatewayId, "caller", "GatewayLogic")
+			continue
+		}
+		logger.Debug("Shadow delta were sent to gateway", "device", command.DeviceId,
+			"command", command.Command, "attribute", command.Attribute,
+			"gateway", l.gatewayId, "caller", "GatewayLogic")
+	}
+}
+
 // Extract one value from JSON string
 func getDescription(full, value string) string {
 	m := map[string]string{}
@@ -187,13 +240,53 @@ func getDescription(full, value string) string {
 	return out
 }
 
+// policy evaluates tariff features of gateway owner
+func (l *GatewayLogic) policy() tariffs.Policy {
+	user := l.user()
+	return l.policyFor(&user)
+}
+
+// policyFor makes policy for account params
+func (l *GatewayLogic) policyFor(user *params.UserLogicParams) tariffs.Policy {
+	if l.tariffs == nil {
+		return tariffs.Evaluate(nil, user)
+	}
+	return l.tariffs.Evaluate(user)
+}
+
+// user returns copy of gateway owner account params
+func (l *GatewayLogic) user() params.UserLogicParams {
+	l.userMx.RLock()
+	defer l.userMx.RUnlock()
+	return l.userParams
+}
+
+// updateUser changes gateway owner account params under lock
+// and returns params before change
+func (l *GatewayLogic) updateUser(update func(user *params.UserLogicParams)) params.UserLogicParams {
+	l.userMx.Lock()
+	defer l.userMx.Unlock()
+	before := l.userParams
+	update(&l.userParams)
+	return before
+}
+
 func (l *GatewayLogic) Process(message *entities.IotMessage) error {
 	// Check input params
 	if message == nil {
 		return errors.New("wrong input parameter")
 	}
+	// Update device shadow with reported state
+	l.reportShadow(message)
+
+	// Follow firmware update progress and streaming state whatever account state is
+	for _, tracker := range l.trackers {
+		tracker.Track(message)
+	}
+	l.meterStreaming(message)
+
 	// Check if user is blocked
-	if l.UserParams.Blocked {
+	if l.user().Blocked {
 		logger.Info("Gateway owner's account is blocked in cloud database")
 		return nil
 	}
@@ -207,6 +300,7 @@ func (l *GatewayLogic) Process(message *entities.IotMessage) error {
 	case "status":
 		// Update gateway status in MySQL database
 		go tasks.NewUpdateGatewayStatusTask(l.conn).Run(message)
+		l.publishEvent(entities.EventGatewayStatus, message)
 	case "sensorData":
 		switch message.DeviceType {
 		case "camera":
@@ -214,6 +308,9 @@ func (l *GatewayLogic) Process(message *entities.IotMessage) error {
 		case "sensor":
 			err = l.processSensorData(message)
 		}
+		l.publishSensorEvent(message)
+		// Apply automation rules
+		l.processRules(message)
 	case "preview":
 		// Store camera image preview in database
 		go tasks.NewStorePreviewTask(l.conn).Run(message)
@@ -222,11 +319,19 @@ func (l *GatewayLogic) Process(message *entities.IotMessage) error {
 	case "deviceState":
 		if message.DeviceType == "camera" {
 			err = l.processCameraState(message)
+			l.publishEvent(entities.EventCameraState, message)
 		}
 	case "cloudStreaming":
 		if message.DeviceType == "camera" {
 			// Update camera streaming state in MySQL database
 			go tasks.NewUpdateCameraStreamingStateTask(l.conn).Run(message)
+			l.publishEvent(entities.EventCameraStreaming, message)
+		}
+	case "localArchive":
+		if message.DeviceType == "camera" && len(message.UploadId) > 0 {
+			// Follow archive upload progress, index uploaded segments and
+			// publish progress of known upload
+			go tasks.NewUpdateArchiveUploadTask(l.conn, l.events, l.user().UserId).Run(message)
 		}
 	case "configurationData":
 		if message.DeviceType == "gateway" {
@@ -236,7 +341,42 @@ func (l *GatewayLogic) Process(message *entities.IotMessage) error {
 	return err
 }
 
+// reportShadow stores device state reported by gateway in device shadow
+func (l *GatewayLogic) reportShadow(message *entities.IotMessage) {
+	if l.Shadow == nil {
+		return
+	}
+	ts := shadow.ParseTimestamp(message.Timestamp)
+	switch message.MessageType {
+	case "sensorData":
+		l.Shadow.Report(message.DeviceId, message.DeviceType, message.GetLabel(), message.SensorData, ts)
+	case "deviceState":
+		l.Shadow.Report(message.DeviceId, message.DeviceType, "state", message.DeviceState, ts)
+	case "cloudStreaming":
+		l.Shadow.Report(message.DeviceId, message.DeviceType, "streaming", message.DeviceState, ts)
+	}
+}
+
+// publishSensorEvent sends sensor data or camera motion event to user webhooks
+func (l *GatewayLogic) publishSensorEvent(message *entities.IotMessage) {
+	switch {
+	case message.DeviceType == "camera" && message.Label == "motionDetector":
+		l.publishEvent(entities.EventCameraMotion, message)
+	case message.DeviceType == "sensor":
+		l.publishEvent(entities.EventSensorData, message)
+	}
+}
+
+// publishEvent sends platform event to gateway owner's webhooks
+func (l *GatewayLogic) publishEvent(eventType string, message *entities.IotMessage) {
+	userID := l.user().UserId
+	if l.events == nil || userID == 0 {
+		return
+	}
+	l.events.Publish(entities.NewEvent(eventType, userID, message))
+}
+
 // SetPush changes push flag for user params
 func (l *GatewayLogic) SetPush(state bool) {
-	l.UserParams.Push = state
+	l.updateUser(func(user *params.UserLogicParams) { user.Push = state })
 }
@@ -0,0 +1,16 @@
+package messages
+
+import "github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+
+// NewCommandMessage creates command message for gateway device
+func NewCommandMessage(gatewayID, deviceID, deviceType, protocol, command, attribute string) *entities.IotMessage {
+
+	message := entities.CreateCloudIotMessage(gatewayID, deviceID)
+	message.DeviceType = deviceType
+	message.Protocol = protocol
+	message.MessageType = "command"
+	message.Command = command
+	message.Attribute = attribute
+
+	return message
+}
@@ -1,6 +1,8 @@
 package params
 
 import (
+	"sync"
+
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
 )
 
@@ -13,22 +15,80 @@ const (
 	RecordingModeSchedule
 )
 
-// Parameters for cloud camera business logic
-type CameraLogicParams struct {
-	DeviceLogicParams
+// String returns recording mode name as it is stored in database
+func (m CloudCameraRecordingMode) String() string {
+	switch m {
+	case RecordingModeContinuous:
+		return "continuous"
+	case RecordingModeMotion:
+		return "motion"
+	case RecordingModeSchedule:
+		return "schedule"
+	}
+	return "none"
+}
+
+// CameraState holds camera params changed by gateway messages
+type CameraState struct {
 	RecordingMode        CloudCameraRecordingMode
-	Schedule             string
 	MediaserverParamsSet bool
 	MediaserverIp        string
 	ApplicationName      string
 	MotionInProcess      bool
 }
 
+// Parameters for cloud camera business logic.
+// State is read and changed under lock as REST requests read it
+// while gateway messages change it.
+type CameraLogicParams struct {
+	DeviceLogicParams
+	CameraState
+	Schedule string
+	mx       sync.RWMutex
+}
+
+// State returns copy of camera state
+func (p *CameraLogicParams) State() CameraState {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+	return p.CameraState
+}
+
 func (p *CameraLogicParams) SetRecordingMode(mode string) {
+	p.mx.Lock()
 	p.RecordingMode = p.ConvertRecordingMode(mode)
+	p.mx.Unlock()
+}
+
+// SetMotionInProcess keeps motion detector state
+func (p *CameraLogicParams) SetMotionInProcess(motion bool) {
+	p.mx.Lock()
+	p.MotionInProcess = motion
+	p.mx.Unlock()
+}
+
+// SetMediaserver keeps media server params of streaming camera
+func (p *CameraLogicParams) SetMediaserver(ip, applicationName string) {
+	p.mx.Lock()
+	p.MediaserverIp = ip
+	p.ApplicationName = applicationName
+	p.MediaserverParamsSet = true
+	p.mx.Unlock()
+}
+
+// ClearMediaserver forgets media server params of camera stopped streaming
+// and returns them
+func (p *CameraLogicParams) ClearMediaserver() (string, string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	ip, applicationName := p.MediaserverIp, p.ApplicationName
+	p.MediaserverIp = ""
+	p.ApplicationName = ""
+	p.MediaserverParamsSet = false
+	return ip, applicationName
 }
 
-func (p CameraLogicParams) ConvertRecordingMode(mode string) CloudCameraRecordingMode {
+func (p *CameraLogicParams) ConvertRecordingMode(mode string) CloudCameraRecordingMode {
 	var recordingMode CloudCameraRecordingMode
 	switch mode {
 	case "continuous":
@@ -37,19 +97,23 @@ func (p CameraLogicParams) ConvertRecordingMode(mode string) CloudCameraRecordin
 		recordingMode = RecordingModeMotion
 	case "schedule":
 		recordingMode = RecordingModeSchedule
+	case "off":
+		// Legacy clients turn recording off this way
+		recordingMode = RecordingModeNoRecord
 	}
 	return recordingMode
 }
 
-func (p CameraLogicParams) ToMessage(recording bool) *entities.IotMessage {
+func (p *CameraLogicParams) ToMessage(recording bool) *entities.IotMessage {
 	recMode := "off"
 	if recording {
 		recMode = "on"
 	}
+	state := p.State()
 
 	message := entities.CreateCloudIotMessage("", p.DeviceId)
-	message.MediaserverIp = p.MediaserverIp
-	message.ApplicationName = p.ApplicationName
+	message.MediaserverIp = state.MediaserverIp
+	message.ApplicationName = state.ApplicationName
 	message.Recording = recMode
 
 	return message
@@ -32,3 +32,12 @@ func (m *GuardedParamsMap) Remove(key string) {
 	delete(m.params, key)
 	m.mx.Unlock()
 }
+
+// Range calls function for each stored key and value under read lock
+func (m *GuardedParamsMap) Range(f func(key string, value interface{})) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	for key, value := range m.params {
+		f(key, value)
+	}
+}
@@ -1,15 +1,33 @@
 package params
 
 import (
+	"sync"
 	"time"
 )
 
+// Parameters of one sensor of device. Last value is read and changed
+// under lock as REST requests read it while gateway messages change it.
 type InnerParams struct {
 	Influx    bool
 	Notify    bool
 	Desc      string
-	Value     string
-	Timestamp time.Time
+	mx        sync.RWMutex
+	value     string
+	timestamp time.Time
+}
+
+// SetValue keeps last known sensor value
+func (p *InnerParams) SetValue(value string, timestamp time.Time) {
+	p.mx.Lock()
+	p.value, p.timestamp = value, timestamp
+	p.mx.Unlock()
+}
+
+// LastValue returns last known sensor value with its timestamp
+func (p *InnerParams) LastValue() (string, time.Time) {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+	return p.value, p.timestamp
 }
 
 // Parameters for sensor business logic
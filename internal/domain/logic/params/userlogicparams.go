@@ -1,7 +1,5 @@
 package params
 
-const UserTarifOnline = 1
-
 // Parameters for user business logic
 type UserLogicParams struct {
 	UserId      uint64 `db:"user_id"`
@@ -12,7 +10,3 @@ type UserLogicParams struct {
 	Blocked     bool   `db:"blocked"`
 	Push        bool   `db:"push"`
 }
-
-func (p *UserLogicParams) CanBeRecorded() bool {
-	return (p.TarifId > UserTarifOnline && p.Money > 0) || p.Vip || p.LegalEntity
-}
@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/messages"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/rules"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tasks"
+)
+
+// readShadowState returns device property value reported to device shadow
+func (l *GatewayLogic) readShadowState(deviceID, property string) (string, bool) {
+	if l.Shadow == nil {
+		return "", false
+	}
+	device, ok := l.Shadow.Get(deviceID)
+	if !ok {
+		return "", false
+	}
+	state, ok := device.Reported[property]
+	return state.Value, ok
+}
+
+// processRules executes rules triggered by gateway message
+func (l *GatewayLogic) processRules(message *entities.IotMessage) {
+	for _, rule := range l.Rules.MatchMessage(message, l.readShadowState, time.Now()) {
+		l.executeRule(rule, message)
+	}
+}
+
+// SetOffline ends metered camera usage and executes rules triggered by gateway disconnection
+func (l *GatewayLogic) SetOffline() {
+	l.endCameraUsage()
+	if l.user().Blocked {
+		return
+	}
+	message := messages.NewStatusMessage(l.gatewayId, "off")
+	l.publishEvent(entities.EventGatewayOffline, message)
+	for _, rule := range l.Rules.MatchOffline(l.readShadowState, time.Now()) {
+		l.executeRule(rule, message)
+	}
+}
+
+// Release ends metered camera usage of logic dropped while gateway stays online,
+// e.g. when gateway channel is recreated. New logic meters usage again
+// on next gateway messages.
+func (l *GatewayLogic) Release() {
+	l.endCameraUsage()
+}
+
+// runSchedule checks schedule rules every minute until logic context is cancelled
+func (l *GatewayLogic) runSchedule() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if l.user().Blocked {
+				continue
+			}
+			message := entities.CreateCloudIotMessage(l.gatewayId, "")
+			message.MessageType = "schedule"
+			for _, rule := range l.Rules.MatchSchedule(l.readShadowState, now) {
+				l.executeRule(rule, message)
+			}
+		}
+	}
+}
+
+// executeRule runs all rule actions
+func (l *GatewayLogic) executeRule(rule *rules.Rule, message *entities.IotMessage) {
+	logger.Debug("Automation rule fired", "rule", rule.ID, "title", rule.Title,
+		"gateway", l.gatewayId, "caller", "GatewayLogic")
+
+	for _, action := range rule.Actions {
+		switch action.Type {
+		case rules.ActionGatewayCommand:
+			l.executeCommandAction(&action)
+		case rules.ActionStartRecording, rules.ActionStopRecording:
+			l.executeRecordingAction(&action)
+		case rules.ActionPush:
+			l.executePushAction(rule, &action)
+		case rules.ActionWebhook:
+			l.executeWebhookAction(rule, &action, message)
+		}
+	}
+}
+
+func (l *GatewayLogic) executeCommandAction(action *rules.Action) {
+	if l.writer == nil {
+		logger.Error("no gateway writer to send command", "gateway", l.gatewayId, "caller", "GatewayLogic")
+		return
+	}
+
+	deviceType := action.DeviceType
+	if len(deviceType) == 0 {
+		deviceType = "sensor"
+	}
+	protocol := action.Protocol
+	if len(protocol) == 0 {
+		protocol = "zwave"
+	}
+	message := messages.NewCommandMessage(l.gatewayId, action.DeviceID, deviceType, protocol,
+		action.Command, action.Attribute)
+
+	// Keep desired state to resend command after gateway reconnection
+	if l.Shadow != nil {
+		l.Shadow.Desire(action.DeviceID, deviceType, action.Command, action.Attribute, message)
+	}
+
+	go tasks.NewSendGatewayMessageTask(l.writer).Run(message)
+}
+
+func (l *GatewayLogic) executeRecordingAction(action *rules.Action) {
+	cameraLogicParams, err := l.getCameraLogicParams(action.DeviceID)
+	if err != nil {
+		logger.Error("cannot execute recording action", "error", err,
+			"gateway", l.gatewayId, "caller", "GatewayLogic")
+		return
+	}
+	if !cameraLogicParams.State().MediaserverParamsSet {
+		logger.Warn("Camera is not streaming, recording action skipped",
+			"device", action.DeviceID, "gateway", l.gatewayId, "caller", "GatewayLogic")
+		return
+	}
+
+	recording := action.Type == rules.ActionStartRecording
+	if recording && !l.policy().Recording() {
+		return
+	}
+	go tasks.NewRecordMediaStreamTask(l.meter, l.user().UserId).Run(cameraLogicParams.ToMessage(recording))
+}
+
+// executeWebhookAction sends signed rule event to user webhook with
+// dispatcher retries and failures accounting
+func (l *GatewayLogic) executeWebhookAction(rule *rules.Rule, action *rules.Action, message *entities.IotMessage) {
+	if l.events == nil {
+		return
+	}
+	if action.WebhookID == 0 {
+		logger.Warn("Webhook action without webhookId skipped", "rule", rule.ID,
+			"gateway", l.gatewayId, "caller", "GatewayLogic")
+		return
+	}
+	event := entities.NewEvent(entities.EventRuleFired, rule.UserID, message)
+	event.RuleID = rule.ID
+	l.events.PublishTo(action.WebhookID, event)
+}
+
+func (l *GatewayLogic) executePushAction(rule *rules.Rule, action *rules.Action) {
+	if !l.policy().CanPush() {
+		return
+	}
+
+	// Search device for push notification data
+	var (
+		deviceType    string
+		deviceTableID uint64
+		userID        uint64
+		title         string
+	)
+	if p, err := l.getCameraLogicParams(action.DeviceID); err == nil {
+		deviceType, deviceTableID, userID, title = "camera", p.DeviceTableId, p.UserId, p.Title
+	} else if p, err := l.getSensorLogicParams(action.DeviceID); err == nil {
+		deviceType, deviceTableID, userID, title = "sensor", p.DeviceTableId, p.UserId, p.Title
+	} else {
+		logger.Error("no device for push action", "device", action.DeviceID,
+			"gateway", l.gatewayId, "caller", "GatewayLogic")
+		return
+	}
+
+	if len(action.Title) > 0 {
+		title = action.Title
+	}
+	content := action.Content
+	if len(content) == 0 {
+		content = rule.Title
+	}
+	pushMessage := messages.NewPushMessage(deviceType, title, content, deviceTableID, userID)
+	go tasks.NewSendPushNotificationTask(l.conn).Run(pushMessage)
+}
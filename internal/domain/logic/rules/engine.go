@@ -0,0 +1,233 @@
+package rules
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+)
+
+// Comparison operators for triggers and conditions
+const (
+	OperatorEq = "eq"
+	OperatorNe = "ne"
+	OperatorGt = "gt"
+	OperatorGe = "ge"
+	OperatorLt = "lt"
+	OperatorLe = "le"
+)
+
+// StateReader returns last known device property value
+type StateReader func(deviceID, property string) (string, bool)
+
+// Engine keeps enabled automation rules of one gateway
+type Engine struct {
+	mx        sync.RWMutex
+	gatewayID string
+	rules     []*Rule
+	fired     map[uint64]string // last schedule minute rule fired at
+}
+
+// NewEngine constructs Engine structure
+func NewEngine(gatewayID string) *Engine {
+	return &Engine{
+		mx:        sync.RWMutex{},
+		gatewayID: gatewayID,
+		rules:     make([]*Rule, 0),
+		fired:     make(map[uint64]string),
+	}
+}
+
+// Load reads enabled gateway rules from database
+func (e *Engine) Load(ctx context.Context, conn *database.Connection) error {
+	rules, err := ListRules(ctx, conn, 0, e.gatewayID)
+	if err != nil {
+		return err
+	}
+
+	enabled := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.location, err = rule.Location(); err != nil {
+			logger.Warn("Rule with wrong timezone skipped", "error", err,
+				"rule", rule.ID, "gateway", e.gatewayID, "caller", "Engine")
+			continue
+		}
+		enabled = append(enabled, rule)
+	}
+
+	e.mx.Lock()
+	e.rules = enabled
+	e.mx.Unlock()
+	return nil
+}
+
+// MatchMessage returns rules triggered by gateway message
+// which conditions are satisfied
+func (e *Engine) MatchMessage(message *entities.IotMessage, state StateReader, now time.Time) []*Rule {
+	return e.match(func(t *Trigger, _ time.Time) bool {
+		return matchMessageTrigger(t, message)
+	}, state, now)
+}
+
+// MatchOffline returns rules triggered by gateway disconnection
+func (e *Engine) MatchOffline(state StateReader, now time.Time) []*Rule {
+	return e.match(func(t *Trigger, _ time.Time) bool {
+		return t.Type == TriggerGatewayOffline
+	}, state, now)
+}
+
+// MatchSchedule returns schedule rules for current minute in rule timezone.
+// Every rule fires once per minute.
+func (e *Engine) MatchSchedule(state StateReader, now time.Time) []*Rule {
+	minute := now.UTC().Format("2006-01-02T15:04")
+	matched := e.match(matchScheduleTrigger, state, now)
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	out := make([]*Rule, 0, len(matched))
+	for _, rule := range matched {
+		if e.fired[rule.ID] == minute {
+			continue
+		}
+		e.fired[rule.ID] = minute
+		out = append(out, rule)
+	}
+	return out
+}
+
+// match returns rules which trigger and conditions are satisfied
+// at time of day in rule timezone
+func (e *Engine) match(trigger func(t *Trigger, now time.Time) bool, state StateReader, now time.Time) []*Rule {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+
+	matched := make([]*Rule, 0)
+	for _, rule := range e.rules {
+		local := rule.localTime(now)
+		if trigger(&rule.Trigger, local) && checkConditions(rule.Conditions, state, local) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+func matchMessageTrigger(t *Trigger, message *entities.IotMessage) bool {
+	if message.MessageType != "sensorData" || t.DeviceID != message.DeviceId {
+		return false
+	}
+	switch t.Type {
+	case TriggerSensorValue:
+		return t.Label == message.GetLabel() && compare(message.SensorData, t.Operator, t.Value)
+	case TriggerMotion:
+		return message.Label == "motionDetector" && message.SensorData == "on"
+	}
+	return false
+}
+
+func matchScheduleTrigger(t *Trigger, now time.Time) bool {
+	if t.Type != TriggerSchedule || now.Format("15:04") != t.Time {
+		return false
+	}
+	if len(t.Weekdays) == 0 {
+		return true
+	}
+	for _, day := range t.Weekdays {
+		if time.Weekday(day) == now.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func checkConditions(conditions []Condition, state StateReader, now time.Time) bool {
+	for _, cond := range conditions {
+		switch cond.Type {
+		case ConditionDeviceState:
+			if state == nil {
+				return false
+			}
+			value, ok := state(cond.DeviceID, cond.Property)
+			if !ok || !compare(value, cond.Operator, cond.Value) {
+				return false
+			}
+		case ConditionTimeRange:
+			if !inTimeRange(cond.From, cond.To, now) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// inTimeRange checks if time of day is in range, ranges through midnight are allowed
+func inTimeRange(from, to string, now time.Time) bool {
+	start, err := parseClock(from)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return false
+	}
+	current := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if start <= end {
+		return current >= start && current < end
+	}
+	return current >= start || current < end
+}
+
+func isValidOperator(operator string) bool {
+	switch operator {
+	case OperatorEq, OperatorNe, OperatorGt, OperatorGe, OperatorLt, OperatorLe:
+		return true
+	}
+	return false
+}
+
+// compare values numerically if both are numbers and as strings otherwise
+func compare(actual, operator, expected string) bool {
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(expected, 64)
+	if errA == nil && errB == nil {
+		switch operator {
+		case OperatorEq:
+			return a == b
+		case OperatorNe:
+			return a != b
+		case OperatorGt:
+			return a > b
+		case OperatorGe:
+			return a >= b
+		case OperatorLt:
+			return a < b
+		case OperatorLe:
+			return a <= b
+		}
+		return false
+	}
+
+	switch operator {
+	case OperatorEq:
+		return actual == expected
+	case OperatorNe:
+		return actual != expected
+	case OperatorGt:
+		return actual > expected
+	case OperatorGe:
+		return actual >= expected
+	case OperatorLt:
+		return actual < expected
+	case OperatorLe:
+		return actual <= expected
+	}
+	return false
+}
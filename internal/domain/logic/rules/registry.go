@@ -0,0 +1,47 @@
+package rules
+
+import "sync"
+
+// Registry keeps rule engines of gateways
+type Registry struct {
+	mx      sync.Mutex
+	engines map[string]*Engine
+}
+
+// NewRegistry constructs Registry structure
+func NewRegistry() *Registry {
+	return &Registry{
+		mx:      sync.Mutex{},
+		engines: make(map[string]*Engine),
+	}
+}
+
+// Get returns gateway rule engine creating it if needed
+func (r *Registry) Get(gatewayID string) *Engine {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	e, ok := r.engines[gatewayID]
+	if !ok {
+		e = NewEngine(gatewayID)
+		r.engines[gatewayID] = e
+	}
+	return e
+}
+
+// Find returns rule engine of gateway if it exists
+func (r *Registry) Find(gatewayID string) (*Engine, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	e, ok := r.engines[gatewayID]
+	return e, ok
+}
+
+// Remove deletes rule engine of disconnected gateway
+func (r *Registry) Remove(gatewayID string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	delete(r.engines, gatewayID)
+}
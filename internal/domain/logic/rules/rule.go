@@ -0,0 +1,201 @@
+package rules
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Trigger types
+const (
+	TriggerSensorValue    = "sensorValue"
+	TriggerMotion         = "motion"
+	TriggerGatewayOffline = "gatewayOffline"
+	TriggerSchedule       = "schedule"
+)
+
+// Condition types
+const (
+	ConditionDeviceState = "deviceState"
+	ConditionTimeRange   = "timeRange"
+)
+
+// Action types
+const (
+	ActionGatewayCommand = "gatewayCommand"
+	ActionStartRecording = "startRecording"
+	ActionStopRecording  = "stopRecording"
+	ActionPush           = "push"
+	ActionWebhook        = "webhook"
+)
+
+// Trigger defines event which starts rule evaluation
+type Trigger struct {
+	Type     string `json:"type"`
+	DeviceID string `json:"deviceId,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Time     string `json:"time,omitempty"`     // HH:MM for schedule trigger
+	Weekdays []int  `json:"weekdays,omitempty"` // 0 is Sunday, empty means every day
+}
+
+// Condition should be satisfied for rule actions to be executed
+type Condition struct {
+	Type     string `json:"type"`
+	DeviceID string `json:"deviceId,omitempty"`
+	Property string `json:"property,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+	From     string `json:"from,omitempty"` // HH:MM for time range condition
+	To       string `json:"to,omitempty"`
+}
+
+// Action executed when rule fires
+type Action struct {
+	Type       string `json:"type"`
+	DeviceID   string `json:"deviceId,omitempty"`
+	DeviceType string `json:"deviceType,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Command    string `json:"command,omitempty"`
+	Attribute  string `json:"attribute,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Content    string `json:"content,omitempty"`
+	WebhookID  uint64 `json:"webhookId,omitempty"` // user webhook subscription
+}
+
+// Definition holds rule logic stored in database as JSON.
+// Schedule triggers and time range conditions are evaluated in rule
+// timezone, UTC is used if timezone is empty.
+type Definition struct {
+	Timezone   string      `json:"timezone,omitempty"` // IANA name, e.g. Europe/Moscow
+	Trigger    Trigger     `json:"trigger"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Actions    []Action    `json:"actions"`
+}
+
+// Rule structure to represent automation rule of gateway devices
+type Rule struct {
+	ID        uint64 `json:"id"`
+	UserID    uint64 `json:"userId"`
+	GatewayID string `json:"gatewayId"`
+	Title     string `json:"title"`
+	Enabled   bool   `json:"enabled"`
+	Definition
+
+	location *time.Location // resolved timezone of loaded rule
+}
+
+// Validate checks rule for consistency
+func (r *Rule) Validate() error {
+	if r.UserID == 0 {
+		return errors.New("no user defined")
+	}
+	if len(r.GatewayID) == 0 {
+		return errors.New("no gateway defined")
+	}
+	if _, err := r.Location(); err != nil {
+		return errors.Wrap(err, "wrong timezone")
+	}
+
+	switch r.Trigger.Type {
+	case TriggerSensorValue:
+		if len(r.Trigger.DeviceID) == 0 || len(r.Trigger.Label) == 0 {
+			return errors.New("sensor value trigger requires deviceId and label")
+		}
+		if !isValidOperator(r.Trigger.Operator) {
+			return errors.New("wrong trigger operator: " + r.Trigger.Operator)
+		}
+	case TriggerMotion:
+		if len(r.Trigger.DeviceID) == 0 {
+			return errors.New("motion trigger requires deviceId")
+		}
+	case TriggerGatewayOffline:
+	case TriggerSchedule:
+		if _, err := parseClock(r.Trigger.Time); err != nil {
+			return errors.Wrap(err, "wrong schedule time")
+		}
+		for _, day := range r.Trigger.Weekdays {
+			if day < 0 || day > 6 {
+				return errors.New("wrong schedule weekday: " + strconv.Itoa(day))
+			}
+		}
+	default:
+		return errors.New("wrong trigger type: " + r.Trigger.Type)
+	}
+
+	for _, cond := range r.Conditions {
+		switch cond.Type {
+		case ConditionDeviceState:
+			if len(cond.DeviceID) == 0 || len(cond.Property) == 0 {
+				return errors.New("device state condition requires deviceId and property")
+			}
+			if !isValidOperator(cond.Operator) {
+				return errors.New("wrong condition operator: " + cond.Operator)
+			}
+		case ConditionTimeRange:
+			if _, err := parseClock(cond.From); err != nil {
+				return errors.Wrap(err, "wrong time range start")
+			}
+			if _, err := parseClock(cond.To); err != nil {
+				return errors.Wrap(err, "wrong time range end")
+			}
+		default:
+			return errors.New("wrong condition type: " + cond.Type)
+		}
+	}
+
+	if len(r.Actions) == 0 {
+		return errors.New("no actions defined")
+	}
+	for _, action := range r.Actions {
+		switch action.Type {
+		case ActionGatewayCommand:
+			if len(action.DeviceID) == 0 || len(action.Command) == 0 {
+				return errors.New("gateway command action requires deviceId and command")
+			}
+		case ActionStartRecording, ActionStopRecording:
+			if len(action.DeviceID) == 0 {
+				return errors.New("recording action requires deviceId")
+			}
+		case ActionPush:
+			if len(action.DeviceID) == 0 {
+				return errors.New("push action requires deviceId")
+			}
+		case ActionWebhook:
+			if action.WebhookID == 0 {
+				return errors.New("webhook action requires webhookId")
+			}
+		default:
+			return errors.New("wrong action type: " + action.Type)
+		}
+	}
+
+	return nil
+}
+
+// Location returns rule timezone, UTC if it is not defined
+func (r *Rule) Location() (*time.Location, error) {
+	if len(r.Timezone) == 0 {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.Timezone)
+}
+
+// localTime converts time to rule timezone
+func (r *Rule) localTime(now time.Time) time.Time {
+	if r.location == nil {
+		return now.UTC()
+	}
+	return now.In(r.location)
+}
+
+// parseClock converts HH:MM string to duration since midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,118 @@
+package rules
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// ListRules reads rules filtered by user and gateway. Zero or empty filter is skipped.
+func ListRules(ctx context.Context, conn *database.Connection, userID uint64, gatewayID string) ([]*Rule, error) {
+	queryText :=
+		`SELECT id, user_id, gateway_id, title, enabled, definition
+		FROM v3_rules
+		WHERE (? = 0 OR user_id = ?) AND (? = '' OR gateway_id = ?)
+		ORDER BY id;`
+	rows, err := conn.Db.QueryContext(ctx, queryText, userID, userID, gatewayID, gatewayID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query rules")
+	}
+	defer func() { _ = rows.Close() }()
+
+	rules := make([]*Rule, 0)
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed reading rules")
+	}
+	return rules, nil
+}
+
+// GetRule reads rule by its id. Returns nil if rule not found.
+func GetRule(ctx context.Context, conn *database.Connection, id uint64) (*Rule, error) {
+	queryText :=
+		`SELECT id, user_id, gateway_id, title, enabled, definition
+		FROM v3_rules
+		WHERE id = ?;`
+	rule, err := scanRule(conn.Db.QueryRowContext(ctx, queryText, id))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rule, err
+}
+
+// CreateRule stores new rule in database and sets its id
+func CreateRule(ctx context.Context, conn *database.Connection, rule *Rule) error {
+	definition, err := json.Marshal(rule.Definition)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling rule definition")
+	}
+
+	insertQueryText :=
+		`INSERT INTO v3_rules (user_id, gateway_id, title, enabled, definition, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, now(), now());`
+	result, err := conn.Db.ExecContext(ctx, insertQueryText,
+		rule.UserID, rule.GatewayID, rule.Title, rule.Enabled, string(definition))
+	if err != nil {
+		return errors.Wrap(err, "failed inserting rule")
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "failed getting rule id")
+	}
+	rule.ID = uint64(id)
+	return nil
+}
+
+// UpdateRule changes stored rule
+func UpdateRule(ctx context.Context, conn *database.Connection, rule *Rule) error {
+	definition, err := json.Marshal(rule.Definition)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling rule definition")
+	}
+
+	updateQueryText :=
+		`UPDATE v3_rules
+			SET gateway_id = ?, title = ?, enabled = ?, definition = ?, updated_at = now()
+			WHERE id = ?;`
+	_, err = conn.Db.ExecContext(ctx, updateQueryText,
+		rule.GatewayID, rule.Title, rule.Enabled, string(definition), rule.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed updating rule")
+	}
+	return nil
+}
+
+// DeleteRule removes rule from database
+func DeleteRule(ctx context.Context, conn *database.Connection, id uint64) error {
+	_, err := conn.Db.ExecContext(ctx, `DELETE FROM v3_rules WHERE id = ?;`, id)
+	if err != nil {
+		return errors.Wrap(err, "failed deleting rule")
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row rowScanner) (*Rule, error) {
+	rule := &Rule{}
+	var definition string
+	if err := row.Scan(&rule.ID, &rule.UserID, &rule.GatewayID,
+		&rule.Title, &rule.Enabled, &definition); err != nil {
+		return nil, errors.Wrap(err, "could not read rule record")
+	}
+	if err := json.Unmarshal([]byte(definition), &rule.Definition); err != nil {
+		return nil, errors.Wrap(err, "could not unmarshal rule definition")
+	}
+	return rule, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
 	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/messages"
 	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/shadow"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tasks"
 )
 
@@ -42,17 +43,20 @@ func (l *GatewayLogic) processSensorData(message *entities.IotMessage) error {
 		return errors.New("error casting interface to InnerParams")
 	}
 
+	// Keep last known sensor value
+	innerParams.SetValue(message.SensorData, shadow.ParseTimestamp(message.Timestamp))
+
 	// Store sensor data in MySQL
 	message.DeviceTableId = sensorLogicParams.DeviceTableId
 	go tasks.NewStoreSensorDataMySqlTask(l.conn).Run(message)
 
 	// Store sensor data in InfluxDB
 	if innerParams.Influx {
-		go tasks.NewStoreSensorDataInfluxTask().Run(message)
+		go tasks.NewStoreSensorDataInfluxTask(l.sink, l.meter, l.user().UserId).Run(message)
 	}
 
 	// Inform user about sensor event
-	if message.SensorData == "on" && innerParams.Notify && l.UserParams.Push {
+	if message.SensorData == "on" && innerParams.Notify && l.policy().CanPush() {
 		pushMessage := messages.NewPushMessage(
 			"sensor",
 			sensorLogicParams.Title,
@@ -0,0 +1,36 @@
+package logic
+
+import (
+	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/rules"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/shadow"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/tariffs"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/spf13/viper"
+)
+
+// Services keeps server-wide objects shared by business logic of all gateways
+type Services struct {
+	Conn    *database.Connection
+	Sink    interfaces.SensorSink
+	Events  interfaces.EventPublisher
+	Shadows *shadow.Registry
+	Rules   *rules.Registry
+	Tariffs *tariffs.Registry
+	// Meter is optional usage meter for billing
+	Meter interfaces.UsageMeter
+	// Trackers are optional and must be added before gateways are connected
+	Trackers []interfaces.MessageTracker
+}
+
+// NewServices constructs Services structure with empty registries
+func NewServices(conn *database.Connection, sink interfaces.SensorSink, events interfaces.EventPublisher) *Services {
+	return &Services{
+		Conn:    conn,
+		Sink:    sink,
+		Events:  events,
+		Shadows: shadow.NewRegistry(viper.GetDuration("shadow.ttl")),
+		Rules:   rules.NewRegistry(),
+		Tariffs: tariffs.NewRegistry(),
+	}
+}
@@ -0,0 +1,72 @@
+package shadow
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is time shadow of disconnected gateway is kept
+const DefaultTTL = 24 * time.Hour
+
+// Registry keeps gateway shadows between gateway reconnections.
+// Shadows of gateways disconnected longer than TTL are evicted.
+type Registry struct {
+	mx       sync.Mutex
+	ttl      time.Duration
+	shadows  map[string]*GatewayShadow
+	released map[string]time.Time
+}
+
+// NewRegistry constructs Registry structure
+func NewRegistry(ttl time.Duration) *Registry {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Registry{
+		mx:       sync.Mutex{},
+		ttl:      ttl,
+		shadows:  make(map[string]*GatewayShadow),
+		released: make(map[string]time.Time),
+	}
+}
+
+// Get returns shadow of connected gateway creating it if needed
+func (r *Registry) Get(gatewayID string) *GatewayShadow {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	s, ok := r.shadows[gatewayID]
+	if !ok {
+		s = NewGatewayShadow(gatewayID)
+		r.shadows[gatewayID] = s
+	}
+	delete(r.released, gatewayID)
+	return s
+}
+
+// Find returns gateway shadow if it exists
+func (r *Registry) Find(gatewayID string) (*GatewayShadow, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	s, ok := r.shadows[gatewayID]
+	return s, ok
+}
+
+// Release marks shadow of disconnected gateway to be evicted after TTL
+// and evicts shadows released before
+func (r *Registry) Release(gatewayID string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := time.Now()
+	if _, ok := r.shadows[gatewayID]; ok {
+		r.released[gatewayID] = now
+	}
+	for id, releasedAt := range r.released {
+		if now.Sub(releasedAt) > r.ttl {
+			delete(r.shadows, id)
+			delete(r.released, id)
+		}
+	}
+}
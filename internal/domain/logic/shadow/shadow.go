@@ -0,0 +1,189 @@
+package shadow
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+)
+
+// State holds property value with time it was set
+type State struct {
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DesiredState holds property value requested by command
+// and command message to be resent to gateway
+type DesiredState struct {
+	State
+	Command *entities.IotMessage `json:"-"`
+}
+
+// commandProperties maps gateway commands to device properties reported
+// when command is applied. Commands without reported property, e.g. PTZ
+// moves, are not kept as desired state.
+var commandProperties = map[string]string{
+	"switch": "state",
+}
+
+// CommandProperty returns device property changed by command
+func CommandProperty(command string) (string, bool) {
+	property, ok := commandProperties[command]
+	return property, ok
+}
+
+// DeviceShadow keeps last known device state reported by gateway
+// and state desired by user commands
+type DeviceShadow struct {
+	DeviceID   string                  `json:"deviceId"`
+	DeviceType string                  `json:"deviceType,omitempty"`
+	Reported   map[string]State        `json:"reported"`
+	Desired    map[string]DesiredState `json:"desired"`
+	UpdatedAt  time.Time               `json:"updatedAt"`
+}
+
+// GatewayShadow keeps device shadows for one gateway
+type GatewayShadow struct {
+	mx        sync.RWMutex
+	gatewayID string
+	devices   map[string]*DeviceShadow
+}
+
+// NewGatewayShadow constructs GatewayShadow structure
+func NewGatewayShadow(gatewayID string) *GatewayShadow {
+	return &GatewayShadow{
+		mx:        sync.RWMutex{},
+		gatewayID: gatewayID,
+		devices:   make(map[string]*DeviceShadow),
+	}
+}
+
+// getDevice returns device shadow creating it if needed. Must be called under lock.
+func (s *GatewayShadow) getDevice(deviceID, deviceType string) *DeviceShadow {
+	device, ok := s.devices[deviceID]
+	if !ok {
+		device = &DeviceShadow{
+			DeviceID: deviceID,
+			Reported: make(map[string]State),
+			Desired:  make(map[string]DesiredState),
+		}
+		s.devices[deviceID] = device
+	}
+	if len(deviceType) > 0 {
+		device.DeviceType = deviceType
+	}
+	return device
+}
+
+// Report stores property value reported by gateway
+func (s *GatewayShadow) Report(deviceID, deviceType, property, value string, ts time.Time) {
+	if len(deviceID) == 0 || len(property) == 0 {
+		return
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	device := s.getDevice(deviceID, deviceType)
+	device.Reported[property] = State{Value: value, Timestamp: ts}
+	device.UpdatedAt = ts
+
+	// Desired state is reached and command need not be resent
+	if desired, ok := device.Desired[property]; ok && desired.Value == value {
+		delete(device.Desired, property)
+	}
+}
+
+// Desire stores property value requested by command message. Commands
+// changing no reported property are skipped.
+func (s *GatewayShadow) Desire(deviceID, deviceType, command, value string, message *entities.IotMessage) {
+	property, ok := CommandProperty(command)
+	if len(deviceID) == 0 || !ok {
+		return
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	device := s.getDevice(deviceID, deviceType)
+	device.Desired[property] = DesiredState{
+		State:   State{Value: value, Timestamp: now},
+		Command: message,
+	}
+	device.UpdatedAt = now
+}
+
+// Get returns copy of device shadow
+func (s *GatewayShadow) Get(deviceID string) (DeviceShadow, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	device, ok := s.devices[deviceID]
+	if !ok {
+		return DeviceShadow{}, false
+	}
+	return device.copy(), true
+}
+
+// Devices returns copies of all gateway device shadows
+func (s *GatewayShadow) Devices() []DeviceShadow {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	devices := make([]DeviceShadow, 0, len(s.devices))
+	for _, device := range s.devices {
+		devices = append(devices, device.copy())
+	}
+	return devices
+}
+
+// Deltas returns commands for properties which desired value
+// differs from reported one
+func (s *GatewayShadow) Deltas() []*entities.IotMessage {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	commands := make([]*entities.IotMessage, 0)
+	for _, device := range s.devices {
+		for property, desired := range device.Desired {
+			if desired.Command == nil {
+				continue
+			}
+			if reported, ok := device.Reported[property]; ok && reported.Value == desired.Value {
+				continue
+			}
+
+			// Renew command timestamp before resending
+			command := *desired.Command
+			command.Timestamp = entities.CreateTimestampMs(time.Now().Local())
+			commands = append(commands, &command)
+		}
+	}
+	return commands
+}
+
+func (d *DeviceShadow) copy() DeviceShadow {
+	out := *d
+	out.Reported = make(map[string]State, len(d.Reported))
+	for k, v := range d.Reported {
+		out.Reported[k] = v
+	}
+	out.Desired = make(map[string]DesiredState, len(d.Desired))
+	for k, v := range d.Desired {
+		out.Desired[k] = v
+	}
+	return out
+}
+
+// ParseTimestamp converts message timestamp in milliseconds to time.
+// Returns current time for empty or wrong values.
+func ParseTimestamp(timestampMs string) time.Time {
+	ms, err := strconv.ParseInt(timestampMs, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Now()
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
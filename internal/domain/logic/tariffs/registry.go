@@ -0,0 +1,76 @@
+package tariffs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// Registry keeps tariffs loaded from database
+type Registry struct {
+	mx      sync.RWMutex
+	tariffs map[uint64]*Tariff
+}
+
+// NewRegistry constructs Registry structure
+func NewRegistry() *Registry {
+	return &Registry{
+		mx:      sync.RWMutex{},
+		tariffs: make(map[uint64]*Tariff),
+	}
+}
+
+// Load replaces tariffs with ones stored in database
+func (r *Registry) Load(ctx context.Context, conn *database.Connection) error {
+	queryText :=
+		`SELECT id, title, continuous_recording, motion_recording, schedule_recording,
+			retention_days, max_cameras, push_allowed, sensor_history_days, paid
+		FROM v3_tariffs;`
+	list := make([]*Tariff, 0)
+	if err := conn.Db.SelectContext(ctx, &list, queryText); err != nil {
+		return errors.Wrap(err, "failed to query tariffs")
+	}
+
+	tariffs := make(map[uint64]*Tariff, len(list))
+	for _, tariff := range list {
+		tariffs[tariff.ID] = tariff
+	}
+	r.mx.Lock()
+	r.tariffs = tariffs
+	r.mx.Unlock()
+	return nil
+}
+
+// Get returns tariff by its id. Tariff not defined in database
+// gets legacy features.
+func (r *Registry) Get(id uint64) *Tariff {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	if tariff, ok := r.tariffs[id]; ok {
+		return tariff
+	}
+	return legacyTariff(id)
+}
+
+// List returns tariffs loaded from database ordered by id
+func (r *Registry) List() []*Tariff {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	list := make([]*Tariff, 0, len(r.tariffs))
+	for _, tariff := range r.tariffs {
+		list = append(list, tariff)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Evaluate makes policy for user account
+func (r *Registry) Evaluate(user *params.UserLogicParams) Policy {
+	return Evaluate(r.Get(user.TarifId), user)
+}
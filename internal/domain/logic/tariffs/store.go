@@ -0,0 +1,44 @@
+package tariffs
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// LoadGatewayAccount reads account params of gateway owner
+func LoadGatewayAccount(ctx context.Context, conn *database.Connection, gatewayID string) (*params.UserLogicParams, error) {
+	queryText :=
+		`SELECT usr.id AS user_id, usr.tfid AS tarif_id, usr.amount AS money,
+			usr.vip, usr.isLegalEntity, usr.blocked, usr.push
+		FROM v3_gateways AS gw
+			INNER JOIN users AS usr
+				ON gw.user_id = usr.id
+		WHERE gw.gateway_id = ?;`
+	user := &params.UserLogicParams{}
+	if err := conn.Db.GetContext(ctx, user, queryText, gatewayID); err != nil {
+		return nil, errors.Wrap(err, "failed to query user params")
+	}
+	return user, nil
+}
+
+// LoadAccount reads user account params. Returns nil if user not found.
+func LoadAccount(ctx context.Context, conn *database.Connection, userID uint64) (*params.UserLogicParams, error) {
+	queryText :=
+		`SELECT usr.id AS user_id, usr.tfid AS tarif_id, usr.amount AS money,
+			usr.vip, usr.isLegalEntity, usr.blocked, usr.push
+		FROM users AS usr
+		WHERE usr.id = ?;`
+	user := &params.UserLogicParams{}
+	err := conn.Db.GetContext(ctx, user, queryText, userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query user params")
+	}
+	return user, nil
+}
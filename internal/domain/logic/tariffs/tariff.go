@@ -0,0 +1,112 @@
+package tariffs
+
+import "github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+
+// TariffOnline is tariff without cloud recording
+const TariffOnline = 1
+
+// Tariff structure to represent features of user tariff.
+// Zero limits mean no limit.
+type Tariff struct {
+	ID                  uint64 `json:"id" db:"id"`
+	Title               string `json:"title" db:"title"`
+	ContinuousRecording bool   `json:"continuousRecording" db:"continuous_recording"`
+	MotionRecording     bool   `json:"motionRecording" db:"motion_recording"`
+	ScheduleRecording   bool   `json:"scheduleRecording" db:"schedule_recording"`
+	RetentionDays       int    `json:"retentionDays" db:"retention_days"`
+	MaxCameras          int    `json:"maxCameras" db:"max_cameras"`
+	PushAllowed         bool   `json:"pushAllowed" db:"push_allowed"`
+	SensorHistoryDays   int    `json:"sensorHistoryDays" db:"sensor_history_days"`
+	// Paid tariff recording requires positive account balance
+	Paid bool `json:"paid" db:"paid"`
+}
+
+// legacyTariff describes tariff not defined in database as it was
+// hard-coded before: online tariff has no recording, others record
+// while account balance is positive
+func legacyTariff(id uint64) *Tariff {
+	if id <= TariffOnline {
+		return &Tariff{ID: id, Title: "Online", PushAllowed: true}
+	}
+	return &Tariff{
+		ID:                  id,
+		ContinuousRecording: true,
+		MotionRecording:     true,
+		ScheduleRecording:   true,
+		PushAllowed:         true,
+		Paid:                true,
+	}
+}
+
+// Policy makes feature decisions for user account with its tariff
+type Policy struct {
+	Tariff *Tariff
+	// Privileged accounts, VIP and legal entities, record on any tariff
+	Privileged bool
+	// Funded is false for paid tariff with empty balance
+	Funded bool
+	// PushEnabled is user setting of push notifications
+	PushEnabled bool
+}
+
+// Evaluate makes policy for user account with tariff
+func Evaluate(tariff *Tariff, user *params.UserLogicParams) Policy {
+	if tariff == nil {
+		tariff = legacyTariff(user.TarifId)
+	}
+	return Policy{
+		Tariff:      tariff,
+		Privileged:  user.Vip || user.LegalEntity,
+		Funded:      !tariff.Paid || user.Money > 0,
+		PushEnabled: user.Push,
+	}
+}
+
+// CanRecord checks that camera stream may be recorded in cloud with recording mode
+func (p Policy) CanRecord(mode params.CloudCameraRecordingMode) bool {
+	if mode == params.RecordingModeNoRecord {
+		return false
+	}
+	if p.Privileged {
+		return true
+	}
+	if !p.Funded {
+		return false
+	}
+	switch mode {
+	case params.RecordingModeContinuous:
+		return p.Tariff.ContinuousRecording
+	case params.RecordingModeMotion:
+		return p.Tariff.MotionRecording
+	case params.RecordingModeSchedule:
+		return p.Tariff.ScheduleRecording
+	}
+	return false
+}
+
+// Recording checks that camera stream may be recorded in cloud with any recording mode
+func (p Policy) Recording() bool {
+	return p.CanRecord(params.RecordingModeContinuous) ||
+		p.CanRecord(params.RecordingModeMotion) ||
+		p.CanRecord(params.RecordingModeSchedule)
+}
+
+// CanPush checks that push notifications are enabled by user and allowed by tariff
+func (p Policy) CanPush() bool {
+	return p.PushEnabled && p.Tariff.PushAllowed
+}
+
+// CamerasAllowed checks that number of enabled cameras fits tariff
+func (p Policy) CamerasAllowed(cameras int) bool {
+	return p.Privileged || p.Tariff.MaxCameras == 0 || cameras <= p.Tariff.MaxCameras
+}
+
+// RetentionDays returns depth of recorded video available to user, zero means no limit
+func (p Policy) RetentionDays() int {
+	return p.Tariff.RetentionDays
+}
+
+// SensorHistoryDays returns depth of sensor history available to user, zero means no limit
+func (p Policy) SensorHistoryDays() int {
+	return p.Tariff.SensorHistoryDays
+}
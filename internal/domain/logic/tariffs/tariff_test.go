@@ -0,0 +1,101 @@
+package tariffs
+
+import (
+	"testing"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+)
+
+func TestEvaluateLegacyTariffs(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      params.UserLogicParams
+		recording bool
+		push      bool
+	}{
+		{
+			name: "online tariff does not record",
+			user: params.UserLogicParams{TarifId: TariffOnline, Money: 100, Push: true},
+			push: true,
+		},
+		{
+			name: "tariff not set does not record",
+			user: params.UserLogicParams{Money: 100},
+		},
+		{
+			name:      "paid tariff with positive balance records",
+			user:      params.UserLogicParams{TarifId: 2, Money: 1},
+			recording: true,
+		},
+		{
+			name: "paid tariff with empty balance does not record",
+			user: params.UserLogicParams{TarifId: 2, Push: true},
+			push: true,
+		},
+		{
+			name:      "VIP records on online tariff",
+			user:      params.UserLogicParams{TarifId: TariffOnline, Vip: true},
+			recording: true,
+		},
+		{
+			name:      "VIP records with empty balance",
+			user:      params.UserLogicParams{TarifId: 2, Vip: true},
+			recording: true,
+		},
+		{
+			name:      "legal entity records on online tariff",
+			user:      params.UserLogicParams{TarifId: TariffOnline, LegalEntity: true},
+			recording: true,
+		},
+		{
+			name:      "legal entity records with empty balance",
+			user:      params.UserLogicParams{TarifId: 3, LegalEntity: true},
+			recording: true,
+		},
+	}
+	modes := []params.CloudCameraRecordingMode{
+		params.RecordingModeContinuous,
+		params.RecordingModeMotion,
+		params.RecordingModeSchedule,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewRegistry().Evaluate(&tt.user)
+			for _, mode := range modes {
+				if got := policy.CanRecord(mode); got != tt.recording {
+					t.Errorf("CanRecord(%s) = %v, want %v", mode, got, tt.recording)
+				}
+			}
+			if got := policy.Recording(); got != tt.recording {
+				t.Errorf("Recording() = %v, want %v", got, tt.recording)
+			}
+			if policy.CanRecord(params.RecordingModeNoRecord) {
+				t.Error("CanRecord(none) = true, want false")
+			}
+			if got := policy.CanPush(); got != tt.push {
+				t.Errorf("CanPush() = %v, want %v", got, tt.push)
+			}
+		})
+	}
+}
+
+func TestEvaluateDatabaseTariff(t *testing.T) {
+	r := NewRegistry()
+	r.tariffs[5] = &Tariff{ID: 5, MotionRecording: true, MaxCameras: 2}
+
+	policy := r.Evaluate(&params.UserLogicParams{TarifId: 5})
+	if !policy.CanRecord(params.RecordingModeMotion) {
+		t.Error("free tariff does not record motion with empty balance")
+	}
+	if policy.CanRecord(params.RecordingModeContinuous) {
+		t.Error("tariff without continuous recording records continuously")
+	}
+	if !policy.CamerasAllowed(2) || policy.CamerasAllowed(3) {
+		t.Error("cameras limit of tariff is not applied")
+	}
+
+	vip := r.Evaluate(&params.UserLogicParams{TarifId: 5, Vip: true})
+	if !vip.CanRecord(params.RecordingModeContinuous) || !vip.CamerasAllowed(3) {
+		t.Error("VIP is limited by tariff")
+	}
+}
@@ -0,0 +1,196 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// Upload statuses. Requested upload is accepted by gateway but not started yet.
+const (
+	UploadRequested = "requested"
+	UploadUploading = "uploading"
+	UploadCompleted = "completed"
+	UploadFailed    = "failed"
+)
+
+// Upload structure to represent upload of camera local archive time range to cloud storage.
+// Range start and end are UNIX time in milliseconds.
+type Upload struct {
+	ID         string `json:"id" db:"id"`
+	DeviceID   string `json:"deviceId" db:"device_id"`
+	GatewayID  string `json:"gatewayId" db:"gateway_id"`
+	UserID     uint64 `json:"userId" db:"user_id"`
+	RangeStart int64  `json:"rangeStart" db:"range_start"`
+	RangeEnd   int64  `json:"rangeEnd" db:"range_end"`
+	Status     string `json:"status" db:"status"`
+	Progress   int    `json:"progress" db:"progress"`
+	Segments   int    `json:"segments" db:"segments"`
+	Error      string `json:"error,omitempty" db:"error"`
+	CreatedAt  string `json:"createdAt" db:"created_at"`
+	UpdatedAt  string `json:"updatedAt" db:"updated_at"`
+}
+
+// Segment structure to represent uploaded archive segment available for playback.
+// Expiration time is set when URL is signed.
+type Segment struct {
+	UploadID  string     `json:"uploadId" db:"upload_id"`
+	DeviceID  string     `json:"deviceId" db:"device_id"`
+	Start     int64      `json:"start" db:"start_ms"`
+	End       int64      `json:"end" db:"end_ms"`
+	Size      int64      `json:"size" db:"size"`
+	URL       string     `json:"url" db:"url"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" db:"-"`
+}
+
+// IsFinished checks that upload status can not be changed any more
+func IsFinished(status string) bool {
+	return status == UploadCompleted || status == UploadFailed
+}
+
+// CreateUpload stores requested upload
+func CreateUpload(ctx context.Context, conn *database.Connection, upload *Upload) error {
+	queryText :=
+		`INSERT INTO v3_archive_uploads
+			(id, device_id, gateway_id, user_id, range_start, range_end, status, progress, segments, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, 0, '', now(), now());`
+	if _, err := conn.Db.ExecContext(ctx, queryText, upload.ID, upload.DeviceID, upload.GatewayID,
+		upload.UserID, upload.RangeStart, upload.RangeEnd, UploadRequested); err != nil {
+		return errors.Wrap(err, "failed to insert archive upload")
+	}
+	upload.Status = UploadRequested
+	return nil
+}
+
+// GetUpload reads upload by its id. Returns nil if upload not found.
+func GetUpload(ctx context.Context, conn *database.Connection, id string) (*Upload, error) {
+	queryText :=
+		`SELECT id, device_id, gateway_id, user_id, range_start, range_end, status, progress, segments, error,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at,
+			DATE_FORMAT(updated_at, '%Y-%m-%dT%H:%i:%s') AS updated_at
+		FROM v3_archive_uploads
+		WHERE id = ?;`
+	upload := &Upload{}
+	err := conn.Db.GetContext(ctx, upload, queryText, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query archive upload")
+	}
+	return upload, nil
+}
+
+// ListUploads reads last uploads of camera archive
+func ListUploads(ctx context.Context, conn *database.Connection, deviceID string, limit int) ([]*Upload, error) {
+	queryText :=
+		`SELECT id, device_id, gateway_id, user_id, range_start, range_end, status, progress, segments, error,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at,
+			DATE_FORMAT(updated_at, '%Y-%m-%dT%H:%i:%s') AS updated_at
+		FROM v3_archive_uploads
+		WHERE device_id = ?
+		ORDER BY created_at DESC
+		LIMIT ?;`
+	uploads := make([]*Upload, 0)
+	if err := conn.Db.SelectContext(ctx, &uploads, queryText, deviceID, limit); err != nil {
+		return nil, errors.Wrap(err, "failed to query archive uploads")
+	}
+	return uploads, nil
+}
+
+// UpdateUpload changes status and progress of upload not finished yet
+func UpdateUpload(ctx context.Context, conn *database.Connection, id, status string, progress int, reason string) error {
+	queryText :=
+		`UPDATE v3_archive_uploads
+		SET status = ?, progress = ?, error = ?, updated_at = now()
+		WHERE id = ? AND status NOT IN (?, ?);`
+	if _, err := conn.Db.ExecContext(ctx, queryText, status, progress, reason, id,
+		UploadCompleted, UploadFailed); err != nil {
+		return errors.Wrap(err, "failed to update archive upload")
+	}
+	return nil
+}
+
+// UploadURL returns address gateway uploads archive segments of upload to
+func UploadURL(baseURL string, upload *Upload) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimRight(baseURL, "/"), upload.DeviceID, upload.ID)
+}
+
+// AddSegments indexes uploaded segments for playback. Segments without URL
+// under upload address, e.g. pointing to other camera archive, or outside
+// of upload time range are skipped, segments crossing range bounds are
+// clamped to them. Returns number of indexed segments.
+func AddSegments(ctx context.Context, conn *database.Connection, upload *Upload, baseURL string,
+	segments []entities.ArchiveSegment) (int, error) {
+	if len(baseURL) == 0 {
+		return 0, errors.New("cloud archive storage is not configured")
+	}
+	prefix := UploadURL(baseURL, upload) + "/"
+
+	queryText :=
+		`INSERT INTO v3_archive_segments (upload_id, device_id, start_ms, end_ms, size, url, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, now())
+		ON DUPLICATE KEY UPDATE end_ms = VALUES(end_ms), size = VALUES(size), url = VALUES(url);`
+	var added int
+	for _, segment := range segments {
+		if !strings.HasPrefix(segment.URL, prefix) || len(segment.URL) == len(prefix) {
+			continue
+		}
+		start, err := strconv.ParseInt(segment.Start, 10, 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseInt(segment.End, 10, 64)
+		if err != nil {
+			continue
+		}
+		if start < upload.RangeStart {
+			start = upload.RangeStart
+		}
+		if end > upload.RangeEnd {
+			end = upload.RangeEnd
+		}
+		if end <= start {
+			continue
+		}
+		if _, err := conn.Db.ExecContext(ctx, queryText, upload.ID, upload.DeviceID,
+			start, end, segment.Size, segment.URL); err != nil {
+			return added, errors.Wrap(err, "failed to insert archive segment")
+		}
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	countQueryText :=
+		`UPDATE v3_archive_uploads
+		SET segments = (SELECT count(*) FROM v3_archive_segments WHERE upload_id = ?)
+		WHERE id = ?;`
+	if _, err := conn.Db.ExecContext(ctx, countQueryText, upload.ID, upload.ID); err != nil {
+		return added, errors.Wrap(err, "failed to count archive segments")
+	}
+	return added, nil
+}
+
+// ListSegments reads uploaded camera archive segments overlapping time range
+func ListSegments(ctx context.Context, conn *database.Connection, deviceID string, start, end int64, limit int) ([]*Segment, error) {
+	queryText :=
+		`SELECT upload_id, device_id, start_ms, end_ms, size, url
+		FROM v3_archive_segments
+		WHERE device_id = ? AND start_ms < ? AND end_ms > ?
+		ORDER BY start_ms
+		LIMIT ?;`
+	segments := make([]*Segment, 0)
+	if err := conn.Db.SelectContext(ctx, &segments, queryText, deviceID, end, start, limit); err != nil {
+		return nil, errors.Wrap(err, "failed to query archive segments")
+	}
+	return segments, nil
+}
@@ -0,0 +1,214 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/params"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/tariffs"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/streadway/amqp"
+)
+
+// ErrAccountNotFound is returned for account event of unknown user
+var ErrAccountNotFound = errors.New("user account not found")
+
+// AccountEventsInit declares fanout exchange for account events. Every server
+// applies events to gateways it holds, and only one of servers consuming shared
+// queue notifies user.
+func (m *Manager) AccountEventsInit(exchange string) error {
+	// Check if connection established
+	if m.Conn == nil || m.Ch == nil {
+		return errors.New("no connection to RabbitMQ broker")
+	}
+
+	err := m.Ch.ExchangeDeclare(
+		exchange, // name
+		"fanout", // type
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to declare account events exchange")
+	}
+
+	// Server queue is deleted with connection, shared one keeps events
+	// while all servers are down
+	applyEvents, err := m.consumeAccountQueue(exchange, m.ServerID+".accounts", false)
+	if err != nil {
+		return err
+	}
+	notifyEvents, err := m.consumeAccountQueue(exchange, exchange+".notify", true)
+	if err != nil {
+		return err
+	}
+	m.accExch = exchange
+
+	go m.processAccountEvents(applyEvents, m.applyAccountEvent)
+	go m.processAccountEvents(notifyEvents, m.notifyAccountEvent)
+
+	logger.Info("Account events consumer started", "exchange", exchange)
+	return nil
+}
+
+// consumeAccountQueue declares queue bound to account events exchange
+// and registers its consumer
+func (m *Manager) consumeAccountQueue(exchange, name string, shared bool) (<-chan amqp.Delivery, error) {
+	queue, err := m.Ch.QueueDeclare(
+		name,    // name
+		shared,  // durable
+		false,   // delete when unused
+		!shared, // exclusive
+		false,   // no-wait
+		nil,     // arguments
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to declare account events queue")
+	}
+	if err = m.Ch.QueueBind(queue.Name, "", exchange, false, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to bind account events queue")
+	}
+	deliveries, err := m.Ch.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		true,       // auto ack
+		false,      // exclusive
+		false,      // no local
+		false,      // no wait
+		nil,        // args
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to register account events consumer")
+	}
+	return deliveries, nil
+}
+
+// processAccountEvents handles account events until delivery channel is closed
+func (m *Manager) processAccountEvents(deliveries <-chan amqp.Delivery,
+	handle func(event *entities.AccountEvent) error) {
+	for delivery := range deliveries {
+		event := &entities.AccountEvent{}
+		if err := json.Unmarshal(delivery.Body, event); err != nil {
+			logger.Error("error unmarshalling account event", "error", err, "caller", "Manager")
+			continue
+		}
+		if !entities.IsValidAccountEventType(event.Type) || event.UserID == 0 {
+			logger.Error("wrong account event", "type", event.Type, "user", event.UserID, "caller", "Manager")
+			continue
+		}
+		if err := handle(event); err != nil {
+			logger.Error("error handling account event", "error", err,
+				"type", event.Type, "user", event.UserID, "caller", "Manager")
+		}
+	}
+}
+
+// DispatchAccountEvent delivers account event to all servers through exchange
+// or handles it by this server if account events exchange is not used
+func (m *Manager) DispatchAccountEvent(event *entities.AccountEvent) error {
+	if len(m.accExch) == 0 {
+		if err := m.applyAccountEvent(event); err != nil {
+			return err
+		}
+		return m.notifyAccountEvent(event)
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling account event")
+	}
+	err = m.Ch.Publish(
+		m.accExch, // exchange
+		"",        // routing key
+		false,     // mandatory
+		false,     // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         body,
+		})
+	return errors.Wrap(err, "failed to publish account event")
+}
+
+// ApplyAccountEvent updates account params in business logic of user gateways
+// held by this server. Returns number of updated gateways.
+func (m *Manager) ApplyAccountEvent(event *entities.AccountEvent) (int, error) {
+	user, err := m.loadAccount(event)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int
+	for _, ch := range m.gwChans.GetChannels() {
+		gwChan, ok := ch.(*GatewayChannel)
+		if !ok || gwChan == nil {
+			continue
+		}
+		bl, ok := gwChan.GetLogic().(*logic.GatewayLogic)
+		if !ok || bl == nil || bl.OwnerID() != event.UserID {
+			continue
+		}
+		bl.UpdateAccount(*user)
+		updated++
+	}
+	return updated, nil
+}
+
+// applyAccountEvent applies account event with logging updated gateways
+func (m *Manager) applyAccountEvent(event *entities.AccountEvent) error {
+	updated, err := m.ApplyAccountEvent(event)
+	if err != nil {
+		return err
+	}
+	logger.Info("Account event applied", "type", event.Type, "user", event.UserID,
+		"gateways", updated, "caller", "Manager")
+	return nil
+}
+
+// notifyAccountEvent informs user about account event
+func (m *Manager) notifyAccountEvent(event *entities.AccountEvent) error {
+	user, err := m.loadAccount(event)
+	if err != nil {
+		return err
+	}
+	logic.NotifyAccountEvent(m.services, user, event)
+	return nil
+}
+
+// loadAccount reads account params from database and overrides them
+// with ones carried by event as billing may be ahead of database
+func (m *Manager) loadAccount(event *entities.AccountEvent) (*params.UserLogicParams, error) {
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	user, err := tariffs.LoadAccount(ctx, m.services.Conn, event.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrAccountNotFound
+	}
+
+	if event.Money != nil {
+		user.Money = *event.Money
+	}
+	if event.TariffID != nil {
+		user.TarifId = *event.TariffID
+	}
+	switch event.Type {
+	case entities.AccountBlocked:
+		user.Blocked = true
+	case entities.AccountUnblocked:
+		user.Blocked = false
+	}
+	return user, nil
+}
@@ -5,10 +5,19 @@ import (
 	"github.com/google/uuid"
 )
 
+// SignatureHeader is AMQP header or MQTT user property holding message HMAC
+const SignatureHeader = "signature"
+
+// TimestampHeader is AMQP header or MQTT user property holding signed
+// message timestamp in Unix seconds
+const TimestampHeader = "timestamp"
+
 // AmqpMetadata holds extra data for AMQP message
 type AmqpMetadata struct {
 	CorrelationID string
 	ReplyTo       string
+	Signature     string
+	Timestamp     string
 }
 
 // CreateCorrelationID returns correlation UUID
@@ -20,4 +29,5 @@ func CreateCorrelationID() string {
 type AmqpEnvelope struct {
 	Message  *entities.IotMessage
 	Metadata *AmqpMetadata
+	Body     []byte
 }
@@ -110,6 +110,13 @@ func (r *AmqpReader) ReadEnvelope() (env *AmqpEnvelope, close bool, err error) {
 					CorrelationID: message.CorrelationId,
 					ReplyTo:       "",
 				},
+				Body: buffer,
+			}
+			if signature, ok := message.Headers[SignatureHeader].(string); ok {
+				env.Metadata.Signature = signature
+			}
+			if timestamp, ok := message.Headers[TimestampHeader].(string); ok {
+				env.Metadata.Timestamp = timestamp
 			}
 		}
 	}
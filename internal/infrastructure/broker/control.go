@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+)
+
+// ErrGatewayNotConnected is returned when server holds no channel for gateway
+var ErrGatewayNotConnected = errors.New("gateway is not connected")
+
+// RestartGateway sends restart command to gateway. Gateways without channel
+// are reached through their AMQP input queue.
+func (m *Manager) RestartGateway(gatewayID string) error {
+	gwChan, _ := m.gwChans.Get(gatewayID).(*GatewayChannel)
+
+	// Create restart message
+	message := entities.CreateCloudIotMessage(gatewayID, "")
+	message.Protocol = "amqp"
+	message.MessageType = "command"
+	message.Command = "restart"
+	if gwChan != nil {
+		message.Protocol = gwChan.transport
+	}
+
+	// Marshal message to JSON
+	buffer, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "failed marshalling message to JSON")
+	}
+
+	// Send message through gateway channel if it exists
+	if gwChan != nil {
+		return writeMessage(gwChan, buffer)
+	}
+	if m.Conn == nil {
+		return ErrGatewayNotConnected
+	}
+
+	// Send JSON to RabbitMQ broker
+	wr := NewAmqpWriter(m.Conn, gatewayID)
+	if wr == nil {
+		return errors.New("failed opening gateway input queue")
+	}
+	err = writeMessage(wr, buffer)
+	if closeErr := wr.Close(); closeErr != nil {
+		logger.Error("error closing gateway input channel",
+			"error", closeErr, "caller", "RestartGateway")
+	}
+	return err
+}
+
+// ReconnectGateway force-closes gateway channel and creates new one
+// over the same transport. Gateway statuses in database are kept.
+func (m *Manager) ReconnectGateway(gatewayID string) error {
+	gwChan, ok := m.gwChans.Get(gatewayID).(*GatewayChannel)
+	if !ok || gwChan == nil {
+		return ErrGatewayNotConnected
+	}
+
+	// Old channel must be closed before new one subscribes to gateway messages.
+	// Its logic ends metered camera usage, so intervals are not left open.
+	transport := gwChan.transport
+	gwChan.Detach()
+	m.gwChans.Remove(gatewayID)
+
+	switch transport {
+	case "amqp":
+		ch := NewGatewayChannel(m.Conn, m.services, m.auth, m.ServerID, gatewayID)
+		if ch == nil {
+			return errors.New("failed creating AMQP gateway channel")
+		}
+		ch.Start()
+		m.addGatewayChannel(gatewayID, ch)
+	case "mqtt":
+		if m.mqtt == nil {
+			return errors.New("MQTT client is not initialized")
+		}
+		m.connectMqttGateway(gatewayID)
+	default:
+		// Virtual channel is created on next ingested message
+	}
+	logger.Info("Gateway channel recreated", "gateway", gatewayID, "transport", transport)
+	return nil
+}
+
+// ReloadGatewayLogic reloads business logic params and automation rules of gateway
+func (m *Manager) ReloadGatewayLogic(ctx context.Context, gatewayID string) error {
+	gwChan, ok := m.gwChans.Get(gatewayID).(*GatewayChannel)
+	if !ok || gwChan == nil {
+		return ErrGatewayNotConnected
+	}
+	if err := gwChan.ReloadLogic(); err != nil {
+		return err
+	}
+	return m.ReloadRules(ctx, gatewayID)
+}
+
+// writeMessage writes whole buffer to gateway channel
+func writeMessage(w io.Writer, buffer []byte) error {
+	n, err := w.Write(buffer)
+	if err != nil {
+		return errors.Wrap(err, "error sending message to gateway")
+	}
+	if n != len(buffer) {
+		return errors.New("message is partially sent to gateway")
+	}
+	return nil
+}
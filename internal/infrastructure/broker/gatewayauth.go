@@ -0,0 +1,199 @@
+package broker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Gateway message authentication modes
+const (
+	// GatewayAuthNone skips signature checks
+	GatewayAuthNone = "none"
+	// GatewayAuthAudit accepts all messages but audits wrong signatures
+	GatewayAuthAudit = "audit"
+	// GatewayAuthEnforce rejects unsigned messages and wrong signatures
+	GatewayAuthEnforce = "enforce"
+)
+
+// Rejection reasons written to audit log
+const (
+	rejectGatewayMismatch  = "gatewayIdMismatch"
+	rejectMissingSignature = "missingSignature"
+	rejectWrongSignature   = "wrongSignature"
+	rejectNoSecret         = "noSecret"
+	rejectMissingTimestamp = "missingTimestamp"
+	rejectStaleMessage     = "staleMessage"
+)
+
+// Defaults for gateway authenticator params
+const (
+	defaultSecretTTL = time.Minute
+	defaultMaxAge    = 5 * time.Minute
+)
+
+// errGatewayAuth holds rejection reason of gateway message
+type errGatewayAuth struct {
+	reason string
+}
+
+func (e *errGatewayAuth) Error() string {
+	return "gateway message rejected: " + e.reason
+}
+
+// cachedSecret is gateway secret read from database
+type cachedSecret struct {
+	secret  string
+	expires time.Time
+}
+
+// GatewayAuth verifies HMAC signatures of gateway messages with per-gateway secrets.
+// Gateways sign message timestamp with body, so messages older than max age
+// can not be replayed. Secrets are cached for TTL, so secret rotated on other
+// server is applied after TTL at most.
+type GatewayAuth struct {
+	mode      string
+	conn      *database.Connection
+	secretTTL time.Duration
+	maxAge    time.Duration
+	mx        sync.Mutex
+	secrets   map[string]cachedSecret
+}
+
+// NewGatewayAuth constructs GatewayAuth structure
+func NewGatewayAuth(conn *database.Connection, mode string, secretTTL, maxAge time.Duration) *GatewayAuth {
+	switch mode {
+	case GatewayAuthNone, GatewayAuthAudit, GatewayAuthEnforce:
+	default:
+		mode = GatewayAuthNone
+	}
+	if secretTTL <= 0 {
+		secretTTL = defaultSecretTTL
+	}
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+	return &GatewayAuth{
+		mode:      mode,
+		conn:      conn,
+		secretTTL: secretTTL,
+		maxAge:    maxAge,
+		mx:        sync.Mutex{},
+		secrets:   make(map[string]cachedSecret),
+	}
+}
+
+// Verify checks that message belongs to gateway channel and is signed with gateway secret.
+// Returns flag telling if message should be dropped and rejection error to be audited
+func (a *GatewayAuth) Verify(gatewayID string, env *AmqpEnvelope) (drop bool, err error) {
+	// Message can not claim other gateway identity whatever mode is set
+	if len(env.Message.GatewayId) == 0 {
+		env.Message.GatewayId = gatewayID
+	}
+	if env.Message.GatewayId != gatewayID {
+		return true, &errGatewayAuth{reason: rejectGatewayMismatch}
+	}
+	if a == nil || a.mode == GatewayAuthNone {
+		return false, nil
+	}
+
+	enforce := a.mode == GatewayAuthEnforce
+	if len(env.Metadata.Signature) == 0 {
+		if enforce {
+			return true, &errGatewayAuth{reason: rejectMissingSignature}
+		}
+		return false, nil
+	}
+
+	// Signed timestamp should be fresh to prevent message replays
+	timestamp := env.Metadata.Timestamp
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return enforce, &errGatewayAuth{reason: rejectMissingTimestamp}
+	}
+	if age := time.Since(time.Unix(sent, 0)); age > a.maxAge || age < -a.maxAge {
+		return enforce, &errGatewayAuth{reason: rejectStaleMessage}
+	}
+
+	secret, err := a.getSecret(gatewayID)
+	if err != nil {
+		return enforce, err
+	}
+	if len(secret) == 0 {
+		return enforce, &errGatewayAuth{reason: rejectNoSecret}
+	}
+	if !CheckSignature(secret, timestamp, env.Body, env.Metadata.Signature) {
+		return enforce, &errGatewayAuth{reason: rejectWrongSignature}
+	}
+	return false, nil
+}
+
+// Invalidate drops cached gateway secret after it was rotated.
+// Other servers re-read secret when their cache expires.
+func (a *GatewayAuth) Invalidate(gatewayID string) {
+	if a == nil {
+		return
+	}
+	a.mx.Lock()
+	delete(a.secrets, gatewayID)
+	a.mx.Unlock()
+}
+
+// getSecret returns cached gateway secret or reads it from database.
+// Empty string is returned if gateway has no secret.
+func (a *GatewayAuth) getSecret(gatewayID string) (string, error) {
+	a.mx.Lock()
+	cached, ok := a.secrets[gatewayID]
+	a.mx.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.secret, nil
+	}
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	var secret string
+	queryText := `SELECT secret FROM v3_gateway_secrets WHERE gateway_id = ?;`
+	err := a.conn.Db.QueryRowContext(ctx, queryText, gatewayID).Scan(&secret)
+	if err != nil && err != sql.ErrNoRows {
+		return "", errors.Wrap(err, "failed reading gateway secret")
+	}
+
+	a.mx.Lock()
+	a.secrets[gatewayID] = cachedSecret{secret: secret, expires: time.Now().Add(a.secretTTL)}
+	a.mx.Unlock()
+	return secret, nil
+}
+
+// SignMessage returns hex encoded HMAC-SHA256 of message timestamp
+// in Unix seconds and body joined with dot
+func SignMessage(secret, timestamp string, body []byte) string {
+	return hex.EncodeToString(signMessage(secret, timestamp, body))
+}
+
+// CheckSignature compares message signature with expected one in constant time
+func CheckSignature(secret, timestamp string, body []byte, signature string) bool {
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signMessage(secret, timestamp, body), actual)
+}
+
+func signMessage(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,231 @@
+package broker
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+)
+
+const (
+	testGatewayID = "6e7bc4ae-b2a5-4bd6-9e0e-3e1c2a3c9f10"
+	testSecret    = "gatewaysecret"
+	testBody      = `{"messageType":"sensorData"}`
+)
+
+// newTestGatewayAuth makes authenticator with cached secrets, so database is not used.
+// Gateway "unsigned" has no secret.
+func newTestGatewayAuth(mode string) *GatewayAuth {
+	a := NewGatewayAuth(nil, mode, time.Hour, 5*time.Minute)
+	expires := time.Now().Add(time.Hour)
+	a.secrets[testGatewayID] = cachedSecret{secret: testSecret, expires: expires}
+	a.secrets["unsigned"] = cachedSecret{expires: expires}
+	return a
+}
+
+// testEnvelope makes gateway message signed with secret at passed time.
+// Message is not signed if secret is empty.
+func testEnvelope(gatewayID, secret string, sent time.Time) *AmqpEnvelope {
+	env := &AmqpEnvelope{
+		Message:  &entities.IotMessage{GatewayId: gatewayID},
+		Metadata: &AmqpMetadata{},
+		Body:     []byte(testBody),
+	}
+	if len(secret) > 0 {
+		env.Metadata.Timestamp = strconv.FormatInt(sent.Unix(), 10)
+		env.Metadata.Signature = SignMessage(secret, env.Metadata.Timestamp, env.Body)
+	}
+	return env
+}
+
+func TestGatewayAuthVerify(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		mode      string
+		channelID string
+		env       *AmqpEnvelope
+		drop      bool
+		reason    string
+	}{
+		{
+			name:      "none mode accepts unsigned message",
+			mode:      GatewayAuthNone,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, "", now),
+		},
+		{
+			name:      "none mode accepts wrong signature",
+			mode:      GatewayAuthNone,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, "wrongsecret", now),
+		},
+		{
+			name:      "other gateway identity is dropped in none mode",
+			mode:      GatewayAuthNone,
+			channelID: testGatewayID,
+			env:       testEnvelope("other", "", now),
+			drop:      true,
+			reason:    rejectGatewayMismatch,
+		},
+		{
+			name:      "audit mode accepts unsigned message",
+			mode:      GatewayAuthAudit,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, "", now),
+		},
+		{
+			name:      "audit mode accepts signed message",
+			mode:      GatewayAuthAudit,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, testSecret, now),
+		},
+		{
+			name:      "audit mode audits wrong signature",
+			mode:      GatewayAuthAudit,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, "wrongsecret", now),
+			reason:    rejectWrongSignature,
+		},
+		{
+			name:      "audit mode audits stale message",
+			mode:      GatewayAuthAudit,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, testSecret, now.Add(-10*time.Minute)),
+			reason:    rejectStaleMessage,
+		},
+		{
+			name:      "other gateway identity is dropped in audit mode",
+			mode:      GatewayAuthAudit,
+			channelID: testGatewayID,
+			env:       testEnvelope("other", testSecret, now),
+			drop:      true,
+			reason:    rejectGatewayMismatch,
+		},
+		{
+			name:      "enforce mode accepts signed message",
+			mode:      GatewayAuthEnforce,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, testSecret, now),
+		},
+		{
+			name:      "enforce mode accepts message within max age",
+			mode:      GatewayAuthEnforce,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, testSecret, now.Add(-4*time.Minute)),
+		},
+		{
+			name:      "enforce mode drops unsigned message",
+			mode:      GatewayAuthEnforce,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, "", now),
+			drop:      true,
+			reason:    rejectMissingSignature,
+		},
+		{
+			name:      "enforce mode drops wrong signature",
+			mode:      GatewayAuthEnforce,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, "wrongsecret", now),
+			drop:      true,
+			reason:    rejectWrongSignature,
+		},
+		{
+			name:      "enforce mode drops message older than max age",
+			mode:      GatewayAuthEnforce,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, testSecret, now.Add(-6*time.Minute)),
+			drop:      true,
+			reason:    rejectStaleMessage,
+		},
+		{
+			name:      "enforce mode drops message from future",
+			mode:      GatewayAuthEnforce,
+			channelID: testGatewayID,
+			env:       testEnvelope(testGatewayID, testSecret, now.Add(6*time.Minute)),
+			drop:      true,
+			reason:    rejectStaleMessage,
+		},
+		{
+			name:      "enforce mode drops gateway without secret",
+			mode:      GatewayAuthEnforce,
+			channelID: "unsigned",
+			env:       testEnvelope("unsigned", testSecret, now),
+			drop:      true,
+			reason:    rejectNoSecret,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drop, err := newTestGatewayAuth(tt.mode).Verify(tt.channelID, tt.env)
+			if drop != tt.drop {
+				t.Errorf("Verify() drop = %v, want %v", drop, tt.drop)
+			}
+			reason := ""
+			if err != nil {
+				authErr, ok := err.(*errGatewayAuth)
+				if !ok {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				reason = authErr.reason
+			}
+			if reason != tt.reason {
+				t.Errorf("Verify() reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestGatewayAuthMissingTimestamp(t *testing.T) {
+	env := testEnvelope(testGatewayID, testSecret, time.Now())
+	env.Metadata.Timestamp = ""
+
+	for mode, drop := range map[string]bool{GatewayAuthAudit: false, GatewayAuthEnforce: true} {
+		got, err := newTestGatewayAuth(mode).Verify(testGatewayID, env)
+		if got != drop {
+			t.Errorf("%s: Verify() drop = %v, want %v", mode, got, drop)
+		}
+		if authErr, ok := err.(*errGatewayAuth); !ok || authErr.reason != rejectMissingTimestamp {
+			t.Errorf("%s: Verify() error = %v, want %s", mode, err, rejectMissingTimestamp)
+		}
+	}
+}
+
+func TestGatewayAuthFillsGatewayID(t *testing.T) {
+	env := testEnvelope("", "", time.Now())
+	if drop, err := newTestGatewayAuth(GatewayAuthAudit).Verify(testGatewayID, env); drop || err != nil {
+		t.Errorf("Verify() = %v, %v, want message accepted", drop, err)
+	}
+	if env.Message.GatewayId != testGatewayID {
+		t.Errorf("gateway id = %q, want channel gateway id", env.Message.GatewayId)
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	body := []byte(testBody)
+	signature := SignMessage(testSecret, "1500000000", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid signature", testSecret, "1500000000", body, signature, true},
+		{"other secret", "othersecret", "1500000000", body, signature, false},
+		{"other timestamp", testSecret, "1500000001", body, signature, false},
+		{"other body", testSecret, "1500000000", []byte(`{}`), signature, false},
+		{"signature is not hex", testSecret, "1500000000", body, "zz", false},
+		{"empty signature", testSecret, "1500000000", body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckSignature(tt.secret, tt.timestamp, tt.body, tt.signature); got != tt.want {
+				t.Errorf("CheckSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package broker
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/viper"
@@ -22,20 +24,46 @@ import (
 	"github.com/streadway/amqp"
 )
 
+// auditInterval is minimal time between audit records of one gateway
+const auditInterval = time.Second
+
+// EnvelopeReader interface for reading gateway messages with transport metadata
+type EnvelopeReader interface {
+	io.ReadCloser
+	ReadEnvelope() (env *AmqpEnvelope, close bool, err error)
+}
+
+// EnvelopeWriter interface for writing messages with transport metadata to gateway
+type EnvelopeWriter interface {
+	io.WriteCloser
+	WriteEnvelope(env *AmqpEnvelope) error
+}
+
 // GatewayChannel structure keeps data for
 // gateway channel i/o and message processing
 type GatewayChannel struct {
 	serverID   string
 	gatewayID  string
 	conn       *database.Connection
-	out        *AmqpReader
-	in         *AmqpWriter
+	services   *logic.Services
+	auth       *GatewayAuth
+	transport  string
+	rejected   func() // called if gateway is not registered in database
+	out        EnvelopeReader
+	in         EnvelopeWriter
 	ctx        context.Context
 	cancel     context.CancelFunc
 	rpcMx      sync.Mutex
 	rpcCalls   rpcPendingCallMap
 	rpcTimeout time.Duration
+	blMx       sync.Mutex
 	bl         interfaces.Logic
+	blCancel   context.CancelFunc // stops goroutines of current logic
+	createdAt  time.Time
+	lastMsgAt  int64 // Unix nanoseconds, accessed atomically
+	auditedAt  int64 // Unix nanoseconds, accessed atomically
+	auditSkip  int64 // rejected messages not audited, accessed atomically
+	version    atomic.Value
 }
 
 type rpcPendingCall struct {
@@ -46,24 +74,36 @@ type rpcPendingCall struct {
 type rpcPendingCallMap map[string]*rpcPendingCall
 
 // NewGatewayChannel function for GatewayChannel structure construction
-func NewGatewayChannel(amqpConn *amqp.Connection, dbConn *database.Connection, serverID, gatewayID string) interfaces.Channel {
+func NewGatewayChannel(amqpConn *amqp.Connection, services *logic.Services, auth *GatewayAuth, serverID, gatewayID string) interfaces.Channel {
 	// Create cancel context
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Create gateway reader and writer
 	out := NewAmqpReader(ctx, amqpConn, gatewayID)
 	if out == nil {
+		cancel()
 		return nil
 	}
 	in := NewAmqpWriter(amqpConn, gatewayID)
 	if in == nil {
+		cancel()
 		return nil
 	}
 
+	ch := newGatewayChannel(ctx, cancel, services, serverID, gatewayID, out, in)
+	ch.auth = auth
+	ch.transport = "amqp"
+	return ch
+}
+
+// newGatewayChannel makes gateway channel over transport specific reader and writer
+func newGatewayChannel(ctx context.Context, cancel context.CancelFunc, services *logic.Services,
+	serverID, gatewayID string, out EnvelopeReader, in EnvelopeWriter) *GatewayChannel {
 	return &GatewayChannel{
 		serverID:   serverID,
 		gatewayID:  gatewayID,
-		conn:       dbConn,
+		conn:       services.Conn,
+		services:   services,
 		out:        out,
 		in:         in,
 		ctx:        ctx,
@@ -72,6 +112,7 @@ func NewGatewayChannel(amqpConn *amqp.Connection, dbConn *database.Connection, s
 		rpcCalls:   make(rpcPendingCallMap),
 		rpcTimeout: viper.GetDuration("amqp.rpcTimeout"),
 		bl:         nil, // Do not create business logic until gateway status come
+		createdAt:  time.Now(),
 	}
 }
 
@@ -86,7 +127,23 @@ func (c *GatewayChannel) Write(p []byte) (n int, err error) {
 // Close reading and writing channels
 func (c *GatewayChannel) Close() error {
 	c.Stop()
+	c.release()
+	return nil
+}
+
+// Detach stops message processing and closes channels keeping gateway
+// statuses in database. It is used when channel is recreated for online gateway.
+// Metered usage of channel logic is ended before.
+func (c *GatewayChannel) Detach() {
+	if bl := c.GetLogic(); bl != nil {
+		bl.Release()
+	}
+	c.cancel()
+	c.release()
+}
 
+// release closes pending calls and i/o channels
+func (c *GatewayChannel) release() {
 	// Close pending calls to quit blocked goroutines
 	c.rpcMx.Lock()
 	for _, call := range c.rpcCalls {
@@ -103,8 +160,6 @@ func (c *GatewayChannel) Close() error {
 		logger.Error("error closing gateway input channel",
 			"error", err, "caller", "GatewayChannel")
 	}
-
-	return nil
 }
 
 // Start functions make separate goroutine for message receiving and processing
@@ -127,6 +182,12 @@ func (c *GatewayChannel) Start() {
 					break
 				}
 
+				// Check gateway identity and message signature
+				if !c.verify(inputEnvelope) {
+					break
+				}
+				c.touch(inputEnvelope.Message.Version)
+
 				// Check for RPC responses
 				if len(inputEnvelope.Metadata.CorrelationID) > 0 {
 					// Make pending call
@@ -147,11 +208,44 @@ func (c *GatewayChannel) Start() {
 	}()
 }
 
+// verify checks message with gateway authenticator and audits rejected messages.
+// Returns true if message can be processed
+func (c *GatewayChannel) verify(env *AmqpEnvelope) bool {
+	drop, err := c.auth.Verify(c.gatewayID, env)
+	if err != nil {
+		reason := err.Error()
+		if authErr, ok := err.(*errGatewayAuth); ok {
+			reason = authErr.reason
+		}
+		if c.allowAudit() {
+			go tasks.NewAuditGatewayTrafficTask(c.conn, c.gatewayID, c.transport, reason).Run(env.Message)
+		}
+	}
+	return !drop
+}
+
+// allowAudit limits audit records of gateway to one per interval,
+// so gateway flooding with rejected messages can not flood database
+func (c *GatewayChannel) allowAudit() bool {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&c.auditedAt)
+	if now-last < int64(auditInterval) || !atomic.CompareAndSwapInt64(&c.auditedAt, last, now) {
+		atomic.AddInt64(&c.auditSkip, 1)
+		return false
+	}
+	if skipped := atomic.SwapInt64(&c.auditSkip, 0); skipped > 0 {
+		logger.Warn("Gateway rejected messages not audited", "count", skipped,
+			"gateway", c.gatewayID, "caller", "GatewayChannel")
+	}
+	return true
+}
+
 // ApplyLogic checks gateway, loads business logic and starts processing
 func (c *GatewayChannel) ApplyLogic(message entities.IotMessage) {
 
 	iotmessage := &message
 	// Load business logic if gateway is online and registered in database
+	c.blMx.Lock()
 	if c.bl == nil {
 		exists, err := c.CheckGatewayExistence(iotmessage)
 		if err != nil {
@@ -159,17 +253,22 @@ func (c *GatewayChannel) ApplyLogic(message entities.IotMessage) {
 				"error", err,
 				"gateway", c.gatewayID,
 				"caller", "GatewayChannel")
+			c.blMx.Unlock()
 			return
 		}
 		if !exists {
 			logger.Warn("Gateway is not registered in cloud database",
 				"gateway", c.gatewayID,
 				"caller", "GatewayChannel")
+			c.blMx.Unlock()
+			if c.rejected != nil {
+				c.rejected()
+			}
 			return
 		}
 
 		// Create business logic
-		c.bl, err = c.CreateLogic()
+		c.bl, c.blCancel, err = c.CreateLogic()
 		if err != nil {
 			logger.Error("cannot load business logic params",
 				"error", err,
@@ -177,9 +276,11 @@ func (c *GatewayChannel) ApplyLogic(message entities.IotMessage) {
 				"caller", "GatewayChannel")
 		}
 	}
+	bl := c.bl
+	c.blMx.Unlock()
 
 	// Check business logic pointer for validness
-	if c.bl == nil {
+	if bl == nil {
 		logger.Error("business logic is not loaded",
 			"gateway", c.gatewayID,
 			"caller", "GatewayChannel")
@@ -187,7 +288,7 @@ func (c *GatewayChannel) ApplyLogic(message entities.IotMessage) {
 	}
 
 	// Process incoming message
-	if err := c.bl.Process(iotmessage); err != nil {
+	if err := bl.Process(iotmessage); err != nil {
 		logger.Error("error processing message",
 			"error", err,
 			"gateway", c.gatewayID,
@@ -195,13 +296,24 @@ func (c *GatewayChannel) ApplyLogic(message entities.IotMessage) {
 	}
 }
 
-// CreateLogic function creates business logic and loads params
-func (c *GatewayChannel) CreateLogic() (interfaces.Logic, error) {
-	bl := logic.NewGatewayLogic(c.ctx, c.conn, c.gatewayID)
+// hasLogic checks if business logic of gateway is loaded
+func (c *GatewayChannel) hasLogic() bool {
+	c.blMx.Lock()
+	defer c.blMx.Unlock()
+	return c.bl != nil
+}
+
+// CreateLogic function creates business logic and loads params.
+// Logic runs with its own context, so its goroutines are stopped
+// with returned cancel function or when channel is closed.
+func (c *GatewayChannel) CreateLogic() (interfaces.Logic, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	bl := logic.NewGatewayLogic(ctx, c.services, c.gatewayID)
 	if err := bl.LoadParams(c.in); err != nil {
-		return nil, err
+		cancel()
+		return nil, nil, err
 	}
-	return bl, nil
+	return bl, cancel, nil
 }
 
 // CheckGatewayExistence checks for gateway records in database and update devices statuses
@@ -282,5 +394,34 @@ func (c *GatewayChannel) DoRPC(request *entities.IotMessage) (response *entities
 
 // GetLogic returns business logic for gateway channel
 func (c *GatewayChannel) GetLogic() interfaces.Logic {
+	c.blMx.Lock()
+	defer c.blMx.Unlock()
 	return c.bl
 }
+
+// touch marks time of last message received from gateway
+// and keeps gateway software version reported in message
+func (c *GatewayChannel) touch(version string) {
+	atomic.StoreInt64(&c.lastMsgAt, time.Now().UnixNano())
+	if len(version) > 0 {
+		c.version.Store(version)
+	}
+}
+
+// ReloadLogic reloads business logic params from database.
+// Replaced logic is stopped, logic not loaded yet is created
+// on next gateway message.
+func (c *GatewayChannel) ReloadLogic() error {
+	c.blMx.Lock()
+	defer c.blMx.Unlock()
+	if c.bl == nil {
+		return nil
+	}
+	bl, cancel, err := c.CreateLogic()
+	if err != nil {
+		return errors.Wrap(err, "failed reloading business logic params")
+	}
+	c.blCancel()
+	c.bl, c.blCancel = bl, cancel
+	return nil
+}
@@ -24,11 +24,28 @@ func NewGatewayChannelsMap() *GatewayChannelsMap {
 	}
 }
 
-// Add channel to map securely
-func (gc *GatewayChannelsMap) Add(gatewayID string, ch interfaces.Channel) {
+// Add channel to map securely. Returns channel replaced by added one
+// which should be closed by caller.
+func (gc *GatewayChannelsMap) Add(gatewayID string, ch interfaces.Channel) io.ReadWriteCloser {
 	gc.mx.Lock()
+	defer gc.mx.Unlock()
+
+	replaced := gc.channels[gatewayID]
 	gc.channels[gatewayID] = ch
-	gc.mx.Unlock()
+	return replaced
+}
+
+// GetOrAdd returns stored channel or stores channel made by create function
+func (gc *GatewayChannelsMap) GetOrAdd(gatewayID string, create func() interfaces.Channel) io.ReadWriteCloser {
+	gc.mx.Lock()
+	defer gc.mx.Unlock()
+
+	if ch, ok := gc.channels[gatewayID]; ok {
+		return ch
+	}
+	ch := create()
+	gc.channels[gatewayID] = ch
+	return ch
 }
 
 // Get channel from map
@@ -48,12 +65,25 @@ func (gc *GatewayChannelsMap) Remove(gatewayID string) {
 	gc.mx.Unlock()
 }
 
+// RemoveIf removes channel from map if it is still stored for gateway.
+// Returns true if channel was removed.
+func (gc *GatewayChannelsMap) RemoveIf(gatewayID string, ch io.ReadWriteCloser) bool {
+	gc.mx.Lock()
+	defer gc.mx.Unlock()
+
+	if stored, ok := gc.channels[gatewayID]; !ok || stored != ch {
+		return false
+	}
+	delete(gc.channels, gatewayID)
+	return true
+}
+
 // GetChannels converts map values to slice of channels
 func (gc *GatewayChannelsMap) GetChannels() []io.ReadWriteCloser {
 	gc.mx.Lock()
 	defer gc.mx.Unlock()
 
-	chans := make([]io.ReadWriteCloser, len(gc.channels))
+	chans := make([]io.ReadWriteCloser, 0, len(gc.channels))
 	for _, ch := range gc.channels {
 		chans = append(chans, ch)
 	}
@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic"
+)
+
+// GatewayInfo describes gateway channel held by server
+type GatewayInfo struct {
+	GatewayID     string     `json:"gatewayId"`
+	Transport     string     `json:"transport"`
+	Version       string     `json:"version,omitempty"`
+	ConnectedAt   time.Time  `json:"connectedAt"`
+	LastMessageAt *time.Time `json:"lastMessageAt,omitempty"`
+	LogicLoaded   bool       `json:"logicLoaded"`
+	OwnerID       uint64     `json:"ownerId,omitempty"`
+}
+
+// GatewayDetails describes gateway channel with devices of its business logic
+type GatewayDetails struct {
+	GatewayInfo
+	Cameras []logic.CameraInfo `json:"cameras"`
+	Sensors []logic.SensorInfo `json:"sensors"`
+}
+
+// Info returns gateway channel state
+func (c *GatewayChannel) Info() GatewayInfo {
+	info := GatewayInfo{
+		GatewayID:   c.gatewayID,
+		Transport:   c.transport,
+		ConnectedAt: c.createdAt,
+	}
+	if version, ok := c.version.Load().(string); ok {
+		info.Version = version
+	}
+	if ns := atomic.LoadInt64(&c.lastMsgAt); ns > 0 {
+		ts := time.Unix(0, ns)
+		info.LastMessageAt = &ts
+	}
+	if bl, ok := c.GetLogic().(*logic.GatewayLogic); ok && bl != nil {
+		info.LogicLoaded = true
+		info.OwnerID = bl.OwnerID()
+	}
+	return info
+}
+
+// Details returns gateway channel state with cameras and sensors
+func (c *GatewayChannel) Details() *GatewayDetails {
+	details := &GatewayDetails{
+		GatewayInfo: c.Info(),
+		Cameras:     make([]logic.CameraInfo, 0),
+		Sensors:     make([]logic.SensorInfo, 0),
+	}
+	if bl, ok := c.GetLogic().(*logic.GatewayLogic); ok && bl != nil {
+		details.Cameras = bl.Cameras()
+		details.Sensors = bl.Sensors()
+	}
+	return details
+}
+
+// ListGateways returns state of all gateway channels ordered by gateway id
+func (m *Manager) ListGateways() []GatewayInfo {
+	list := make([]GatewayInfo, 0)
+	for _, ch := range m.gwChans.GetChannels() {
+		if gwChan, ok := ch.(*GatewayChannel); ok && gwChan != nil {
+			list = append(list, gwChan.Info())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].GatewayID < list[j].GatewayID })
+	return list
+}
+
+// GetGatewayDetails returns gateway channel state with its devices.
+// Returns nil if server holds no channel for gateway.
+func (m *Manager) GetGatewayDetails(gatewayID string) *GatewayDetails {
+	gwChan, ok := m.gwChans.Get(gatewayID).(*GatewayChannel)
+	if !ok || gwChan == nil {
+		return nil
+	}
+	return gwChan.Details()
+}
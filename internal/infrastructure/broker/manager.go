@@ -2,6 +2,7 @@ package broker
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,13 +11,17 @@ import (
 	"time"
 
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/shadow"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/logic/tariffs"
 
 	"github.com/pkg/errors"
 
-	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
-
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tlsutil"
 
+	"github.com/spf13/viper"
 	"github.com/streadway/amqp"
 )
 
@@ -34,11 +39,18 @@ type Manager struct {
 	Ch       *amqp.Channel
 	evQue    amqp.Queue
 	evChan   <-chan amqp.Delivery
+	accExch  string
 	gwChans  *GatewayChannelsMap
+	services *logic.Services
+	auth     *GatewayAuth
+	mqtt     *MqttClient
+	done     chan struct{}
 }
 
-// NewManager constructs Manager structure with AMQP connection parameters
-func NewManager(ServerID, protocol, user, password, host string, port, ctlPort int) *Manager {
+// NewManager constructs Manager structure with AMQP connection parameters,
+// services shared by gateways business logic and gateway messages authenticator
+func NewManager(ServerID, protocol, user, password, host string, port, ctlPort int,
+	services *logic.Services, auth *GatewayAuth) *Manager {
 	return &Manager{
 		ServerID: ServerID,
 		Protocol: protocol,
@@ -48,6 +60,9 @@ func NewManager(ServerID, protocol, user, password, host string, port, ctlPort i
 		Port:     port,
 		CtlPort:  ctlPort,
 		gwChans:  NewGatewayChannelsMap(),
+		services: services,
+		auth:     auth,
+		done:     make(chan struct{}),
 	}
 }
 
@@ -56,8 +71,19 @@ func (m *Manager) Open() error {
 	var err error
 	connURL := fmt.Sprintf("%s://%s:%s@%s:%d/", m.Protocol, m.User, m.Password, m.Host, m.Port)
 
-	// Open connection to broker
-	m.Conn, err = amqp.Dial(connURL)
+	// Open connection to broker, amqps protocol requires TLS
+	if m.Protocol == "amqps" {
+		var tlsConfig *tls.Config
+		if tlsConfig, err = tlsutil.FromViper("amqp.tls").ClientConfig(); err != nil {
+			return errors.Wrap(err, "wrong AMQP TLS configuration")
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		m.Conn, err = amqp.DialTLS(connURL, tlsConfig)
+	} else {
+		m.Conn, err = amqp.Dial(connURL)
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed connecting to RabbitMQ")
 	}
@@ -73,6 +99,8 @@ func (m *Manager) Open() error {
 
 // Close gateway channels, event exchange and AMQP connection
 func (m *Manager) Close() error {
+	close(m.done)
+
 	// Close gateways
 	for _, ch := range m.gwChans.GetChannels() {
 		if ch == nil {
@@ -83,6 +111,13 @@ func (m *Manager) Close() error {
 		}
 	}
 
+	// Disconnect from MQTT broker
+	if m.mqtt != nil {
+		if err := m.mqtt.Close(); err != nil {
+			logger.Error("error closing MQTT client", "error", err, "caller", "Manager")
+		}
+	}
+
 	// Delete corresponding queue first
 	if len(m.evQue.Name) > 0 {
 		_, err := m.Ch.QueueDelete(m.evQue.Name, false, false, true)
@@ -194,7 +229,7 @@ func (m *Manager) readExchangeEvent(ctx context.Context) (ee exchangeEvent, err
 }
 
 // ProcessExchangeEvents reads exchange event from queue and processes it
-func (m *Manager) ProcessExchangeEvents(ctx context.Context, dbConn *database.Connection) {
+func (m *Manager) ProcessExchangeEvents(ctx context.Context) {
 	for {
 		ee, err := m.readExchangeEvent(ctx)
 		if err != nil {
@@ -215,22 +250,121 @@ func (m *Manager) ProcessExchangeEvents(ctx context.Context, dbConn *database.Co
 			if len(strArr) > 1 && strArr[1] == "in" {
 				switch eventType {
 				case "queue.created":
-					ch := NewGatewayChannel(m.Conn, dbConn, m.ServerID, gatewayID)
+					ch := NewGatewayChannel(m.Conn, m.services, m.auth, m.ServerID, gatewayID)
+					if ch == nil {
+						logger.Error("failed creating AMQP gateway channel", "gateway", gatewayID)
+						continue
+					}
 					ch.Start()
-					m.gwChans.Add(gatewayID, ch)
+					m.addGatewayChannel(gatewayID, ch)
 				case "queue.deleted":
-					if ch := m.gwChans.Get(gatewayID); ch != nil {
-						_ = ch.Close()
-						m.gwChans.Remove(gatewayID)
-					} else {
-						logger.Error("no stored gateway info", "gateway", gatewayID)
-					}
+					m.disconnectGateway(gatewayID)
 				}
 			}
 		}
 	}
 }
 
+// MqttInit connects to MQTT broker to serve gateways speaking MQTT.
+// MQTT gateways are processed by the same business logic as AMQP ones
+func (m *Manager) MqttInit(cfg MqttConfig) error {
+	if len(cfg.ClientID) == 0 {
+		cfg.ClientID = m.ServerID
+	}
+	m.mqtt = NewMqttClient(cfg, mqttGatewayHandlers{
+		onConnect:    m.connectMqttGateway,
+		onDisconnect: m.disconnectGateway,
+	})
+	if err := m.mqtt.Open(); err != nil {
+		m.mqtt = nil
+		return errors.Wrap(err, "failed opening MQTT client")
+	}
+	return nil
+}
+
+// connectMqttGateway creates gateway channel over MQTT topics
+func (m *Manager) connectMqttGateway(gatewayID string) {
+	// Create cancel context
+	ctx, cancel := context.WithCancel(context.Background())
+
+	out := NewMqttReader(ctx, m.mqtt, gatewayID)
+	in := NewMqttWriter(m.mqtt, gatewayID)
+	ch := newGatewayChannel(ctx, cancel, m.services, m.ServerID, gatewayID, out, in)
+	ch.auth = m.auth
+	ch.transport = "mqtt"
+	ch.rejected = func() {
+		m.mqtt.reject(gatewayID)
+		m.dropMqttGateway(gatewayID, ch)
+	}
+	ch.Start()
+	m.addGatewayChannel(gatewayID, ch)
+	logger.Info("MQTT gateway connected", "gateway", gatewayID)
+
+	// Drop channel of gateway which sends no valid messages
+	time.AfterFunc(mqttLoadTimeout, func() {
+		if !ch.hasLogic() {
+			m.dropMqttGateway(gatewayID, ch)
+		}
+	})
+}
+
+// dropMqttGateway closes channel of gateway without logic loaded
+func (m *Manager) dropMqttGateway(gatewayID string, ch *GatewayChannel) {
+	if m.releaseGateway(gatewayID, ch) {
+		logger.Warn("MQTT gateway channel dropped", "gateway", gatewayID, "caller", "Manager")
+	}
+}
+
+// addGatewayChannel stores gateway channel. Channel replaced by it, e.g. virtual
+// channel or channel of previous connection, is detached keeping gateway statuses.
+func (m *Manager) addGatewayChannel(gatewayID string, ch interfaces.Channel) {
+	replaced := m.gwChans.Add(gatewayID, ch)
+	if replaced == nil || replaced == io.ReadWriteCloser(ch) {
+		return
+	}
+	if gwChan, ok := replaced.(*GatewayChannel); ok {
+		gwChan.Detach()
+	} else {
+		_ = replaced.Close()
+	}
+	logger.Info("Gateway channel replaced", "gateway", gatewayID)
+}
+
+// releaseGateway removes gateway channel if it is still stored and detaches it.
+// Unlike disconnectGateway offline events are not fired and gateway statuses
+// are not changed in database. Returns true if channel was released.
+func (m *Manager) releaseGateway(gatewayID string, ch *GatewayChannel) bool {
+	if !m.gwChans.RemoveIf(gatewayID, ch) {
+		return false
+	}
+	ch.Detach()
+	m.services.Shadows.Release(gatewayID)
+	m.services.Rules.Remove(gatewayID)
+	return true
+}
+
+// disconnectGateway fires gateway offline events and closes its channel
+func (m *Manager) disconnectGateway(gatewayID string) {
+	ch := m.gwChans.Get(gatewayID)
+	if ch == nil {
+		logger.Error("no stored gateway info", "gateway", gatewayID)
+		return
+	}
+
+	// Fire gateway offline events
+	if gwChan, ok := ch.(*GatewayChannel); ok {
+		if bl := gwChan.GetLogic(); bl != nil {
+			bl.SetOffline()
+		}
+	}
+	_ = ch.Close()
+	m.gwChans.Remove(gatewayID)
+
+	// Keep device shadow for a while in case gateway reconnects
+	m.services.Shadows.Release(gatewayID)
+	m.services.Rules.Remove(gatewayID)
+}
+
 // DoGatewayRPC sends command for gateway via RabbitMQ broker and
 // blocks execution until response or timeout
 func (m *Manager) DoGatewayRPC(gatewayID string, request *entities.IotMessage) (*entities.IotMessage, error) {
@@ -238,7 +372,7 @@ func (m *Manager) DoGatewayRPC(gatewayID string, request *entities.IotMessage) (
 	// Getting gateway channel from map
 	gwChan, ok := m.gwChans.Get(gatewayID).(*GatewayChannel)
 	if gwChan == nil || !ok {
-		return nil, errors.New("error getting channel with specified gatewayID")
+		return nil, ErrGatewayNotConnected
 	}
 
 	// Making RPC for gateway channel
@@ -255,12 +389,46 @@ func (m *Manager) GetGatewayChannel(gatewayID string) io.ReadWriteCloser {
 	return m.gwChans.Get(gatewayID)
 }
 
+// FindShadow returns device shadows of gateway connected now or recently
+func (m *Manager) FindShadow(gatewayID string) (*shadow.GatewayShadow, bool) {
+	return m.services.Shadows.Find(gatewayID)
+}
+
+// ResetGatewaySecret makes gateway authenticator re-read rotated gateway secret
+func (m *Manager) ResetGatewaySecret(gatewayID string) {
+	m.auth.Invalidate(gatewayID)
+}
+
+// ReloadRules reloads automation rules of connected gateway.
+// Rules of other gateways are loaded when they connect.
+func (m *Manager) ReloadRules(ctx context.Context, gatewayID string) error {
+	engine, ok := m.services.Rules.Find(gatewayID)
+	if !ok {
+		return nil
+	}
+	return engine.Load(ctx, m.services.Conn)
+}
+
+// ReloadTariffs reloads tariff features used by business logic of all gateways
+func (m *Manager) ReloadTariffs(ctx context.Context) error {
+	return m.services.Tariffs.Load(ctx, m.services.Conn)
+}
+
+// GetTariffs returns tariffs shared by business logic of all gateways
+func (m *Manager) GetTariffs() *tariffs.Registry {
+	return m.services.Tariffs
+}
+
 // RestartGateways reads input gateway queues
 // and sends restart messages to them
 func (m *Manager) RestartGateways() {
 
 	// Create queues request to management plugin
-	requestUrl := fmt.Sprintf("http://%s:%d/api/queues/", m.Host, m.CtlPort)
+	scheme := viper.GetString("amqp.ctlScheme")
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	requestUrl := fmt.Sprintf("%s://%s:%d/api/queues/", scheme, m.Host, m.CtlPort)
 	req, err := http.NewRequest("GET", requestUrl, nil)
 	if err != nil {
 		logger.Error("failed creating http request",
@@ -275,7 +443,12 @@ func (m *Manager) RestartGateways() {
 	req = req.WithContext(ctx)
 
 	// Get queues list from management plugin
-	client := http.DefaultClient
+	client, err := tlsutil.HTTPClient("amqp.ctlTls", 5*time.Second)
+	if err != nil {
+		logger.Error("failed creating http client",
+			"error", err, "caller", "RestartGateways")
+		return
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Error("error sending http request",
@@ -293,33 +466,14 @@ func (m *Manager) RestartGateways() {
 			nameArr := strings.Split(que.Name, ".")
 			if len(nameArr) > 1 && nameArr[1] == "in" {
 
-				// Create restart message
+				// Send restart command to gateway input queue
 				gatewayID := nameArr[0]
-				message := entities.CreateCloudIotMessage(gatewayID, "")
-				message.Protocol = "amqp"
-				message.MessageType = "command"
-				message.Command = "restart"
-
-				// Marshal message to JSON
-				buffer, err := json.Marshal(message)
-				if err != nil {
-					logger.Error("failed marshalling message to JSON",
-						"error", err, "caller", "RestartGateways")
+				if err := m.RestartGateway(gatewayID); err != nil {
+					logger.Error("error restarting gateway", "error", err,
+						"gateway", gatewayID, "caller", "RestartGateways")
 					continue
 				}
 
-				// Send JSON to RabbitMQ broker
-				wr := NewAmqpWriter(m.Conn, gatewayID)
-				if n, err := wr.Write(buffer); err != nil || n != len(buffer) {
-					logger.Error("error sending message to broker",
-						"error", err, "caller", "RestartGateways")
-					continue
-				}
-				if err := wr.Close(); err != nil {
-					logger.Error("error closing gateway input channel",
-						"error", err, "caller", "RestartGateways")
-				}
-
 				gwCounter++
 			}
 		}
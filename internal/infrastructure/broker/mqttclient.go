@@ -0,0 +1,395 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// MQTT topics of gateway channels:
+// gateway/<id>/out    - messages from gateway to cloud
+// gateway/<id>/in     - messages from cloud to gateway
+// gateway/<id>/status - "online" or "offline", gateways should set
+// "offline" as their last will to be disconnected properly.
+// Cloud servers subscribe for gateway topics as members of shared subscription
+// group, so every gateway message is received by one server only. Broker
+// should deliver messages of one gateway to the same server, e.g. EMQX
+// shared subscription strategy should be hash_clientid.
+const (
+	mqttTopicPrefix   = "gateway/"
+	mqttOutSuffix     = "/out"
+	mqttInSuffix      = "/in"
+	mqttStatusSuffix  = "/status"
+	mqttStatusOffline = "offline"
+	mqttQueueSize     = 100
+	mqttShareGroup    = "gocloudserver"
+	// Gateway channel is closed if its logic is not loaded in time,
+	// e.g. gateway sends no valid messages
+	mqttLoadTimeout = 30 * time.Second
+	// Messages of gateway not registered in database are ignored for a while
+	mqttRejectTTL = time.Minute
+)
+
+// MqttConfig holds parameters for MQTT broker connection
+type MqttConfig struct {
+	Broker            string
+	User              string
+	Password          string
+	ClientID          string
+	ShareGroup        string
+	KeepAlive         uint16
+	ReconnectInterval time.Duration
+	TLSConfig         *tls.Config
+}
+
+// mqttGatewayHandlers is called by MQTT client on gateway connection and disconnection
+type mqttGatewayHandlers struct {
+	onConnect    func(gatewayID string)
+	onDisconnect func(gatewayID string)
+}
+
+// mqttGatewayEvent is gateway connection or disconnection handled
+// out of MQTT router goroutine
+type mqttGatewayEvent struct {
+	gatewayID string
+	online    bool
+}
+
+// MqttClient keeps connection to external MQTT broker and
+// dispatches incoming gateway messages to gateway readers
+type MqttClient struct {
+	cfg      MqttConfig
+	handlers mqttGatewayHandlers
+	ctx      context.Context
+	cancel   context.CancelFunc
+	mx       sync.RWMutex
+	client   *paho.Client
+	lost     chan struct{}
+	inboxes  map[string]chan *paho.Publish
+	rejected map[string]time.Time
+	events   chan mqttGatewayEvent
+}
+
+// NewMqttClient constructs MqttClient structure
+func NewMqttClient(cfg MqttConfig, handlers mqttGatewayHandlers) *MqttClient {
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = 30
+	}
+	if cfg.ReconnectInterval <= 0 {
+		cfg.ReconnectInterval = 5 * time.Second
+	}
+	if len(cfg.ShareGroup) == 0 {
+		cfg.ShareGroup = mqttShareGroup
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MqttClient{
+		cfg:      cfg,
+		handlers: handlers,
+		ctx:      ctx,
+		cancel:   cancel,
+		mx:       sync.RWMutex{},
+		inboxes:  make(map[string]chan *paho.Publish),
+		rejected: make(map[string]time.Time),
+		events:   make(chan mqttGatewayEvent, mqttQueueSize),
+	}
+}
+
+// Open connects to MQTT broker and starts reconnection goroutine
+func (c *MqttClient) Open() error {
+	if err := c.connect(); err != nil {
+		return err
+	}
+	go c.keepConnected()
+	go c.handleGateways()
+	logger.Info("MQTT client connected", "broker", c.cfg.Broker)
+	return nil
+}
+
+// Close disconnects from MQTT broker
+func (c *MqttClient) Close() error {
+	c.cancel()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.client == nil {
+		return nil
+	}
+	if err := c.client.Disconnect(&paho.Disconnect{ReasonCode: 0}); err != nil {
+		return errors.Wrap(err, "failed disconnecting from MQTT broker")
+	}
+	c.client = nil
+	return nil
+}
+
+// connect dials MQTT broker, sends CONNECT packet and subscribes for gateway topics
+func (c *MqttClient) connect() error {
+	u, err := url.Parse(c.cfg.Broker)
+	if err != nil {
+		return errors.Wrap(err, "wrong MQTT broker address")
+	}
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", u.Host)
+	case "ssl", "tls", "mqtts":
+		tlsConfig := c.cfg.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, tlsConfig)
+	default:
+		return errors.Errorf("unsupported MQTT broker scheme %s", u.Scheme)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed connecting to MQTT broker")
+	}
+
+	// Watch for connection closing to reconnect
+	lost := make(chan struct{})
+	client := paho.NewClient()
+	client.Conn = &watchedConn{Conn: conn, closed: lost}
+	client.Router = paho.NewSingleHandlerRouter(c.route)
+
+	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+	defer cancel()
+
+	connect := &paho.Connect{
+		ClientID:     c.cfg.ClientID,
+		KeepAlive:    c.cfg.KeepAlive,
+		CleanStart:   true,
+		Username:     c.cfg.User,
+		UsernameFlag: len(c.cfg.User) > 0,
+		Password:     []byte(c.cfg.Password),
+		PasswordFlag: len(c.cfg.Password) > 0,
+	}
+	if _, err := client.Connect(ctx, connect); err != nil {
+		_ = conn.Close()
+		return errors.Wrap(err, "failed MQTT handshake")
+	}
+
+	// Subscribe for messages and statuses of all gateways shared with other servers
+	share := "$share/" + c.cfg.ShareGroup + "/"
+	_, err = client.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{
+			share + mqttTopicPrefix + "+" + mqttOutSuffix:    {QoS: 1},
+			share + mqttTopicPrefix + "+" + mqttStatusSuffix: {QoS: 1},
+		},
+	})
+	if err != nil {
+		client.Error(err)
+		return errors.Wrap(err, "failed subscribing for gateway topics")
+	}
+
+	c.mx.Lock()
+	c.client = client
+	c.lost = lost
+	c.mx.Unlock()
+	return nil
+}
+
+// keepConnected reconnects to MQTT broker after connection loss
+func (c *MqttClient) keepConnected() {
+	for {
+		c.mx.RLock()
+		lost := c.lost
+		c.mx.RUnlock()
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-lost:
+		}
+
+		logger.Warn("MQTT connection lost", "broker", c.cfg.Broker, "caller", "MqttClient")
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(c.cfg.ReconnectInterval):
+			}
+			if err := c.connect(); err != nil {
+				logger.Error("error reconnecting to MQTT broker",
+					"error", err, "broker", c.cfg.Broker, "caller", "MqttClient")
+				continue
+			}
+			logger.Info("MQTT client reconnected", "broker", c.cfg.Broker)
+			break
+		}
+	}
+}
+
+// handleGateways creates and closes gateway channels in order
+// of gateway connection events
+func (c *MqttClient) handleGateways() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case event := <-c.events:
+			if event.online {
+				c.handlers.onConnect(event.gatewayID)
+			} else {
+				c.handlers.onDisconnect(event.gatewayID)
+			}
+		}
+	}
+}
+
+// notify queues gateway connection event
+func (c *MqttClient) notify(gatewayID string, online bool) {
+	select {
+	case <-c.ctx.Done():
+	case c.events <- mqttGatewayEvent{gatewayID: gatewayID, online: online}:
+	}
+}
+
+// route dispatches incoming publish to gateway reader. It is called by
+// MQTT router goroutine, so gateway channels are created in background.
+func (c *MqttClient) route(p *paho.Publish) {
+	gatewayID, suffix, ok := parseGatewayTopic(p.Topic)
+	if !ok {
+		logger.Warn("Unexpected MQTT topic", "topic", p.Topic, "caller", "MqttClient")
+		return
+	}
+
+	switch suffix {
+	case mqttStatusSuffix:
+		if string(p.Payload) == mqttStatusOffline {
+			if c.hasInbox(gatewayID) {
+				c.notify(gatewayID, false)
+			}
+		}
+	case mqttOutSuffix:
+		if c.isRejected(gatewayID) {
+			return
+		}
+		// First message from gateway creates its inbox and channel.
+		// Messages are kept in inbox until channel reader is created.
+		inbox, created := c.inbox(gatewayID)
+		if created {
+			c.notify(gatewayID, true)
+		}
+		select {
+		case inbox <- p:
+		default:
+			logger.Warn("Gateway MQTT queue is full, message dropped",
+				"gateway", gatewayID, "caller", "MqttClient")
+		}
+	}
+}
+
+// inbox returns gateway inbox creating it if needed
+func (c *MqttClient) inbox(gatewayID string) (chan *paho.Publish, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	inbox, ok := c.inboxes[gatewayID]
+	if !ok {
+		inbox = make(chan *paho.Publish, mqttQueueSize)
+		c.inboxes[gatewayID] = inbox
+	}
+	return inbox, !ok
+}
+
+// subscribe returns inbox for gateway messages
+func (c *MqttClient) subscribe(gatewayID string) <-chan *paho.Publish {
+	inbox, _ := c.inbox(gatewayID)
+	return inbox
+}
+
+// unsubscribe removes gateway inbox if it was not replaced by new one
+func (c *MqttClient) unsubscribe(gatewayID string, msgs <-chan *paho.Publish) {
+	c.mx.Lock()
+	if inbox, ok := c.inboxes[gatewayID]; ok && (<-chan *paho.Publish)(inbox) == msgs {
+		delete(c.inboxes, gatewayID)
+	}
+	c.mx.Unlock()
+}
+
+// reject ignores messages of gateway not registered in database for a while
+func (c *MqttClient) reject(gatewayID string) {
+	now := time.Now()
+	c.mx.Lock()
+	for id, expires := range c.rejected {
+		if now.After(expires) {
+			delete(c.rejected, id)
+		}
+	}
+	c.rejected[gatewayID] = now.Add(mqttRejectTTL)
+	c.mx.Unlock()
+}
+
+func (c *MqttClient) isRejected(gatewayID string) bool {
+	c.mx.RLock()
+	expires, ok := c.rejected[gatewayID]
+	c.mx.RUnlock()
+	return ok && time.Now().Before(expires)
+}
+
+func (c *MqttClient) hasInbox(gatewayID string) bool {
+	c.mx.RLock()
+	_, ok := c.inboxes[gatewayID]
+	c.mx.RUnlock()
+	return ok
+}
+
+// publish sends message to MQTT broker
+func (c *MqttClient) publish(p *paho.Publish) error {
+	c.mx.RLock()
+	client := c.client
+	c.mx.RUnlock()
+	if client == nil {
+		return errors.New("no connection to MQTT broker")
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+	defer cancel()
+	if _, err := client.Publish(ctx, p); err != nil {
+		return errors.Wrap(err, "failed to publish MQTT message")
+	}
+	return nil
+}
+
+// parseGatewayTopic splits gateway/<id>/<suffix> topic
+func parseGatewayTopic(topic string) (gatewayID, suffix string, ok bool) {
+	if !strings.HasPrefix(topic, mqttTopicPrefix) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(topic, mqttTopicPrefix)
+	i := strings.LastIndex(rest, "/")
+	if i <= 0 {
+		return "", "", false
+	}
+	// Gateway ids are UUIDs, other topics must not create channels
+	if _, err := uuid.Parse(rest[:i]); err != nil {
+		return "", "", false
+	}
+	return rest[:i], rest[i:], true
+}
+
+// gatewayTopic returns MQTT topic of gateway channel
+func gatewayTopic(gatewayID, suffix string) string {
+	return fmt.Sprintf("%s%s%s", mqttTopicPrefix, gatewayID, suffix)
+}
+
+// watchedConn closes channel when network connection is closed by MQTT client
+type watchedConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (w *watchedConn) Close() error {
+	w.once.Do(func() { close(w.closed) })
+	return w.Conn.Close()
+}
@@ -0,0 +1,94 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/pkg/errors"
+)
+
+// MqttReader structure for reading gateway messages from MQTT topic
+type MqttReader struct {
+	gatewayID string
+	ctx       context.Context
+	client    *MqttClient
+	msgs      <-chan *paho.Publish
+}
+
+// NewMqttReader function for MqttReader structure construction
+func NewMqttReader(ctx context.Context, client *MqttClient, gatewayID string) *MqttReader {
+	return &MqttReader{
+		gatewayID: gatewayID,
+		ctx:       ctx,
+		client:    client,
+		msgs:      client.subscribe(gatewayID),
+	}
+}
+
+// Read one message from gateway topic. Returns message length in bytes
+func (r *MqttReader) Read(p []byte) (n int, err error) {
+	select {
+	case <-r.ctx.Done():
+		logger.Debug("Context cancelled", "caller", "MqttReader")
+	case message, ok := <-r.msgs:
+		if ok {
+			n = copy(p, message.Payload)
+		}
+	}
+	return
+}
+
+// ReadEnvelope reads and unmarshals message from gateway topic.
+// MQTT v5 correlation data is used as correlation id for RPC responses
+func (r *MqttReader) ReadEnvelope() (env *AmqpEnvelope, close bool, err error) {
+	select {
+	case <-r.ctx.Done():
+		logger.Debug("Context cancelled", "caller", "ReadEnvelope")
+		close = true
+	case message, ok := <-r.msgs:
+		if ok {
+			inputMessage := entities.IotMessage{}
+
+			// Unmarshal input message from JSON to structure
+			err = json.Unmarshal(message.Payload, &inputMessage)
+			if err != nil {
+				err = errors.Wrap(err, "can not unmarshal incoming gateway message")
+				return
+			}
+
+			// Print copy of incoming message to log
+			r.PrintMessage(inputMessage)
+
+			// Create envelope
+			env = &AmqpEnvelope{
+				Message:  &inputMessage,
+				Metadata: &AmqpMetadata{},
+				Body:     message.Payload,
+			}
+			if message.Properties != nil {
+				env.Metadata.CorrelationID = string(message.Properties.CorrelationData)
+				env.Metadata.Signature = message.Properties.User[SignatureHeader]
+				env.Metadata.Timestamp = message.Properties.User[TimestampHeader]
+			}
+		}
+	}
+	return
+}
+
+// PrintMessage prints incoming message to log
+func (r MqttReader) PrintMessage(message entities.IotMessage) {
+	// Slim long preview
+	if len(message.Preview) > 0 {
+		message.Preview = "Some Base64 code ;)"
+	}
+	logger.Debug("Message from MQTT gateway", "message", message, "gateway", r.gatewayID)
+}
+
+// Close function stops dispatching gateway messages to reader
+func (r *MqttReader) Close() error {
+	r.client.unsubscribe(r.gatewayID, r.msgs)
+	return nil
+}
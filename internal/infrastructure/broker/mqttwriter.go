@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"encoding/json"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/pkg/errors"
+)
+
+// MqttWriter structure for writing messages to gateway MQTT topic
+type MqttWriter struct {
+	client        *MqttClient
+	topic         string
+	responseTopic string
+}
+
+// NewMqttWriter function for MqttWriter construction
+func NewMqttWriter(client *MqttClient, gatewayID string) *MqttWriter {
+	return &MqttWriter{
+		client:        client,
+		topic:         gatewayTopic(gatewayID, mqttInSuffix),
+		responseTopic: gatewayTopic(gatewayID, mqttOutSuffix),
+	}
+}
+
+// Write message to gateway topic.
+// Returns message length on success or error if any
+func (w *MqttWriter) Write(p []byte) (n int, err error) {
+	err = w.client.publish(&paho.Publish{
+		QoS:     1,
+		Topic:   w.topic,
+		Payload: p,
+		Properties: &paho.PublishProperties{
+			ContentType: "application/json",
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEnvelope sends message with MQTT v5 correlation data and
+// response topic to gateway, returns error object or nil
+func (w *MqttWriter) WriteEnvelope(env *AmqpEnvelope) error {
+
+	// Marshall message to JSON
+	buffer, err := json.Marshal(env.Message)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling RPC request to JSON")
+	}
+
+	// Gateway responds to its output topic with the same correlation data
+	return w.client.publish(&paho.Publish{
+		QoS:     1,
+		Topic:   w.topic,
+		Payload: buffer,
+		Properties: &paho.PublishProperties{
+			ContentType:     "application/json",
+			CorrelationData: []byte(env.Metadata.CorrelationID),
+			ResponseTopic:   w.responseTopic,
+		},
+	})
+}
+
+// Close function does nothing as MQTT connection is shared by gateways
+func (w *MqttWriter) Close() error {
+	return nil
+}
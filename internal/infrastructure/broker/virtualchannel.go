@@ -0,0 +1,168 @@
+package broker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// VirtualReader structure stands for output channel of virtual gateway.
+// Direct-to-cloud devices post their messages over HTTP, so nothing is read here
+type VirtualReader struct {
+	ctx context.Context
+}
+
+// NewVirtualReader function for VirtualReader structure construction
+func NewVirtualReader(ctx context.Context) *VirtualReader {
+	return &VirtualReader{ctx: ctx}
+}
+
+// Read blocks until virtual gateway channel is closed
+func (r *VirtualReader) Read(p []byte) (n int, err error) {
+	<-r.ctx.Done()
+	return 0, nil
+}
+
+// ReadEnvelope blocks until virtual gateway channel is closed
+func (r *VirtualReader) ReadEnvelope() (env *AmqpEnvelope, close bool, err error) {
+	<-r.ctx.Done()
+	return nil, true, nil
+}
+
+// Close function does nothing for virtual gateway
+func (r *VirtualReader) Close() error {
+	return nil
+}
+
+// VirtualWriter structure stands for input channel of virtual gateway.
+// Direct-to-cloud devices can not receive commands, so messages are dropped
+type VirtualWriter struct {
+	gatewayID string
+}
+
+// NewVirtualWriter function for VirtualWriter construction
+func NewVirtualWriter(gatewayID string) *VirtualWriter {
+	return &VirtualWriter{gatewayID: gatewayID}
+}
+
+// Write drops message for virtual gateway
+func (w *VirtualWriter) Write(p []byte) (n int, err error) {
+	logger.Debug("Message for virtual gateway dropped", "gateway", w.gatewayID)
+	return len(p), nil
+}
+
+// WriteEnvelope refuses RPC requests as virtual gateway can not respond
+func (w *VirtualWriter) WriteEnvelope(env *AmqpEnvelope) error {
+	return errors.New("virtual gateway does not support RPC")
+}
+
+// Close function does nothing for virtual gateway
+func (w *VirtualWriter) Close() error {
+	return nil
+}
+
+// VirtualGatewaysInit starts closing virtual gateway channels which got
+// no messages for idle timeout, as direct-to-cloud devices never disconnect
+func (m *Manager) VirtualGatewaysInit(idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		idleTimeout = 10 * time.Minute
+	}
+	go m.evictIdleVirtualGateways(idleTimeout)
+}
+
+// evictIdleVirtualGateways periodically closes idle virtual gateway channels
+// until manager is closed. Gateway statuses are kept in database, as virtual
+// gateway is not gone offline but has nothing to send.
+func (m *Manager) evictIdleVirtualGateways(idleTimeout time.Duration) {
+	interval := time.Minute
+	if idleTimeout < interval {
+		interval = idleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+		}
+		for _, ch := range m.gwChans.GetChannels() {
+			gwChan, ok := ch.(*GatewayChannel)
+			if !ok || gwChan.transport != "http" || !gwChan.idle(idleTimeout) {
+				continue
+			}
+			if m.releaseGateway(gwChan.gatewayID, gwChan) {
+				logger.Info("Idle virtual gateway channel closed", "gateway", gwChan.gatewayID)
+			}
+		}
+	}
+}
+
+// idle checks that gateway sent no messages for timeout
+func (c *GatewayChannel) idle(timeout time.Duration) bool {
+	last := c.createdAt
+	if ns := atomic.LoadInt64(&c.lastMsgAt); ns > 0 {
+		last = time.Unix(0, ns)
+	}
+	return time.Since(last) > timeout
+}
+
+// IngestMessage processes message posted by direct-to-cloud device
+// with business logic of its gateway. Virtual gateway channel is created
+// on first message if gateway is not connected to broker and is flagged
+// as virtual one in database.
+func (m *Manager) IngestMessage(message *entities.IotMessage) error {
+	gatewayID := message.GatewayId
+	if m.gwChans.Get(gatewayID) == nil {
+		virtual, err := m.isVirtualGateway(gatewayID)
+		if err != nil {
+			return err
+		}
+		if !virtual {
+			return ErrGatewayNotConnected
+		}
+	}
+
+	ch := m.gwChans.GetOrAdd(gatewayID, func() interfaces.Channel {
+		// Create cancel context
+		ctx, cancel := context.WithCancel(context.Background())
+
+		ch := newGatewayChannel(ctx, cancel, m.services, m.ServerID, gatewayID,
+			NewVirtualReader(ctx), NewVirtualWriter(gatewayID))
+		ch.transport = "http"
+		ch.Start()
+		logger.Info("Virtual gateway channel created", "gateway", gatewayID)
+		return ch
+	})
+
+	gwChan, ok := ch.(*GatewayChannel)
+	if !ok {
+		return errors.New("unexpected gateway channel type")
+	}
+	gwChan.touch(message.Version)
+	gwChan.ApplyLogic(*message)
+	return nil
+}
+
+// isVirtualGateway checks if gateway is flagged as virtual gateway
+// of direct-to-cloud devices in database
+func (m *Manager) isVirtualGateway(gatewayID string) (bool, error) {
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	queryText := `select count(*) from v3_virtual_gateways where gateway_id = ?`
+	var value int
+	if err := m.services.Conn.Db.QueryRowContext(ctx, queryText, gatewayID).Scan(&value); err != nil {
+		return false, errors.Wrap(err, "failed searching virtual gateway in database")
+	}
+	return value > 0, nil
+}
@@ -0,0 +1,312 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/broker"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Firmware update progress statuses reported by gateway
+var reportedStatuses = map[string]bool{
+	UpdateDownloading: true,
+	UpdateInstalling:  true,
+	UpdateCompleted:   true,
+	UpdateFailed:      true,
+}
+
+// Config holds parameters for rollout orchestrator
+type Config struct {
+	CheckInterval time.Duration
+	UpdateTimeout time.Duration
+	MinSamples    int
+	BatchSize     int
+}
+
+// Orchestrator sends firmware updates to gateways stage by stage, follows
+// their progress and halts campaigns failing too often
+type Orchestrator struct {
+	cfg    Config
+	conn   *database.Connection
+	mgr    *broker.Manager
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewOrchestrator constructs Orchestrator structure
+func NewOrchestrator(conn *database.Connection, mgr *broker.Manager, cfg Config) *Orchestrator {
+	// Set defaults for missing params
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 30 * time.Second
+	}
+	if cfg.UpdateTimeout <= 0 {
+		cfg.UpdateTimeout = 30 * time.Minute
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 5
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Orchestrator{
+		cfg:    cfg,
+		conn:   conn,
+		mgr:    mgr,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start makes goroutine checking running campaigns periodically
+func (o *Orchestrator) Start() {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		ticker := time.NewTicker(o.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-o.ctx.Done():
+				return
+			case <-ticker.C:
+				o.checkCampaigns()
+			}
+		}
+	}()
+	logger.Info("Firmware rollout orchestrator started", "interval", o.cfg.CheckInterval)
+}
+
+// Close stops orchestrator and waits for updates being sent
+func (o *Orchestrator) Close() error {
+	o.cancel()
+	o.wg.Wait()
+	return nil
+}
+
+// Track stores firmware version reported in gateway status and progress
+// of firmware update. Database is updated in a separate goroutine.
+func (o *Orchestrator) Track(message *entities.IotMessage) {
+	if message == nil || o.ctx.Err() != nil {
+		return
+	}
+	switch {
+	case message.MessageType == "status" && len(message.Version) > 0:
+	case message.MessageType == "firmwareUpdate" && reportedStatuses[message.Status]:
+	default:
+		return
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		if err := o.track(message); err != nil {
+			logger.Error("error tracking firmware update", "error", err,
+				"gateway", message.GatewayId, "caller", "Orchestrator")
+		}
+	}()
+}
+
+func (o *Orchestrator) track(message *entities.IotMessage) error {
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	if message.MessageType == "status" {
+		if err := ReportInventory(ctx, o.conn, message.GatewayId, message.Model, message.Version); err != nil {
+			return err
+		}
+	}
+
+	update, err := getActiveUpdate(ctx, o.conn, message.GatewayId)
+	if err != nil || update == nil {
+		return err
+	}
+
+	switch message.MessageType {
+	case "status":
+		// Gateway restarted with target firmware
+		if message.Version != update.Version {
+			return nil
+		}
+		logger.Info("Gateway firmware updated", "gateway", message.GatewayId,
+			"version", message.Version, "campaign", update.CampaignID)
+		return SetUpdateStatus(ctx, o.conn, update.CampaignID, message.GatewayId, UpdateCompleted, "")
+	default:
+		reason := ""
+		if message.Status == UpdateFailed {
+			reason = message.Content
+			logger.Warn("Gateway firmware update failed", "gateway", message.GatewayId,
+				"reason", reason, "campaign", update.CampaignID)
+		}
+		return SetUpdateStatus(ctx, o.conn, update.CampaignID, message.GatewayId, message.Status, reason)
+	}
+}
+
+// checkCampaigns advances every running campaign
+func (o *Orchestrator) checkCampaigns() {
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	campaigns, err := ListCampaigns(ctx, o.conn, CampaignRunning)
+	cancel()
+	if err != nil {
+		logger.Error("error reading running campaigns", "error", err, "caller", "Orchestrator")
+		return
+	}
+	for _, campaign := range campaigns {
+		if o.ctx.Err() != nil {
+			return
+		}
+		if err := o.advance(campaign); err != nil {
+			logger.Error("error advancing campaign", "error", err,
+				"campaign", campaign.ID, "caller", "Orchestrator")
+		}
+	}
+}
+
+// advance halts campaign failing too often, sends updates of current stage
+// or moves campaign to next stage when all stage updates are finished
+func (o *Orchestrator) advance(campaign *Campaign) error {
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	if err := failStaleUpdates(ctx, o.conn, campaign.ID, int64(o.cfg.UpdateTimeout/time.Second)); err != nil {
+		return err
+	}
+	progress, err := GetProgress(ctx, o.conn, campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	// Stop rollout if too many gateways failed
+	if progress.Finished() >= o.cfg.MinSamples && progress.FailureRate() > campaign.FailureThreshold {
+		reason := fmt.Sprintf("failure rate %.1f%% exceeds threshold %.1f%%",
+			progress.FailureRate(), campaign.FailureThreshold)
+		logger.Warn("Firmware campaign halted", "campaign", campaign.ID, "reason", reason)
+		return SetCampaignState(ctx, o.conn, campaign.ID, campaign.Stage, CampaignHalted, reason)
+	}
+
+	// Wait until gateways finish updates sent
+	if progress.InFlight() > 0 {
+		return nil
+	}
+
+	total := progress.Total()
+	released := total - progress[UpdatePending] - progress[UpdateSkipped]
+	if released < stageLimit(total, campaign.Stages[campaign.Stage]) {
+		fw, err := GetFirmware(ctx, o.conn, campaign.FirmwareID)
+		if err != nil {
+			return err
+		}
+		if fw == nil {
+			return SetCampaignState(ctx, o.conn, campaign.ID, campaign.Stage, CampaignHalted, "firmware not found")
+		}
+		quota := stageLimit(total, campaign.Stages[campaign.Stage]) - released
+		if quota > o.cfg.BatchSize {
+			quota = o.cfg.BatchSize
+		}
+		return o.sendBatch(campaign, fw, quota)
+	}
+
+	// Current stage is finished
+	if campaign.Stage+1 < len(campaign.Stages) {
+		logger.Info("Firmware campaign stage finished", "campaign", campaign.ID,
+			"stage", campaign.Stage, "percent", campaign.Stages[campaign.Stage])
+		return SetCampaignState(ctx, o.conn, campaign.ID, campaign.Stage+1, CampaignRunning, "")
+	}
+	logger.Info("Firmware campaign completed", "campaign", campaign.ID,
+		"completed", progress[UpdateCompleted], "failed", progress[UpdateFailed])
+	return SetCampaignState(ctx, o.conn, campaign.ID, campaign.Stage, CampaignCompleted, "")
+}
+
+// sendBatch sends firmware update to connected gateways with pending updates.
+// Gateways not connected stay pending until next check.
+func (o *Orchestrator) sendBatch(campaign *Campaign, fw *Firmware, quota int) error {
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	gatewayIds, err := listPendingGateways(ctx, o.conn, campaign.ID)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, gatewayID := range gatewayIds {
+		if quota == 0 {
+			break
+		}
+		if o.mgr.GetGatewayChannel(gatewayID) == nil {
+			continue
+		}
+		quota--
+		wg.Add(1)
+		go func(gatewayID string) {
+			defer wg.Done()
+			if err := o.sendUpdate(campaign, fw, gatewayID); err != nil {
+				logger.Error("error sending firmware update", "error", err,
+					"gateway", gatewayID, "campaign", campaign.ID, "caller", "Orchestrator")
+			}
+		}(gatewayID)
+	}
+	wg.Wait()
+	return nil
+}
+
+// sendUpdate makes firmware update RPC for gateway
+func (o *Orchestrator) sendUpdate(campaign *Campaign, fw *Firmware, gatewayID string) error {
+	// Update is marked as sent before RPC as gateway may report progress at once
+	if err := o.setUpdateStatus(campaign.ID, gatewayID, UpdateSent, ""); err != nil {
+		return err
+	}
+
+	// Create RPC request for gateway
+	request := entities.CreateCloudIotMessage(gatewayID, "")
+	request.DeviceType = "gateway"
+	request.Protocol = "amqp"
+	request.MessageType = "command"
+	request.Command = "firmwareUpdate"
+	request.Attribute = fw.Version
+	request.FirmwareUrl = fw.URL
+	request.Checksum = fw.Checksum
+
+	response, err := o.mgr.DoGatewayRPC(gatewayID, request)
+	switch {
+	case errors.Cause(err) == broker.ErrGatewayNotConnected:
+		return o.setUpdateStatus(campaign.ID, gatewayID, UpdatePending, "")
+	case err != nil:
+		_ = o.setUpdateStatus(campaign.ID, gatewayID, UpdateFailed, "gateway RPC request failed")
+		return err
+	case response != nil && response.Status == UpdateFailed:
+		return o.setUpdateStatus(campaign.ID, gatewayID, UpdateFailed, response.Content)
+	}
+	logger.Info("Firmware update sent", "gateway", gatewayID,
+		"version", fw.Version, "campaign", campaign.ID)
+	return nil
+}
+
+func (o *Orchestrator) setUpdateStatus(campaignID uint64, gatewayID, status, reason string) error {
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	return SetUpdateStatus(ctx, o.conn, campaignID, gatewayID, status, reason)
+}
+
+// stageLimit returns number of gateways updated by the end of stage, at least one
+func stageLimit(total, percent int) int {
+	limit := (total*percent + 99) / 100
+	if limit == 0 && total > 0 {
+		limit = 1
+	}
+	return limit
+}
@@ -0,0 +1,510 @@
+package firmware
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// Campaign statuses
+const (
+	CampaignDraft     = "draft"
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused"
+	CampaignHalted    = "halted"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+// Gateway update statuses. Sent, downloading and installing updates are in flight.
+const (
+	UpdatePending     = "pending"
+	UpdateSent        = "sent"
+	UpdateDownloading = "downloading"
+	UpdateInstalling  = "installing"
+	UpdateCompleted   = "completed"
+	UpdateFailed      = "failed"
+	UpdateSkipped     = "skipped"
+)
+
+// Firmware structure to represent gateway firmware in catalog
+type Firmware struct {
+	ID        uint64   `json:"id"`
+	Version   string   `json:"version"`
+	URL       string   `json:"url"`
+	Checksum  string   `json:"checksum"`
+	Models    []string `json:"models"`
+	Notes     string   `json:"notes,omitempty"`
+	CreatedAt string   `json:"createdAt,omitempty"`
+}
+
+// Campaign structure to represent staged firmware rollout.
+// Stages hold cumulative percentages of target gateways, e.g. 1, 10, 100,
+// the first stage is canary one.
+type Campaign struct {
+	ID               uint64   `json:"id"`
+	FirmwareID       uint64   `json:"firmwareId"`
+	Title            string   `json:"title"`
+	Stages           []int    `json:"stages"`
+	Stage            int      `json:"stage"`
+	FailureThreshold float64  `json:"failureThreshold"`
+	OwnerID          uint64   `json:"ownerId,omitempty"`
+	FromVersions     []string `json:"fromVersions,omitempty"`
+	Status           string   `json:"status"`
+	Reason           string   `json:"reason,omitempty"`
+	CreatedAt        string   `json:"createdAt,omitempty"`
+	UpdatedAt        string   `json:"updatedAt,omitempty"`
+}
+
+// Update structure to represent firmware update of one gateway in campaign
+type Update struct {
+	CampaignID  uint64 `json:"campaignId" db:"campaign_id"`
+	GatewayID   string `json:"gatewayId" db:"gateway_id"`
+	FromVersion string `json:"fromVersion" db:"from_version"`
+	Status      string `json:"status" db:"status"`
+	Error       string `json:"error,omitempty" db:"error"`
+	UpdatedAt   string `json:"updatedAt" db:"updated_at"`
+}
+
+// Progress holds numbers of campaign updates by status
+type Progress map[string]int
+
+// Total returns number of campaign target gateways
+func (p Progress) Total() int {
+	var total int
+	for _, n := range p {
+		total += n
+	}
+	return total
+}
+
+// InFlight returns number of updates sent to gateways and not finished yet
+func (p Progress) InFlight() int {
+	return p[UpdateSent] + p[UpdateDownloading] + p[UpdateInstalling]
+}
+
+// Finished returns number of completed and failed updates
+func (p Progress) Finished() int {
+	return p[UpdateCompleted] + p[UpdateFailed]
+}
+
+// FailureRate returns percentage of failed updates among finished ones
+func (p Progress) FailureRate() float64 {
+	if p.Finished() == 0 {
+		return 0
+	}
+	return float64(p[UpdateFailed]) * 100 / float64(p.Finished())
+}
+
+// SupportsModel checks that firmware can be installed on gateway model.
+// Firmware without models list fits any gateway.
+func (f *Firmware) SupportsModel(model string) bool {
+	if len(f.Models) == 0 {
+		return true
+	}
+	for _, m := range f.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// ListFirmware reads firmware catalog
+func ListFirmware(ctx context.Context, conn *database.Connection) ([]*Firmware, error) {
+	queryText :=
+		`SELECT id, version, url, checksum, models, notes,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at
+		FROM v3_firmware
+		ORDER BY id;`
+	rows, err := conn.Db.QueryContext(ctx, queryText)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query firmware")
+	}
+	defer func() { _ = rows.Close() }()
+
+	list := make([]*Firmware, 0)
+	for rows.Next() {
+		fw, err := scanFirmware(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, fw)
+	}
+	return list, rows.Err()
+}
+
+// GetFirmware reads firmware by its id. Returns nil if firmware not found.
+func GetFirmware(ctx context.Context, conn *database.Connection, id uint64) (*Firmware, error) {
+	queryText :=
+		`SELECT id, version, url, checksum, models, notes,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at
+		FROM v3_firmware
+		WHERE id = ?;`
+	fw, err := scanFirmware(conn.Db.QueryRowContext(ctx, queryText, id))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	return fw, err
+}
+
+// CreateFirmware stores firmware in catalog and sets its id
+func CreateFirmware(ctx context.Context, conn *database.Connection, fw *Firmware) error {
+	queryText :=
+		`INSERT INTO v3_firmware (version, url, checksum, models, notes, created_at)
+		VALUES (?, ?, ?, ?, ?, now());`
+	result, err := conn.Db.ExecContext(ctx, queryText,
+		fw.Version, fw.URL, fw.Checksum, strings.Join(fw.Models, ","), fw.Notes)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert firmware")
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "failed to get firmware id")
+	}
+	fw.ID = uint64(id)
+	return nil
+}
+
+// DeleteFirmware removes firmware which is not used by campaigns.
+// Returns false if firmware not found or is used.
+func DeleteFirmware(ctx context.Context, conn *database.Connection, id uint64) (bool, error) {
+	queryText :=
+		`DELETE FROM v3_firmware
+		WHERE id = ? AND NOT EXISTS (
+			SELECT 1 FROM v3_firmware_campaigns WHERE firmware_id = ?);`
+	result, err := conn.Db.ExecContext(ctx, queryText, id, id)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to delete firmware")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get affected rows")
+	}
+	return affected > 0, nil
+}
+
+// ListCampaigns reads rollout campaigns, all or with defined status
+func ListCampaigns(ctx context.Context, conn *database.Connection, status string) ([]*Campaign, error) {
+	queryText :=
+		`SELECT id, firmware_id, title, definition, stage, status, reason,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at,
+			DATE_FORMAT(updated_at, '%Y-%m-%dT%H:%i:%s') AS updated_at
+		FROM v3_firmware_campaigns
+		WHERE ? = '' OR status = ?
+		ORDER BY id;`
+	rows, err := conn.Db.QueryContext(ctx, queryText, status, status)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query campaigns")
+	}
+	defer func() { _ = rows.Close() }()
+
+	list := make([]*Campaign, 0)
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, campaign)
+	}
+	return list, rows.Err()
+}
+
+// GetCampaign reads campaign by its id. Returns nil if campaign not found.
+func GetCampaign(ctx context.Context, conn *database.Connection, id uint64) (*Campaign, error) {
+	queryText :=
+		`SELECT id, firmware_id, title, definition, stage, status, reason,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at,
+			DATE_FORMAT(updated_at, '%Y-%m-%dT%H:%i:%s') AS updated_at
+		FROM v3_firmware_campaigns
+		WHERE id = ?;`
+	campaign, err := scanCampaign(conn.Db.QueryRowContext(ctx, queryText, id))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	return campaign, err
+}
+
+// CreateCampaign stores draft campaign and sets its id
+func CreateCampaign(ctx context.Context, conn *database.Connection, campaign *Campaign) error {
+	definition, err := json.Marshal(campaignDefinition{
+		Stages:           campaign.Stages,
+		FailureThreshold: campaign.FailureThreshold,
+		OwnerID:          campaign.OwnerID,
+		FromVersions:     campaign.FromVersions,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal campaign definition")
+	}
+	queryText :=
+		`INSERT INTO v3_firmware_campaigns
+			(firmware_id, title, definition, stage, status, reason, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, '', now(), now());`
+	result, err := conn.Db.ExecContext(ctx, queryText,
+		campaign.FirmwareID, campaign.Title, string(definition), CampaignDraft)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert campaign")
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "failed to get campaign id")
+	}
+	campaign.ID = uint64(id)
+	campaign.Status = CampaignDraft
+	return nil
+}
+
+// SetCampaignState changes campaign stage and status with reason
+func SetCampaignState(ctx context.Context, conn *database.Connection, id uint64, stage int, status, reason string) error {
+	queryText :=
+		`UPDATE v3_firmware_campaigns
+		SET stage = ?, status = ?, reason = ?, updated_at = now()
+		WHERE id = ?;`
+	if _, err := conn.Db.ExecContext(ctx, queryText, stage, status, reason, id); err != nil {
+		return errors.Wrap(err, "failed to update campaign")
+	}
+	return nil
+}
+
+// AddTargets makes pending updates for gateways reporting version and model which
+// the firmware can be installed on. Returns number of target gateways.
+func AddTargets(ctx context.Context, conn *database.Connection, campaign *Campaign, fw *Firmware) (int, error) {
+	queryText :=
+		`SELECT inv.gateway_id, inv.model, inv.version
+		FROM v3_gateway_firmware AS inv
+			INNER JOIN v3_gateways AS gw
+				ON gw.gateway_id = inv.gateway_id
+		WHERE inv.version <> ? AND (? = 0 OR gw.user_id = ?);`
+	rows, err := conn.Db.QueryContext(ctx, queryText, fw.Version, campaign.OwnerID, campaign.OwnerID)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query gateway firmware inventory")
+	}
+	type target struct {
+		gatewayID, version string
+	}
+	targets := make([]target, 0)
+	for rows.Next() {
+		var gatewayID, model, version string
+		if err := rows.Scan(&gatewayID, &model, &version); err != nil {
+			_ = rows.Close()
+			return 0, errors.Wrap(err, "could not read record data")
+		}
+		if !fw.SupportsModel(model) {
+			continue
+		}
+		if len(campaign.FromVersions) > 0 && !contains(campaign.FromVersions, version) {
+			continue
+		}
+		targets = append(targets, target{gatewayID: gatewayID, version: version})
+	}
+	_ = rows.Close()
+
+	insertQueryText :=
+		`INSERT IGNORE INTO v3_firmware_updates (campaign_id, gateway_id, from_version, status, error, updated_at)
+		VALUES (?, ?, ?, ?, '', now());`
+	for _, t := range targets {
+		if _, err := conn.Db.ExecContext(ctx, insertQueryText,
+			campaign.ID, t.gatewayID, t.version, UpdatePending); err != nil {
+			return 0, errors.Wrap(err, "failed to insert gateway update")
+		}
+	}
+	return len(targets), nil
+}
+
+// ListUpdates reads gateway updates of campaign, all or with defined status
+func ListUpdates(ctx context.Context, conn *database.Connection, campaignID uint64, status string, limit int) ([]*Update, error) {
+	queryText :=
+		`SELECT campaign_id, gateway_id, from_version, status, error,
+			DATE_FORMAT(updated_at, '%Y-%m-%dT%H:%i:%s') AS updated_at
+		FROM v3_firmware_updates
+		WHERE campaign_id = ? AND (? = '' OR status = ?)
+		ORDER BY gateway_id
+		LIMIT ?;`
+	updates := make([]*Update, 0)
+	if err := conn.Db.SelectContext(ctx, &updates, queryText, campaignID, status, status, limit); err != nil {
+		return nil, errors.Wrap(err, "failed to query gateway updates")
+	}
+	return updates, nil
+}
+
+// GetProgress counts campaign updates by status
+func GetProgress(ctx context.Context, conn *database.Connection, campaignID uint64) (Progress, error) {
+	queryText :=
+		`SELECT status, count(*)
+		FROM v3_firmware_updates
+		WHERE campaign_id = ?
+		GROUP BY status;`
+	rows, err := conn.Db.QueryContext(ctx, queryText, campaignID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query campaign progress")
+	}
+	defer func() { _ = rows.Close() }()
+
+	progress := make(Progress)
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, errors.Wrap(err, "could not read record data")
+		}
+		progress[status] = count
+	}
+	return progress, rows.Err()
+}
+
+// SetUpdateStatus changes status of gateway update
+func SetUpdateStatus(ctx context.Context, conn *database.Connection, campaignID uint64, gatewayID, status, reason string) error {
+	queryText :=
+		`UPDATE v3_firmware_updates
+		SET status = ?, error = ?, updated_at = now()
+		WHERE campaign_id = ? AND gateway_id = ?;`
+	if _, err := conn.Db.ExecContext(ctx, queryText, status, reason, campaignID, gatewayID); err != nil {
+		return errors.Wrap(err, "failed to update gateway update status")
+	}
+	return nil
+}
+
+// SkipPendingUpdates marks not sent updates of stopped campaign as skipped
+func SkipPendingUpdates(ctx context.Context, conn *database.Connection, campaignID uint64) error {
+	queryText :=
+		`UPDATE v3_firmware_updates
+		SET status = ?, updated_at = now()
+		WHERE campaign_id = ? AND status = ?;`
+	if _, err := conn.Db.ExecContext(ctx, queryText, UpdateSkipped, campaignID, UpdatePending); err != nil {
+		return errors.Wrap(err, "failed to skip pending updates")
+	}
+	return nil
+}
+
+// ReportInventory stores firmware version and model reported by gateway
+func ReportInventory(ctx context.Context, conn *database.Connection, gatewayID, model, version string) error {
+	queryText :=
+		`INSERT INTO v3_gateway_firmware (gateway_id, model, version, reported_at)
+		VALUES (?, ?, ?, now())
+		ON DUPLICATE KEY UPDATE
+			model = IF(VALUES(model) = '', model, VALUES(model)),
+			version = VALUES(version), reported_at = now();`
+	if _, err := conn.Db.ExecContext(ctx, queryText, gatewayID, model, version); err != nil {
+		return errors.Wrap(err, "failed to store gateway firmware inventory")
+	}
+	return nil
+}
+
+// activeUpdate describes in-flight gateway update with target version
+type activeUpdate struct {
+	CampaignID uint64 `db:"campaign_id"`
+	Version    string `db:"version"`
+	Status     string `db:"status"`
+}
+
+// getActiveUpdate reads in-flight update of gateway. Returns nil if there is none.
+func getActiveUpdate(ctx context.Context, conn *database.Connection, gatewayID string) (*activeUpdate, error) {
+	queryText :=
+		`SELECT upd.campaign_id, fw.version, upd.status
+		FROM v3_firmware_updates AS upd
+			INNER JOIN v3_firmware_campaigns AS cmp
+				ON cmp.id = upd.campaign_id
+			INNER JOIN v3_firmware AS fw
+				ON fw.id = cmp.firmware_id
+		WHERE upd.gateway_id = ? AND upd.status IN (?, ?, ?)
+		ORDER BY upd.updated_at DESC
+		LIMIT 1;`
+	update := &activeUpdate{}
+	err := conn.Db.GetContext(ctx, update, queryText, gatewayID,
+		UpdateSent, UpdateDownloading, UpdateInstalling)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query active gateway update")
+	}
+	return update, nil
+}
+
+// failStaleUpdates marks in-flight updates not finished in time as failed
+func failStaleUpdates(ctx context.Context, conn *database.Connection, campaignID uint64, timeoutSec int64) error {
+	queryText :=
+		`UPDATE v3_firmware_updates
+		SET status = ?, error = 'timeout', updated_at = now()
+		WHERE campaign_id = ? AND status IN (?, ?, ?)
+			AND updated_at < now() - INTERVAL ? SECOND;`
+	if _, err := conn.Db.ExecContext(ctx, queryText, UpdateFailed, campaignID,
+		UpdateSent, UpdateDownloading, UpdateInstalling, timeoutSec); err != nil {
+		return errors.Wrap(err, "failed to fail stale updates")
+	}
+	return nil
+}
+
+// listPendingGateways returns gateways which updates are not sent yet
+func listPendingGateways(ctx context.Context, conn *database.Connection, campaignID uint64) ([]string, error) {
+	queryText :=
+		`SELECT gateway_id
+		FROM v3_firmware_updates
+		WHERE campaign_id = ? AND status = ?
+		ORDER BY gateway_id;`
+	ids := make([]string, 0)
+	if err := conn.Db.SelectContext(ctx, &ids, queryText, campaignID, UpdatePending); err != nil {
+		return nil, errors.Wrap(err, "failed to query pending updates")
+	}
+	return ids, nil
+}
+
+// campaignDefinition is stored as JSON with campaign
+type campaignDefinition struct {
+	Stages           []int    `json:"stages"`
+	FailureThreshold float64  `json:"failureThreshold"`
+	OwnerID          uint64   `json:"ownerId,omitempty"`
+	FromVersions     []string `json:"fromVersions,omitempty"`
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFirmware(row rowScanner) (*Firmware, error) {
+	fw := &Firmware{}
+	var models string
+	if err := row.Scan(&fw.ID, &fw.Version, &fw.URL, &fw.Checksum,
+		&models, &fw.Notes, &fw.CreatedAt); err != nil {
+		return nil, errors.Wrap(err, "could not read firmware record")
+	}
+	fw.Models = make([]string, 0)
+	if len(models) > 0 {
+		fw.Models = strings.Split(models, ",")
+	}
+	return fw, nil
+}
+
+func scanCampaign(row rowScanner) (*Campaign, error) {
+	campaign := &Campaign{}
+	var definition string
+	if err := row.Scan(&campaign.ID, &campaign.FirmwareID, &campaign.Title, &definition,
+		&campaign.Stage, &campaign.Status, &campaign.Reason,
+		&campaign.CreatedAt, &campaign.UpdatedAt); err != nil {
+		return nil, errors.Wrap(err, "could not read campaign record")
+	}
+	var def campaignDefinition
+	if err := json.Unmarshal([]byte(definition), &def); err != nil {
+		return nil, errors.Wrap(err, "wrong campaign definition")
+	}
+	campaign.Stages = def.Stages
+	campaign.FailureThreshold = def.FailureThreshold
+	campaign.OwnerID = def.OwnerID
+	campaign.FromVersions = def.FromVersions
+	return campaign, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package gatewayconfig
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+)
+
+// Z-Wave device fields changing with every report, they are not compared
+var zwaveVolatileFields = map[string]bool{
+	"value":         true,
+	"lastHeardTime": true,
+}
+
+// FieldChange describes changed value of configuration field
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// DeviceChange holds changed fields of device present in both configurations
+type DeviceChange struct {
+	ID       string        `json:"id,omitempty"`
+	DeviceID string        `json:"deviceId,omitempty"`
+	Changes  []FieldChange `json:"changes"`
+}
+
+// Diff holds field by field difference of two gateway configurations
+type Diff struct {
+	From           int                     `json:"from"`
+	To             int                     `json:"to"`
+	Gateway        []FieldChange           `json:"gateway"`
+	CamerasAdded   []entities.CameraParams `json:"camerasAdded"`
+	CamerasRemoved []entities.CameraParams `json:"camerasRemoved"`
+	CamerasChanged []DeviceChange          `json:"camerasChanged"`
+	ZWaveAdded     []entities.ZWaveParams  `json:"zwaveAdded"`
+	ZWaveRemoved   []entities.ZWaveParams  `json:"zwaveRemoved"`
+	ZWaveChanged   []DeviceChange          `json:"zwaveChanged"`
+}
+
+// Empty checks that configurations are equal
+func (d *Diff) Empty() bool {
+	return len(d.Gateway) == 0 &&
+		len(d.CamerasAdded) == 0 && len(d.CamerasRemoved) == 0 && len(d.CamerasChanged) == 0 &&
+		len(d.ZWaveAdded) == 0 && len(d.ZWaveRemoved) == 0 && len(d.ZWaveChanged) == 0
+}
+
+// Compare makes difference between two configuration versions.
+// Devices are matched by device id or gateway local id if device id is not set.
+func Compare(from, to *Version) *Diff {
+	diff := &Diff{
+		From:           from.Version,
+		To:             to.Version,
+		Gateway:        make([]FieldChange, 0),
+		CamerasAdded:   make([]entities.CameraParams, 0),
+		CamerasRemoved: make([]entities.CameraParams, 0),
+		CamerasChanged: make([]DeviceChange, 0),
+		ZWaveAdded:     make([]entities.ZWaveParams, 0),
+		ZWaveRemoved:   make([]entities.ZWaveParams, 0),
+		ZWaveChanged:   make([]DeviceChange, 0),
+	}
+	if from.Config.Version != to.Config.Version {
+		diff.Gateway = append(diff.Gateway,
+			FieldChange{Field: "version", From: from.Config.Version, To: to.Config.Version})
+	}
+
+	// Compare cameras
+	oldCameras := make(map[string]*entities.CameraParams, len(from.Config.Cameras))
+	for i := range from.Config.Cameras {
+		camera := &from.Config.Cameras[i]
+		oldCameras[deviceKey(camera.DeviceID, camera.ID)] = camera
+	}
+	for i := range to.Config.Cameras {
+		camera := &to.Config.Cameras[i]
+		key := deviceKey(camera.DeviceID, camera.ID)
+		old, ok := oldCameras[key]
+		if !ok {
+			diff.CamerasAdded = append(diff.CamerasAdded, *camera)
+			continue
+		}
+		delete(oldCameras, key)
+		if changes := compareFields(old, camera, nil); len(changes) > 0 {
+			diff.CamerasChanged = append(diff.CamerasChanged,
+				DeviceChange{ID: camera.ID, DeviceID: camera.DeviceID, Changes: changes})
+		}
+	}
+	for i := range from.Config.Cameras {
+		camera := &from.Config.Cameras[i]
+		if _, ok := oldCameras[deviceKey(camera.DeviceID, camera.ID)]; ok {
+			diff.CamerasRemoved = append(diff.CamerasRemoved, *camera)
+		}
+	}
+
+	// Compare Z-Wave devices
+	oldZWave := make(map[string]*entities.ZWaveParams, len(from.Config.ZWave))
+	for i := range from.Config.ZWave {
+		device := &from.Config.ZWave[i]
+		oldZWave[deviceKey(device.DeviceID, device.ID)] = device
+	}
+	for i := range to.Config.ZWave {
+		device := &to.Config.ZWave[i]
+		key := deviceKey(device.DeviceID, device.ID)
+		old, ok := oldZWave[key]
+		if !ok {
+			diff.ZWaveAdded = append(diff.ZWaveAdded, *device)
+			continue
+		}
+		delete(oldZWave, key)
+		if changes := compareFields(old, device, zwaveVolatileFields); len(changes) > 0 {
+			diff.ZWaveChanged = append(diff.ZWaveChanged,
+				DeviceChange{ID: device.ID, DeviceID: device.DeviceID, Changes: changes})
+		}
+	}
+	for i := range from.Config.ZWave {
+		device := &from.Config.ZWave[i]
+		if _, ok := oldZWave[deviceKey(device.DeviceID, device.ID)]; ok {
+			diff.ZWaveRemoved = append(diff.ZWaveRemoved, *device)
+		}
+	}
+	return diff
+}
+
+func deviceKey(deviceID, id string) string {
+	if len(deviceID) > 0 {
+		return deviceID
+	}
+	return "#" + id
+}
+
+// compareFields compares string fields of two structures of the same type.
+// Fields are named by their JSON tags.
+func compareFields(from, to interface{}, skip map[string]bool) []FieldChange {
+	changes := make([]FieldChange, 0)
+	a := reflect.Indirect(reflect.ValueOf(from))
+	b := reflect.Indirect(reflect.ValueOf(to))
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Type.Kind() != reflect.String {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = field.Name
+		}
+		if skip[name] {
+			continue
+		}
+		if oldValue, newValue := a.Field(i).String(), b.Field(i).String(); oldValue != newValue {
+			changes = append(changes, FieldChange{Field: name, From: oldValue, To: newValue})
+		}
+	}
+	return changes
+}
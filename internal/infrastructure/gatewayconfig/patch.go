@@ -0,0 +1,92 @@
+package gatewayconfig
+
+import (
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+)
+
+// CameraFields lists camera configuration fields which can be set remotely
+var CameraFields = []string{"enabled", "motionDetector", "localArchive", "cloudStreamingType"}
+
+// CameraFieldValues holds allowed values of camera fields which can be set remotely
+var CameraFieldValues = map[string][]string{
+	"enabled":            {"on", "off"},
+	"motionDetector":     {"on", "off"},
+	"localArchive":       {"on", "off"},
+	"cloudStreamingType": {"continuous", "motion", "schedule"},
+}
+
+// SettableFields returns values of camera fields which can be set remotely
+func SettableFields(p *entities.CameraParams) map[string]string {
+	return map[string]string{
+		"enabled":            p.Enabled,
+		"motionDetector":     p.MotionDetector,
+		"localArchive":       p.LocalArchive,
+		"cloudStreamingType": p.CloudStreamingType,
+	}
+}
+
+// CameraPatch returns camera identifiers and settable fields only
+func CameraPatch(p *entities.CameraParams) entities.CameraParams {
+	return entities.CameraParams{
+		ID:                 p.ID,
+		DeviceID:           p.DeviceID,
+		Enabled:            p.Enabled,
+		MotionDetector:     p.MotionDetector,
+		LocalArchive:       p.LocalArchive,
+		CloudStreamingType: p.CloudStreamingType,
+	}
+}
+
+// FindCamera looks for camera in configuration by device or gateway local id
+func FindCamera(config *entities.IotMessage, camera *entities.CameraParams) *entities.CameraParams {
+	if config == nil {
+		return nil
+	}
+	for i := range config.Cameras {
+		stored := &config.Cameras[i]
+		if len(camera.DeviceID) > 0 && stored.DeviceID == camera.DeviceID {
+			return stored
+		}
+		if len(camera.DeviceID) == 0 && len(camera.ID) > 0 && stored.ID == camera.ID {
+			return stored
+		}
+	}
+	return nil
+}
+
+// RollbackPatch makes patch restoring settable fields of cameras changed by
+// patch to their values in configuration snapshot
+func RollbackPatch(snapshot *entities.IotMessage, patch []entities.CameraParams) []entities.CameraParams {
+	cameras := make([]entities.CameraParams, 0, len(patch))
+	for i := range patch {
+		stored := FindCamera(snapshot, &patch[i])
+		if stored == nil {
+			continue
+		}
+		cameras = append(cameras, CameraPatch(stored))
+	}
+	return cameras
+}
+
+// EnabledCameras counts cameras enabled in configuration before and after patch
+func EnabledCameras(config *entities.IotMessage, patch []entities.CameraParams) (before, after int) {
+	if config == nil {
+		return 0, 0
+	}
+	for i := range config.Cameras {
+		stored := &config.Cameras[i]
+		enabled := stored.Enabled
+		if stored.Enabled == "on" {
+			before++
+		}
+		for j := range patch {
+			if FindCamera(config, &patch[j]) == stored && len(patch[j].Enabled) > 0 {
+				enabled = patch[j].Enabled
+			}
+		}
+		if enabled == "on" {
+			after++
+		}
+	}
+	return before, after
+}
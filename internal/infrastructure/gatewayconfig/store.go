@@ -0,0 +1,113 @@
+package gatewayconfig
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// Snapshot structure to represent gateway configuration taken before
+// configuration change with the change itself
+type Snapshot struct {
+	ID         uint64                  `json:"id"`
+	GatewayID  string                  `json:"gatewayId"`
+	Config     *entities.IotMessage    `json:"config"`
+	Patch      []entities.CameraParams `json:"patch"`
+	CreatedBy  string                  `json:"createdBy"`
+	CreatedAt  string                  `json:"createdAt"`
+	RolledBack bool                    `json:"rolledBack"`
+}
+
+// SaveSnapshot stores configuration snapshot and sets its id
+func SaveSnapshot(ctx context.Context, conn *database.Connection, snapshot *Snapshot) error {
+	config, err := json.Marshal(snapshot.Config)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal configuration")
+	}
+	patch, err := json.Marshal(snapshot.Patch)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal configuration patch")
+	}
+	queryText :=
+		`INSERT INTO v3_gateway_config_snapshots (gateway_id, config, patch, created_by, rolled_back, created_at)
+		VALUES (?, ?, ?, ?, 0, now());`
+	result, err := conn.Db.ExecContext(ctx, queryText,
+		snapshot.GatewayID, string(config), string(patch), snapshot.CreatedBy)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert configuration snapshot")
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "failed to get configuration snapshot id")
+	}
+	snapshot.ID = uint64(id)
+	return nil
+}
+
+// GetSnapshot reads gateway configuration snapshot by its id.
+// Returns nil if snapshot not found.
+func GetSnapshot(ctx context.Context, conn *database.Connection, gatewayID string, id uint64) (*Snapshot, error) {
+	queryText :=
+		`SELECT id, gateway_id, config, patch, created_by, rolled_back,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at
+		FROM v3_gateway_config_snapshots
+		WHERE gateway_id = ? AND id = ?;`
+	snapshot, err := scanSnapshot(conn.Db.QueryRowContext(ctx, queryText, gatewayID, id))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+// GetLatestSnapshot reads last gateway configuration snapshot not rolled back yet.
+// Returns nil if there is none.
+func GetLatestSnapshot(ctx context.Context, conn *database.Connection, gatewayID string) (*Snapshot, error) {
+	queryText :=
+		`SELECT id, gateway_id, config, patch, created_by, rolled_back,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at
+		FROM v3_gateway_config_snapshots
+		WHERE gateway_id = ? AND rolled_back = 0
+		ORDER BY id DESC
+		LIMIT 1;`
+	snapshot, err := scanSnapshot(conn.Db.QueryRowContext(ctx, queryText, gatewayID))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+// MarkRolledBack marks snapshot which configuration was restored on gateway
+func MarkRolledBack(ctx context.Context, conn *database.Connection, id uint64) error {
+	queryText :=
+		`UPDATE v3_gateway_config_snapshots
+		SET rolled_back = 1
+		WHERE id = ?;`
+	if _, err := conn.Db.ExecContext(ctx, queryText, id); err != nil {
+		return errors.Wrap(err, "failed to update configuration snapshot")
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSnapshot(row rowScanner) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	var config, patch string
+	if err := row.Scan(&snapshot.ID, &snapshot.GatewayID, &config, &patch,
+		&snapshot.CreatedBy, &snapshot.RolledBack, &snapshot.CreatedAt); err != nil {
+		return nil, errors.Wrap(err, "could not read configuration snapshot")
+	}
+	if err := json.Unmarshal([]byte(config), &snapshot.Config); err != nil {
+		return nil, errors.Wrap(err, "wrong configuration snapshot")
+	}
+	if err := json.Unmarshal([]byte(patch), &snapshot.Patch); err != nil {
+		return nil, errors.Wrap(err, "wrong configuration patch")
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,149 @@
+package gatewayconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// Version structure to represent configuration reported by gateway.
+// Versions are numbered for every gateway separately starting from 1.
+type Version struct {
+	GatewayID string               `json:"gatewayId"`
+	Version   int                  `json:"version"`
+	Source    string               `json:"source"`
+	CreatedBy string               `json:"createdBy"`
+	CreatedAt string               `json:"createdAt"`
+	Cameras   int                  `json:"cameras"`
+	ZWave     int                  `json:"zwave"`
+	Config    *entities.IotMessage `json:"config,omitempty"`
+}
+
+// HasConfiguration checks that gateway message carries configuration
+func HasConfiguration(message *entities.IotMessage) bool {
+	return message != nil && (len(message.Cameras) > 0 || len(message.ZWave) > 0)
+}
+
+// saveVersionAttempts limits retries of version insert raced by other server
+const saveVersionAttempts = 3
+
+// mysqlDuplicateEntry is MySQL error number of primary key violation
+const mysqlDuplicateEntry = 1062
+
+// SaveVersion stores configuration reported by gateway as new version.
+// Configuration equal to the last version is not stored again and number
+// of the last version is returned. Version number taken concurrently by
+// other server is detected with primary key and insert is retried.
+func SaveVersion(ctx context.Context, conn *database.Connection, gatewayID string,
+	message *entities.IotMessage, source, createdBy string) (int, error) {
+
+	// Message timestamp differs for every report
+	config := *message
+	config.Timestamp = ""
+	buffer, err := json.Marshal(&config)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to marshal configuration")
+	}
+	sum := sha256.Sum256(buffer)
+	checksum := hex.EncodeToString(sum[:])
+
+	for attempt := 1; ; attempt++ {
+		var (
+			lastVersion  int
+			lastChecksum string
+		)
+		queryText :=
+			`SELECT version, checksum
+			FROM v3_gateway_config_versions
+			WHERE gateway_id = ?
+			ORDER BY version DESC
+			LIMIT 1;`
+		err = conn.Db.QueryRowContext(ctx, queryText, gatewayID).Scan(&lastVersion, &lastChecksum)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, errors.Wrap(err, "failed to query last configuration version")
+		}
+		if err == nil && lastChecksum == checksum {
+			return lastVersion, nil
+		}
+
+		insertQueryText :=
+			`INSERT INTO v3_gateway_config_versions
+				(gateway_id, version, source, config, checksum, cameras, zwave, created_by, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, now());`
+		_, err = conn.Db.ExecContext(ctx, insertQueryText, gatewayID, lastVersion+1, source,
+			string(buffer), checksum, len(config.Cameras), len(config.ZWave), createdBy)
+		if err == nil {
+			return lastVersion + 1, nil
+		}
+		if !isDuplicateEntry(err) || attempt == saveVersionAttempts {
+			return 0, errors.Wrap(err, "failed to insert configuration version")
+		}
+	}
+}
+
+// isDuplicateEntry checks that MySQL rejected insert with existing primary key
+func isDuplicateEntry(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+// ListVersions reads last gateway configuration versions without configuration itself
+func ListVersions(ctx context.Context, conn *database.Connection, gatewayID string, limit int) ([]*Version, error) {
+	queryText :=
+		`SELECT gateway_id, version, source, created_by, cameras, zwave,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at
+		FROM v3_gateway_config_versions
+		WHERE gateway_id = ?
+		ORDER BY version DESC
+		LIMIT ?;`
+	rows, err := conn.Db.QueryContext(ctx, queryText, gatewayID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query configuration versions")
+	}
+	defer func() { _ = rows.Close() }()
+
+	list := make([]*Version, 0)
+	for rows.Next() {
+		version := &Version{}
+		if err := rows.Scan(&version.GatewayID, &version.Version, &version.Source,
+			&version.CreatedBy, &version.Cameras, &version.ZWave, &version.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, "could not read configuration version")
+		}
+		list = append(list, version)
+	}
+	return list, rows.Err()
+}
+
+// GetVersion reads gateway configuration version, the last one if version is 0.
+// Returns nil if version not found.
+func GetVersion(ctx context.Context, conn *database.Connection, gatewayID string, number int) (*Version, error) {
+	queryText :=
+		`SELECT gateway_id, version, source, created_by, cameras, zwave,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at, config
+		FROM v3_gateway_config_versions
+		WHERE gateway_id = ? AND (? = 0 OR version = ?)
+		ORDER BY version DESC
+		LIMIT 1;`
+	version := &Version{}
+	var config string
+	err := conn.Db.QueryRowContext(ctx, queryText, gatewayID, number, number).
+		Scan(&version.GatewayID, &version.Version, &version.Source, &version.CreatedBy,
+			&version.Cameras, &version.ZWave, &version.CreatedAt, &config)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query configuration version")
+	}
+	if err := json.Unmarshal([]byte(config), &version.Config); err != nil {
+		return nil, errors.Wrap(err, "wrong configuration version")
+	}
+	return version, nil
+}
@@ -0,0 +1,203 @@
+package influx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	_ "github.com/influxdata/influxdb1-client" // this is important because of the bug in go mod
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Backend interface for sending batches of points to time-series storage
+type Backend interface {
+	WritePoints(destination string, points []*client.Point) error
+	Close() error
+}
+
+// V1Backend writes points to InfluxDB 1.x databases
+type V1Backend struct {
+	client client.Client
+}
+
+// NewV1Backend creates InfluxDB 1.x HTTP client.
+// TLS config is optional and used for https address.
+func NewV1Backend(addr, username, password string, tlsConfig *tls.Config) (*V1Backend, error) {
+	c, err := client.NewHTTPClient(client.HTTPConfig{
+		Addr:      addr,
+		Username:  username,
+		Password:  password,
+		Timeout:   5 * time.Second,
+		TLSConfig: tlsConfig,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating InfluxDB client")
+	}
+	return &V1Backend{client: c}, nil
+}
+
+// WritePoints sends points to InfluxDB database in one HTTP request
+func (b *V1Backend) WritePoints(database string, points []*client.Point) error {
+	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:  database,
+		Precision: "ms",
+	})
+	if err != nil {
+		return errors.Wrap(err, "error creating batch points")
+	}
+	bp.AddPoints(points)
+
+	if err = b.client.Write(bp); err != nil {
+		return errors.Wrap(err, "error writing batch to InfluxDB")
+	}
+	return nil
+}
+
+// Close releases InfluxDB client
+func (b *V1Backend) Close() error {
+	return b.client.Close()
+}
+
+// V2Backend writes points to InfluxDB 2.x buckets via HTTP API
+type V2Backend struct {
+	addr   string
+	org    string
+	bucket string
+	token  string
+	client *http.Client
+}
+
+// NewV2Backend constructs InfluxDB 2.x backend.
+// Bucket is used for reading sensor history.
+func NewV2Backend(addr, org, bucket, token string, tlsConfig *tls.Config) *V2Backend {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &V2Backend{
+		addr:   addr,
+		org:    org,
+		bucket: bucket,
+		token:  token,
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: transport,
+		},
+	}
+}
+
+// WritePoints sends points to InfluxDB bucket in one HTTP request
+func (b *V2Backend) WritePoints(bucket string, points []*client.Point) error {
+	// Make write URI
+	query := url.Values{}
+	query.Set("org", b.org)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ms")
+	uri := fmt.Sprintf("%s/api/v2/write?%s", b.addr, query.Encode())
+
+	// Create request
+	request, err := http.NewRequest("POST", uri, bytes.NewReader(makeLines(points, "ms")))
+	if err != nil {
+		return errors.Wrap(err, "failed to create http request")
+	}
+	request.Header.Set("Authorization", "Token "+b.token)
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	// Send request
+	resp, err := b.client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "error writing batch to InfluxDB")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("InfluxDB returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// Close does nothing for HTTP backend
+func (b *V2Backend) Close() error {
+	return nil
+}
+
+// LineProtocolBackend writes points in line protocol to file or UDP socket.
+// Mostly used for testing and debugging.
+type LineProtocolBackend struct {
+	mx  sync.Mutex
+	wr  io.WriteCloser
+	udp bool
+}
+
+// NewLineProtocolBackend opens target defined as file:///path/to/file or udp://host:port
+func NewLineProtocolBackend(target string) (*LineProtocolBackend, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "wrong line protocol target")
+	}
+
+	b := &LineProtocolBackend{mx: sync.Mutex{}}
+	switch u.Scheme {
+	case "file", "":
+		b.wr, err = os.OpenFile(u.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed opening line protocol file")
+		}
+	case "udp":
+		b.wr, err = net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed dialing line protocol UDP target")
+		}
+		b.udp = true
+	default:
+		return nil, errors.New("unsupported line protocol target scheme: " + u.Scheme)
+	}
+	return b, nil
+}
+
+// WritePoints writes points as lines. Destination is ignored.
+func (b *LineProtocolBackend) WritePoints(_ string, points []*client.Point) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.udp {
+		// Send one point per datagram to fit packet size
+		for _, pt := range points {
+			if _, err := b.wr.Write([]byte(pt.PrecisionString("ms") + "\n")); err != nil {
+				return errors.Wrap(err, "failed sending line protocol datagram")
+			}
+		}
+		return nil
+	}
+
+	if _, err := b.wr.Write(makeLines(points, "ms")); err != nil {
+		return errors.Wrap(err, "failed writing line protocol file")
+	}
+	return nil
+}
+
+// Close releases file or socket
+func (b *LineProtocolBackend) Close() error {
+	return b.wr.Close()
+}
+
+// makeLines converts points to line protocol buffer
+func makeLines(points []*client.Point, precision string) []byte {
+	var buffer bytes.Buffer
+	for _, pt := range points {
+		buffer.WriteString(pt.PrecisionString(precision))
+		buffer.WriteByte('\n')
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,74 @@
+package influx
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/pkg/errors"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Layout maps sensor message to destination (database or bucket) and point
+type Layout func(message *entities.IotMessage, t time.Time) (string, *client.Point, error)
+
+// DatabaseName returns per-gateway database name used by InfluxDB 1.x layout
+func DatabaseName(gatewayID, deviceType string) string {
+	return "gateway_" + strings.ReplaceAll(gatewayID, "-", "_") + "_" + deviceType + "s"
+}
+
+// MeasurementName returns per-device measurement name used by InfluxDB 1.x layout
+func MeasurementName(deviceID string) string {
+	return "device_" + strings.ReplaceAll(deviceID, "-", "_")
+}
+
+// DatabasePerGatewayLayout stores points in gateway_<id>_<type>s databases
+// with one measurement per device
+func DatabasePerGatewayLayout(message *entities.IotMessage, t time.Time) (string, *client.Point, error) {
+	tags := map[string]string{
+		"class": message.GetSensorType(),
+		"label": message.GetLabel()}
+	if len(message.Units) != 0 {
+		tags["units"] = message.Units
+	}
+
+	pt, err := client.NewPoint(MeasurementName(message.DeviceId), tags, makeFields(message), t)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error creating new point")
+	}
+	return DatabaseName(message.GatewayId, message.DeviceType), pt, nil
+}
+
+// TaggedLayout returns layout storing all points in one bucket with
+// gateway and device tags instead of per-gateway databases
+func TaggedLayout(bucket string) Layout {
+	return func(message *entities.IotMessage, t time.Time) (string, *client.Point, error) {
+		tags := map[string]string{
+			"gateway": message.GatewayId,
+			"device":  message.DeviceId,
+			"class":   message.GetSensorType(),
+			"label":   message.GetLabel()}
+		if len(message.Units) != 0 {
+			tags["units"] = message.Units
+		}
+
+		pt, err := client.NewPoint(message.DeviceType+"s", tags, makeFields(message), t)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "error creating new point")
+		}
+		return bucket, pt, nil
+	}
+}
+
+// makeFields stores numeric sensor values as float field and others as string
+func makeFields(message *entities.IotMessage) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if floatValue, err := strconv.ParseFloat(message.SensorData, 64); err != nil {
+		fields["value"] = message.SensorData
+	} else {
+		fields["value_float"] = floatValue
+	}
+	return fields
+}
@@ -0,0 +1,177 @@
+package influx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/pkg/errors"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Querier interface for backends able to read sensor history
+type Querier interface {
+	QueryHistory(query *entities.SensorHistoryQuery) ([]entities.SensorHistoryPoint, error)
+}
+
+// QueryHistory reads aggregated sensor values from InfluxDB 1.x database
+func (b *V1Backend) QueryHistory(query *entities.SensorHistoryQuery) ([]entities.SensorHistoryPoint, error) {
+	command := fmt.Sprintf(
+		`SELECT %s("value_float") FROM "%s" WHERE "label" = $label AND time >= %d AND time < %d GROUP BY time(%ds) fill(none)`,
+		query.Aggregate,
+		MeasurementName(query.DeviceID),
+		query.From.UnixNano(),
+		query.To.UnixNano(),
+		int64(query.Step/time.Second))
+	q := client.NewQueryWithParameters(
+		command,
+		DatabaseName(query.GatewayID, query.DeviceType),
+		"ms",
+		map[string]interface{}{"label": query.Label})
+
+	resp, err := b.client.Query(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying InfluxDB")
+	}
+	if err = resp.Error(); err != nil {
+		return nil, errors.Wrap(err, "InfluxDB returned query error")
+	}
+
+	points := make([]entities.SensorHistoryPoint, 0)
+	for _, result := range resp.Results {
+		for _, row := range result.Series {
+			for _, values := range row.Values {
+				if len(values) < 2 || values[0] == nil || values[1] == nil {
+					continue
+				}
+				ts, err := values[0].(json.Number).Int64()
+				if err != nil {
+					return nil, errors.Wrap(err, "wrong timestamp in query result")
+				}
+				value, err := values[1].(json.Number).Float64()
+				if err != nil {
+					return nil, errors.Wrap(err, "wrong value in query result")
+				}
+				points = append(points, entities.SensorHistoryPoint{Timestamp: ts, Value: value})
+			}
+		}
+	}
+	return points, nil
+}
+
+// QueryHistory reads aggregated sensor values from InfluxDB 2.x bucket with Flux query
+func (b *V2Backend) QueryHistory(query *entities.SensorHistoryQuery) ([]entities.SensorHistoryPoint, error) {
+	flux := fmt.Sprintf(`from(bucket: %s)
+	|> range(start: %s, stop: %s)
+	|> filter(fn: (r) => r._measurement == %s and r.device == %s and r.label == %s and r._field == "value_float")
+	|> aggregateWindow(every: %ds, fn: %s, createEmpty: false)
+	|> keep(columns: ["_time", "_value"])`,
+		fluxString(b.bucket),
+		query.From.UTC().Format(time.RFC3339),
+		query.To.UTC().Format(time.RFC3339),
+		fluxString(query.DeviceType+"s"),
+		fluxString(query.DeviceID),
+		fluxString(query.Label),
+		int64(query.Step/time.Second),
+		query.Aggregate)
+
+	// Create request body
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"query": flux,
+		"type":  "flux",
+		"dialect": map[string]interface{}{
+			"header":      true,
+			"annotations": []string{},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not marshal request body")
+	}
+
+	// Create request
+	uri := fmt.Sprintf("%s/api/v2/query?org=%s", b.addr, url.QueryEscape(b.org))
+	request, err := http.NewRequest("POST", uri, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+	request.Header.Set("Authorization", "Token "+b.token)
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set("Accept", "application/csv")
+
+	// Send request
+	resp, err := b.client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying InfluxDB")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("InfluxDB returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return parseFluxCSV(resp.Body)
+}
+
+// parseFluxCSV reads _time and _value columns from Flux CSV response
+func parseFluxCSV(r io.Reader) ([]entities.SensorHistoryPoint, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	points := make([]entities.SensorHistoryPoint, 0)
+	timeIdx, valueIdx := -1, -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading query result")
+		}
+
+		// Every table in response starts with header
+		if timeIdx < 0 || valueIdx < 0 || (timeIdx < len(record) && record[timeIdx] == "_time") {
+			for i, column := range record {
+				switch column {
+				case "_time":
+					timeIdx = i
+				case "_value":
+					valueIdx = i
+				}
+			}
+			continue
+		}
+		if timeIdx >= len(record) || valueIdx >= len(record) {
+			continue
+		}
+
+		ts, err := time.Parse(time.RFC3339Nano, record[timeIdx])
+		if err != nil {
+			return nil, errors.Wrap(err, "wrong timestamp in query result")
+		}
+		value, err := strconv.ParseFloat(record[valueIdx], 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "wrong value in query result")
+		}
+		points = append(points, entities.SensorHistoryPoint{
+			Timestamp: ts.UnixNano() / int64(time.Millisecond),
+			Value:     value,
+		})
+	}
+	return points, nil
+}
+
+// fluxString makes quoted Flux string literal
+func fluxString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(s) + `"`
+}
@@ -0,0 +1,92 @@
+package influx
+
+import (
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+)
+
+// Backend types supported by sensor sink
+const (
+	BackendInfluxV1     = "influx1"
+	BackendInfluxV2     = "influx2"
+	BackendLineProtocol = "lineprotocol"
+)
+
+// Sink stores sensor messages through buffered writer using backend layout
+type Sink struct {
+	writer  *Writer
+	layout  Layout
+	querier Querier
+}
+
+// NewSensorSink creates backend and layout defined by configuration
+// and returns started sensor sink
+func NewSensorSink(cfg Config) (interfaces.SensorSink, error) {
+	var (
+		backend Backend
+		layout  Layout
+		err     error
+	)
+	switch cfg.Backend {
+	case BackendInfluxV1, "":
+		backend, err = NewV1Backend(cfg.Addr, cfg.Username, cfg.Password, cfg.TLSConfig)
+		layout = DatabasePerGatewayLayout
+	case BackendInfluxV2:
+		backend = NewV2Backend(cfg.Addr, cfg.Org, cfg.Bucket, cfg.Token, cfg.TLSConfig)
+		layout = TaggedLayout(cfg.Bucket)
+	case BackendLineProtocol:
+		backend, err = NewLineProtocolBackend(cfg.Target)
+		layout = TaggedLayout(BackendLineProtocol)
+	default:
+		return nil, errors.New("unknown sensor sink backend: " + cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := NewWriter(backend, cfg)
+	if err != nil {
+		_ = backend.Close()
+		return nil, err
+	}
+	writer.Start()
+
+	// Not every backend is able to read history
+	querier, _ := backend.(Querier)
+
+	logger.Info("Sensor sink started", "backend", cfg.Backend)
+	return &Sink{
+		writer:  writer,
+		layout:  layout,
+		querier: querier,
+	}, nil
+}
+
+// Store converts message to point and adds it to writer buffer.
+// Written callback is called after point is written to backend or spooled.
+func (s *Sink) Store(message *entities.IotMessage, written func()) error {
+	destination, pt, err := s.layout(message, time.Now())
+	if err != nil {
+		return err
+	}
+	logger.Debug("New point value", "value", pt, "destination", destination, "caller", "Sink")
+	s.writer.Write(destination, pt, written)
+	return nil
+}
+
+// QueryHistory reads aggregated sensor values from backend
+func (s *Sink) QueryHistory(query *entities.SensorHistoryQuery) ([]entities.SensorHistoryPoint, error) {
+	if s.querier == nil {
+		return nil, errors.New("sensor history is not supported by backend")
+	}
+	return s.querier.QueryHistory(query)
+}
+
+// Close drains buffered points and releases backend
+func (s *Sink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,227 @@
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	spoolFileExt   = ".lp"
+	spoolOffsetExt = ".offset"
+)
+
+// ErrSpoolFull is returned when spool file reached its size limit
+var ErrSpoolFull = errors.New("spool file size limit reached")
+
+// Spool keeps undelivered points on disk in line protocol format,
+// one file per destination (database or bucket). Replayed part of file
+// is tracked with offset stored next to it, so points written to backend
+// are never replayed again.
+type Spool struct {
+	mx       sync.Mutex
+	replayMx sync.Mutex
+	dir      string
+	maxSize  int64
+}
+
+// NewSpool creates spool directory if needed and returns spool object.
+// Pending (not replayed) data of every destination is limited by maxSize bytes.
+func NewSpool(dir string, maxSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, errors.Wrap(err, "failed creating spool directory")
+	}
+	return &Spool{
+		mx:       sync.Mutex{},
+		replayMx: sync.Mutex{},
+		dir:      dir,
+		maxSize:  maxSize,
+	}, nil
+}
+
+// Append writes points to the end of destination spool file
+func (s *Spool) Append(destination string, points []*client.Point) error {
+	var buffer bytes.Buffer
+	for _, pt := range points {
+		buffer.WriteString(pt.String())
+		buffer.WriteByte('\n')
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	fileName := s.fileName(destination)
+	if s.maxSize > 0 {
+		var size int64
+		if fi, err := os.Stat(fileName); err == nil {
+			size = fi.Size()
+		}
+		if size-s.readOffset(destination)+int64(buffer.Len()) > s.maxSize {
+			return ErrSpoolFull
+		}
+	}
+
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return errors.Wrap(err, "failed opening spool file")
+	}
+	if _, err = f.Write(buffer.Bytes()); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed writing spool file")
+	}
+	return f.Close()
+}
+
+// Replay reads spooled points and writes them with passed function in batches.
+// Spool lock is not held while writing, so points could be appended meanwhile.
+// Offset is advanced after every written batch and spool file is removed
+// after all its points are written.
+func (s *Spool) Replay(batchSize int, write func(destination string, points []*client.Point) error) error {
+	s.replayMx.Lock()
+	defer s.replayMx.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed reading spool directory")
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), spoolFileExt) {
+			continue
+		}
+		if err = s.replayFile(strings.TrimSuffix(fi.Name(), spoolFileExt), batchSize, write); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Spool) replayFile(destination string, batchSize int, write func(destination string, points []*client.Point) error) error {
+	fileName := s.fileName(destination)
+
+	// Take size and offset under lock to read completely appended lines only
+	s.mx.Lock()
+	fi, err := os.Stat(fileName)
+	offset := s.readOffset(destination)
+	s.mx.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed reading spool file")
+	}
+	if offset > fi.Size() {
+		offset = 0
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrap(err, "failed opening spool file")
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed seeking spool file")
+	}
+	reader := bufio.NewReader(io.LimitReader(f, fi.Size()-offset))
+
+	for {
+		// Read next batch of lines
+		var (
+			batch bytes.Buffer
+			lines int
+		)
+		for lines < batchSize {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				batch.Write(line)
+				lines++
+			}
+			if err != nil {
+				break
+			}
+		}
+		if lines == 0 {
+			break
+		}
+
+		// Write batch, corrupted batch is skipped to not block spool forever
+		parsed, err := models.ParsePoints(batch.Bytes())
+		if err != nil {
+			logger.Error("error parsing spooled points, batch skipped", "error", err,
+				"destination", destination, "caller", "Spool")
+		} else {
+			points := make([]*client.Point, 0, len(parsed))
+			for _, pt := range parsed {
+				points = append(points, client.NewPointFrom(pt))
+			}
+			if err = write(destination, points); err != nil {
+				// Rest of file is replayed next time
+				return err
+			}
+		}
+
+		offset += int64(batch.Len())
+		s.mx.Lock()
+		err = s.writeOffset(destination, offset)
+		s.mx.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove file if nothing was appended while replaying
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if fi, err = os.Stat(fileName); err != nil || fi.Size() > offset {
+		return nil
+	}
+	if err = os.Remove(fileName); err != nil {
+		return errors.Wrap(err, "failed removing spool file")
+	}
+	_ = os.Remove(s.offsetName(destination))
+	return nil
+}
+
+// readOffset returns replayed part of destination spool file
+func (s *Spool) readOffset(destination string) int64 {
+	buffer, err := ioutil.ReadFile(s.offsetName(destination))
+	if err != nil {
+		return 0
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(buffer)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+func (s *Spool) writeOffset(destination string, offset int64) error {
+	tmpName := s.offsetName(destination) + ".tmp"
+	if err := ioutil.WriteFile(tmpName, []byte(strconv.FormatInt(offset, 10)), 0640); err != nil {
+		return errors.Wrap(err, "failed writing spool offset")
+	}
+	if err := os.Rename(tmpName, s.offsetName(destination)); err != nil {
+		return errors.Wrap(err, "failed writing spool offset")
+	}
+	return nil
+}
+
+func (s *Spool) fileName(destination string) string {
+	return filepath.Join(s.dir, destination+spoolFileExt)
+}
+
+func (s *Spool) offsetName(destination string) string {
+	return filepath.Join(s.dir, destination+spoolFileExt+spoolOffsetExt)
+}
@@ -0,0 +1,223 @@
+package influx
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Config holds parameters for sensor sink backend and buffered writer
+type Config struct {
+	Backend       string
+	Addr          string
+	Username      string
+	Password      string
+	Org           string
+	Bucket        string
+	Token         string
+	Target        string
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxRetries    int
+	RetryBackoff  time.Duration
+	SpoolDir      string
+	SpoolMaxSize  int64
+	TLSConfig     *tls.Config
+}
+
+// bufferedPoint is point waiting for flush with callback
+// to be called after point is persisted
+type bufferedPoint struct {
+	pt      *client.Point
+	written func()
+}
+
+// Writer keeps long-lived backend and buffers points per destination.
+// Buffered points are written when batch size is reached or flush interval elapsed.
+type Writer struct {
+	cfg     Config
+	backend Backend
+	spool   *Spool
+	mx      sync.Mutex
+	buffers map[string][]bufferedPoint
+	flushCh chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewWriter constructs Writer structure for backend
+func NewWriter(backend Backend, cfg Config) (*Writer, error) {
+	// Set defaults for missing params
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+	if cfg.SpoolMaxSize <= 0 {
+		cfg.SpoolMaxSize = 64 << 20
+	}
+
+	// Create spool for points which could not be delivered
+	var (
+		spool *Spool
+		err   error
+	)
+	if len(cfg.SpoolDir) > 0 {
+		spool, err = NewSpool(cfg.SpoolDir, cfg.SpoolMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Writer{
+		cfg:     cfg,
+		backend: backend,
+		spool:   spool,
+		mx:      sync.Mutex{},
+		buffers: make(map[string][]bufferedPoint),
+		flushCh: make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start makes separate goroutine for flushing buffered points
+func (w *Writer) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.cfg.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.ctx.Done():
+				// Drain buffers before exit
+				w.flush()
+				return
+			case <-ticker.C:
+				w.flush()
+			case <-w.flushCh:
+				w.flush()
+			}
+		}
+	}()
+}
+
+// Write adds point to destination buffer and
+// wakes flushing goroutine up when batch is full.
+// Written callback is called after point is written to backend
+// or spooled to disk to be replayed, it is not called for dropped point.
+func (w *Writer) Write(destination string, pt *client.Point, written func()) {
+	w.mx.Lock()
+	w.buffers[destination] = append(w.buffers[destination], bufferedPoint{pt: pt, written: written})
+	full := len(w.buffers[destination]) >= w.cfg.BatchSize
+	w.mx.Unlock()
+
+	if full {
+		select {
+		case w.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close stops flushing goroutine, drains buffers and releases backend
+func (w *Writer) Close() error {
+	w.cancel()
+	w.wg.Wait()
+
+	if err := w.backend.Close(); err != nil {
+		return errors.Wrap(err, "failed closing sensor sink backend")
+	}
+	return nil
+}
+
+// flush writes all buffered points to backend
+func (w *Writer) flush() {
+	// Swap buffers to release lock as soon as possible
+	w.mx.Lock()
+	buffers := w.buffers
+	w.buffers = make(map[string][]bufferedPoint)
+	w.mx.Unlock()
+
+	delivered := true
+	for destination, buffered := range buffers {
+		if len(buffered) == 0 {
+			continue
+		}
+		points := make([]*client.Point, 0, len(buffered))
+		for _, bp := range buffered {
+			points = append(points, bp.pt)
+		}
+		if err := w.writeWithRetry(destination, points); err != nil {
+			delivered = false
+			logger.Error("error writing points to backend", "error", err,
+				"destination", destination, "points", len(points), "caller", "Writer")
+			if !w.spill(destination, points) {
+				continue
+			}
+		}
+		for _, bp := range buffered {
+			if bp.written != nil {
+				bp.written()
+			}
+		}
+	}
+
+	// Replay spooled points when backend is reachable again
+	if delivered && len(buffers) > 0 && w.spool != nil {
+		if err := w.spool.Replay(w.cfg.BatchSize, w.backend.WritePoints); err != nil {
+			logger.Error("error replaying spooled points", "error", err, "caller", "Writer")
+		}
+	}
+}
+
+// writeWithRetry tries to write batch several times with exponential backoff.
+// Retries are skipped while writer is shutting down.
+func (w *Writer) writeWithRetry(destination string, points []*client.Point) error {
+	backoff := w.cfg.RetryBackoff
+	err := w.backend.WritePoints(destination, points)
+	for attempt := 0; err != nil && attempt < w.cfg.MaxRetries; attempt++ {
+		select {
+		case <-w.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = w.backend.WritePoints(destination, points)
+	}
+	return err
+}
+
+// spill stores undelivered points on disk or drops them if no spool defined.
+// Returns true if points are spooled.
+func (w *Writer) spill(destination string, points []*client.Point) bool {
+	if w.spool == nil {
+		logger.Warn("No spool defined, points dropped",
+			"destination", destination, "points", len(points), "caller", "Writer")
+		return false
+	}
+	err := w.spool.Append(destination, points)
+	if err == ErrSpoolFull {
+		logger.Warn("Spool is full, points dropped",
+			"destination", destination, "points", len(points), "caller", "Writer")
+	} else if err != nil {
+		logger.Error("error spooling points to disk", "error", err,
+			"destination", destination, "points", len(points), "caller", "Writer")
+	}
+	return err == nil
+}
@@ -0,0 +1,229 @@
+package metering
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/spf13/viper"
+)
+
+// Config holds parameters of usage metering
+type Config struct {
+	// FlushInterval is period of writing usage to database. Open intervals
+	// are accounted up to flush time, so long recordings get into every day.
+	FlushInterval time.Duration
+}
+
+// intervalKey identifies open interval of device
+type intervalKey struct {
+	kind     string
+	userID   uint64
+	deviceID string
+}
+
+// dayKey identifies daily usage of device
+type dayKey struct {
+	userID   uint64
+	deviceID string
+	day      string
+}
+
+// openInterval is usage interval accounted up to checkpoint
+type openInterval struct {
+	startedAt  time.Time
+	checkpoint time.Time
+}
+
+// Meter keeps open recording and streaming intervals and sensor points
+// counters and writes them to database as daily usage of user devices
+type Meter struct {
+	conn      *database.Connection
+	cfg       Config
+	mx        sync.Mutex
+	open      map[intervalKey]*openInterval
+	daily     map[dayKey]*DailyUsage
+	intervals []Interval
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewMeter constructs Meter structure
+func NewMeter(conn *database.Connection, cfg Config) *Meter {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Minute
+	}
+	return &Meter{
+		conn:  conn,
+		cfg:   cfg,
+		open:  make(map[intervalKey]*openInterval),
+		daily: make(map[dayKey]*DailyUsage),
+		done:  make(chan struct{}),
+	}
+}
+
+// Start writing usage to database periodically
+func (m *Meter) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				if err := m.Flush(); err != nil {
+					logger.Error("failed storing usage, retry later", "error", err, "caller", "Meter")
+				}
+			}
+		}
+	}()
+}
+
+// Close open intervals and write usage left to database
+func (m *Meter) Close() error {
+	close(m.done)
+	m.wg.Wait()
+
+	m.mx.Lock()
+	now := timeNow()
+	for key, i := range m.open {
+		m.closeInterval(key, i, now)
+	}
+	m.open = make(map[intervalKey]*openInterval)
+	m.mx.Unlock()
+
+	return m.Flush()
+}
+
+// Begin opens usage interval of device, opened one is kept
+func (m *Meter) Begin(kind string, userID uint64, deviceID string) {
+	if userID == 0 || len(deviceID) == 0 {
+		return
+	}
+	key := intervalKey{kind: kind, userID: userID, deviceID: deviceID}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if _, ok := m.open[key]; ok {
+		return
+	}
+	now := timeNow()
+	m.open[key] = &openInterval{startedAt: now, checkpoint: now}
+}
+
+// End closes usage interval of device if opened
+func (m *Meter) End(kind string, userID uint64, deviceID string) {
+	key := intervalKey{kind: kind, userID: userID, deviceID: deviceID}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	i, ok := m.open[key]
+	if !ok {
+		return
+	}
+	delete(m.open, key)
+	m.closeInterval(key, i, timeNow())
+}
+
+// Count adds number of used items, e.g. stored sensor points
+func (m *Meter) Count(kind string, userID uint64, deviceID string, n int64) {
+	if kind != entities.UsageSensorPoints || userID == 0 || len(deviceID) == 0 {
+		return
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.usage(userID, deviceID, timeNow().Format(DayLayout)).SensorPoints += n
+}
+
+// Flush accounts open intervals up to now and writes usage to database.
+// Usage is kept for next flush if database fails.
+func (m *Meter) Flush() error {
+	m.mx.Lock()
+	now := timeNow()
+	for key, i := range m.open {
+		m.account(key, i.checkpoint, now)
+		i.checkpoint = now
+	}
+	daily, intervals := m.daily, m.intervals
+	m.daily, m.intervals = make(map[dayKey]*DailyUsage), nil
+	m.mx.Unlock()
+
+	if len(daily) == 0 && len(intervals) == 0 {
+		return nil
+	}
+	list := make([]*DailyUsage, 0, len(daily))
+	for _, u := range daily {
+		list = append(list, u)
+	}
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	if err := storeUsage(ctx, m.conn, intervals, list); err != nil {
+		m.restore(daily, intervals)
+		return err
+	}
+	return nil
+}
+
+// closeInterval accounts interval rest and keeps it for writing.
+// Must be called under lock.
+func (m *Meter) closeInterval(key intervalKey, i *openInterval, now time.Time) {
+	m.account(key, i.checkpoint, now)
+	m.intervals = append(m.intervals, Interval{
+		UserID:    key.userID,
+		DeviceID:  key.deviceID,
+		Kind:      key.kind,
+		StartedAt: i.startedAt,
+		EndedAt:   now,
+	})
+}
+
+// account adds interval duration to daily usage splitting it at midnight.
+// Must be called under lock.
+func (m *Meter) account(key intervalKey, from, to time.Time) {
+	for from.Before(to) {
+		year, month, day := from.Date()
+		end := time.Date(year, month, day+1, 0, 0, 0, 0, from.Location())
+		if to.Before(end) {
+			end = to
+		}
+		m.usage(key.userID, key.deviceID, from.Format(DayLayout)).
+			addSeconds(key.kind, int64(end.Sub(from)/time.Second))
+		from = end
+	}
+}
+
+// usage returns pending daily usage of device. Must be called under lock.
+func (m *Meter) usage(userID uint64, deviceID, day string) *DailyUsage {
+	key := dayKey{userID: userID, deviceID: deviceID, day: day}
+	u, ok := m.daily[key]
+	if !ok {
+		u = &DailyUsage{Day: day, UserID: userID, DeviceID: deviceID}
+		m.daily[key] = u
+	}
+	return u
+}
+
+// restore returns usage not written to database to pending one
+func (m *Meter) restore(daily map[dayKey]*DailyUsage, intervals []Interval) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for key, u := range daily {
+		m.usage(key.userID, key.deviceID, key.day).add(u)
+	}
+	m.intervals = append(intervals, m.intervals...)
+}
+
+// timeNow returns local time truncated to seconds usage is metered with
+func timeNow() time.Time {
+	return time.Now().Local().Truncate(time.Second)
+}
@@ -0,0 +1,159 @@
+package metering
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// DayLayout is format of usage day
+const DayLayout = "2006-01-02"
+
+// dateTimeLayout is format of MySQL DATETIME values in server local time
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+// DailyUsage structure to represent usage of user device during one day
+type DailyUsage struct {
+	Day              string `json:"day" db:"day"`
+	UserID           uint64 `json:"userId" db:"user_id"`
+	DeviceID         string `json:"deviceId" db:"device_id"`
+	RecordingSeconds int64  `json:"recordingSeconds" db:"recording_seconds"`
+	StreamingSeconds int64  `json:"streamingSeconds" db:"streaming_seconds"`
+	SensorPoints     int64  `json:"sensorPoints" db:"sensor_points"`
+}
+
+// Interval structure to represent closed recording or streaming interval of device
+type Interval struct {
+	UserID    uint64
+	DeviceID  string
+	Kind      string
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// DeviceUsage structure to represent device usage summed up for report period
+type DeviceUsage struct {
+	UserID         uint64  `json:"userId"`
+	DeviceID       string  `json:"deviceId"`
+	RecordingHours float64 `json:"recordingHours"`
+	StreamingHours float64 `json:"streamingHours"`
+	SensorPoints   int64   `json:"sensorPoints"`
+}
+
+// add sums up usage of other day
+func (u *DailyUsage) add(other *DailyUsage) {
+	u.RecordingSeconds += other.RecordingSeconds
+	u.StreamingSeconds += other.StreamingSeconds
+	u.SensorPoints += other.SensorPoints
+}
+
+// addSeconds adds interval duration of usage kind
+func (u *DailyUsage) addSeconds(kind string, seconds int64) {
+	switch kind {
+	case entities.UsageRecording:
+		u.RecordingSeconds += seconds
+	case entities.UsageStreaming:
+		u.StreamingSeconds += seconds
+	}
+}
+
+// storeUsage writes closed intervals and adds daily usage to stored one
+// in single transaction, so usage is either stored or kept for retry
+func storeUsage(ctx context.Context, conn *database.Connection, intervals []Interval, daily []*DailyUsage) error {
+	tx, err := conn.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin usage transaction")
+	}
+
+	intervalQueryText :=
+		`INSERT INTO v3_usage_intervals (user_id, device_id, kind, started_at, ended_at)
+		VALUES (?, ?, ?, ?, ?);`
+	for _, i := range intervals {
+		if _, err = tx.ExecContext(ctx, intervalQueryText, i.UserID, i.DeviceID, i.Kind,
+			i.StartedAt.Format(dateTimeLayout), i.EndedAt.Format(dateTimeLayout)); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrap(err, "failed to insert usage interval")
+		}
+	}
+
+	dailyQueryText :=
+		`INSERT INTO v3_usage_daily (user_id, device_id, day, recording_seconds, streaming_seconds, sensor_points)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			recording_seconds = recording_seconds + VALUES(recording_seconds),
+			streaming_seconds = streaming_seconds + VALUES(streaming_seconds),
+			sensor_points = sensor_points + VALUES(sensor_points);`
+	for _, u := range daily {
+		if _, err = tx.ExecContext(ctx, dailyQueryText, u.UserID, u.DeviceID, u.Day,
+			u.RecordingSeconds, u.StreamingSeconds, u.SensorPoints); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrap(err, "failed to update daily usage")
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit usage transaction")
+}
+
+// ListDailyUsage reads daily usage for days range including both ends.
+// Usage of all users is read for zero user id.
+func ListDailyUsage(ctx context.Context, conn *database.Connection, userID uint64, from, to string) ([]DailyUsage, error) {
+	queryText :=
+		`SELECT DATE_FORMAT(day, '%Y-%m-%d') AS day, user_id, device_id,
+			recording_seconds, streaming_seconds, sensor_points
+		FROM v3_usage_daily
+		WHERE day >= ? AND day <= ? AND (? = 0 OR user_id = ?)
+		ORDER BY user_id, day, device_id;`
+	list := make([]DailyUsage, 0)
+	if err := conn.Db.SelectContext(ctx, &list, queryText, from, to, userID, userID); err != nil {
+		return nil, errors.Wrap(err, "failed to query daily usage")
+	}
+	return list, nil
+}
+
+// Summarize sums up daily usage of every device ordered by user and device id
+func Summarize(daily []DailyUsage) []DeviceUsage {
+	type deviceKey struct {
+		userID   uint64
+		deviceID string
+	}
+	totals := make(map[deviceKey]*DailyUsage)
+	keys := make([]deviceKey, 0)
+	for i := range daily {
+		key := deviceKey{daily[i].UserID, daily[i].DeviceID}
+		total, ok := totals[key]
+		if !ok {
+			total = &DailyUsage{}
+			totals[key] = total
+			keys = append(keys, key)
+		}
+		total.add(&daily[i])
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].userID != keys[j].userID {
+			return keys[i].userID < keys[j].userID
+		}
+		return keys[i].deviceID < keys[j].deviceID
+	})
+
+	list := make([]DeviceUsage, 0, len(keys))
+	for _, key := range keys {
+		total := totals[key]
+		list = append(list, DeviceUsage{
+			UserID:         key.userID,
+			DeviceID:       key.deviceID,
+			RecordingHours: Hours(total.RecordingSeconds),
+			StreamingHours: Hours(total.StreamingSeconds),
+			SensorPoints:   total.SensorPoints,
+		})
+	}
+	return list
+}
+
+// Hours converts seconds to hours
+func Hours(seconds int64) float64 {
+	return float64(seconds) / 3600
+}
@@ -0,0 +1,183 @@
+package playback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// URL signing schemes
+const (
+	SigningNone  = "none"
+	SigningWowza = "wowza"
+	SigningHMAC  = "hmac"
+)
+
+// Query parameters of generic HMAC scheme
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+// Config holds parameters for signing playback URLs
+type Config struct {
+	Signing string
+	Secret  string
+	// TokenPrefix is prefix of Wowza SecureToken query parameters
+	TokenPrefix string
+	// HashAlgorithm of Wowza SecureToken: sha256, sha384 or sha512
+	HashAlgorithm string
+	// BindClientIP makes signed URL valid for client address only
+	BindClientIP bool
+	TTL          time.Duration
+	Templates    Templates
+}
+
+// SignedURL structure to represent playback URL with its expiration time
+type SignedURL struct {
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Signer makes time-limited playback URLs compatible with Wowza SecureToken
+// or signed with generic HMAC scheme for other media servers
+type Signer struct {
+	cfg     Config
+	newHash func() hash.Hash
+}
+
+// NewSigner constructs Signer structure and checks its parameters
+func NewSigner(cfg Config) (*Signer, error) {
+	// Set defaults for missing params
+	if len(cfg.Signing) == 0 {
+		cfg.Signing = SigningNone
+	}
+	if len(cfg.TokenPrefix) == 0 {
+		cfg.TokenPrefix = "wowzatoken"
+	}
+	if len(cfg.HashAlgorithm) == 0 {
+		cfg.HashAlgorithm = "sha256"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 2 * time.Hour
+	}
+
+	s := &Signer{cfg: cfg}
+	switch cfg.HashAlgorithm {
+	case "sha256":
+		s.newHash = sha256.New
+	case "sha384":
+		s.newHash = sha512.New384
+	case "sha512":
+		s.newHash = sha512.New
+	default:
+		return nil, errors.New("unsupported hash algorithm: " + cfg.HashAlgorithm)
+	}
+	switch cfg.Signing {
+	case SigningNone:
+	case SigningWowza, SigningHMAC:
+		if len(cfg.Secret) == 0 {
+			return nil, errors.New("no secret defined for playback URL signing")
+		}
+	default:
+		return nil, errors.New("unsupported playback URL signing: " + cfg.Signing)
+	}
+	return s, nil
+}
+
+// Sign adds token valid for configured time to playback URL. Client IP
+// is bound to token if configured and known.
+func (s *Signer) Sign(rawURL, clientIP string) (*SignedURL, error) {
+	if s.cfg.Signing == SigningNone {
+		return &SignedURL{URL: rawURL}, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse playback URL")
+	}
+	if !s.cfg.BindClientIP {
+		clientIP = ""
+	}
+	expiresAt := time.Now().Add(s.cfg.TTL).Truncate(time.Second)
+	query := u.Query()
+	switch s.cfg.Signing {
+	case SigningWowza:
+		s.signWowza(u.Path, query, expiresAt, clientIP)
+	case SigningHMAC:
+		s.signHMAC(u.Path, query, expiresAt, clientIP)
+	}
+	u.RawQuery = query.Encode()
+	return &SignedURL{URL: u.String(), ExpiresAt: &expiresAt}, nil
+}
+
+// Live makes signed camera live stream URL of requested format
+func (s *Signer) Live(format, mediaserverIP, applicationName, deviceID, clientIP string) (*SignedURL, error) {
+	rawURL, err := s.cfg.Templates.LiveURL(format, mediaserverIP, applicationName, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(rawURL, clientIP)
+}
+
+// signWowza makes Wowza SecureToken (version 2) query parameters. Hash is made
+// of content path and alphabetically sorted token parameters, shared secret and
+// client IP.
+func (s *Signer) signWowza(path string, query url.Values, expiresAt time.Time, clientIP string) {
+	prefix := s.cfg.TokenPrefix
+	query.Set(prefix+"endtime", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Del(prefix + "hash")
+
+	params := []string{s.cfg.Secret}
+	if len(clientIP) > 0 {
+		params = append(params, clientIP)
+	}
+	for name, values := range query {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, name+"="+value)
+		}
+	}
+	sort.Strings(params)
+
+	h := s.newHash()
+	h.Write([]byte(wowzaContentPath(path) + "?" + strings.Join(params, "&")))
+	query.Set(prefix+"hash", base64.URLEncoding.EncodeToString(h.Sum(nil)))
+}
+
+// signHMAC makes expires and signature query parameters, signature is
+// hex-encoded HMAC-SHA256 of URL path, expiration time and client IP
+func (s *Signer) signHMAC(path string, query url.Values, expiresAt time.Time, clientIP string) {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query.Set(ExpiresParam, expires)
+	query.Del(SignatureParam)
+
+	mac := hmac.New(sha256.New, []byte(s.cfg.Secret))
+	mac.Write([]byte(path + "\n" + expires + "\n" + clientIP))
+	query.Set(SignatureParam, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// wowzaContentPath returns application and stream name part of URL path
+// without player specific playlist or manifest file
+func wowzaContentPath(path string) string {
+	path = strings.Trim(path, "/")
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		last := path[i+1:]
+		if strings.HasSuffix(last, ".m3u8") || strings.HasSuffix(last, ".mpd") {
+			path = path[:i]
+		}
+	}
+	return path
+}
@@ -0,0 +1,127 @@
+package playback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vectors follow Wowza SecureToken v2 example: hash of content path and sorted
+// secret, client IP and prefixed parameters, base64url encoded
+func TestSignWowzaKnownVector(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		clientIP  string
+		want      string
+	}{
+		{
+			// sha256("vod/sample.mp4?192.168.1.2&mysharedsecret&wowzatokenCustomParameter=abcdef&wowzatokenendtime=1500000000&wowzatokenstarttime=1395230400")
+			name:      "sha256 with client IP",
+			algorithm: "sha256",
+			clientIP:  "192.168.1.2",
+			want:      "LDREcIiDDcIjta71yxdYTh2huvgkwLqULGi420vPjf0=",
+		},
+		{
+			// sha512("vod/sample.mp4?mysharedsecret&wowzatokenCustomParameter=abcdef&wowzatokenendtime=1500000000&wowzatokenstarttime=1395230400")
+			name:      "sha512 without client IP",
+			algorithm: "sha512",
+			want:      "u1GRwT4wtTv0u9_Eu8WJ9IcNq7NMgl1Gf2D3-SLVVAxhvVdVvzNKEa4xLLC_lmYysB8NVgDkz7klWVt2w0-rDA==",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSigner(Config{Signing: SigningWowza, Secret: "mysharedsecret", HashAlgorithm: tt.algorithm})
+			if err != nil {
+				t.Fatalf("NewSigner() error = %v", err)
+			}
+			// Parameters without token prefix and stale hash are not hashed
+			query := url.Values{
+				"wowzatokenstarttime":       {"1395230400"},
+				"wowzatokenCustomParameter": {"abcdef"},
+				"wowzatokenhash":            {"stale"},
+				"other":                     {"1"},
+			}
+			s.signWowza("/vod/sample.mp4/playlist.m3u8", query, time.Unix(1500000000, 0), tt.clientIP)
+
+			if got := query.Get("wowzatokenendtime"); got != "1500000000" {
+				t.Errorf("endtime = %q, want 1500000000", got)
+			}
+			if got := query.Get("wowzatokenhash"); got != tt.want {
+				t.Errorf("hash = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWowzaContentPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/vod/sample.mp4/playlist.m3u8", "vod/sample.mp4"},
+		{"/live/camera/manifest.mpd", "live/camera"},
+		{"/live/camera", "live/camera"},
+		{"/live/camera/", "live/camera"},
+	}
+	for _, tt := range tests {
+		if got := wowzaContentPath(tt.path); got != tt.want {
+			t.Errorf("wowzaContentPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSignHMACRoundTrip(t *testing.T) {
+	const secret = "hmacsecret"
+	s, err := NewSigner(Config{Signing: SigningHMAC, Secret: secret, BindClientIP: true, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	signed, err := s.Sign("https://media.example.com/live/camera/playlist.m3u8?quality=hd", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if signed.ExpiresAt == nil {
+		t.Fatal("ExpiresAt is nil")
+	}
+	u, err := url.Parse(signed.URL)
+	if err != nil {
+		t.Fatalf("signed URL %q is not parsed: %v", signed.URL, err)
+	}
+	query := u.Query()
+	if got := query.Get(ExpiresParam); got != strconv.FormatInt(signed.ExpiresAt.Unix(), 10) {
+		t.Errorf("expires = %q, want %d", got, signed.ExpiresAt.Unix())
+	}
+	if got := query.Get("quality"); got != "hd" {
+		t.Errorf("quality = %q, original query is lost", got)
+	}
+
+	if !verifyHMAC(secret, u.Path, query, "10.0.0.1") {
+		t.Error("signature is not verified")
+	}
+	if verifyHMAC(secret, u.Path, query, "10.0.0.2") {
+		t.Error("signature is verified for other client IP")
+	}
+	if verifyHMAC(secret, strings.Replace(u.Path, "camera", "other", 1), query, "10.0.0.1") {
+		t.Error("signature is verified for other path")
+	}
+	if verifyHMAC("othersecret", u.Path, query, "10.0.0.1") {
+		t.Error("signature is verified with other secret")
+	}
+}
+
+// verifyHMAC checks signature the way media server does
+func verifyHMAC(secret, path string, query url.Values, clientIP string) bool {
+	signature, err := hex.DecodeString(query.Get(SignatureParam))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + query.Get(ExpiresParam) + "\n" + clientIP))
+	return hmac.Equal(signature, mac.Sum(nil))
+}
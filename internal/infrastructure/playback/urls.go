@@ -0,0 +1,53 @@
+package playback
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Playback formats
+const (
+	FormatHLS  = "hls"
+	FormatDASH = "dash"
+)
+
+// Templates holds live playback URL templates with {mediaserverIp},
+// {applicationName} and {deviceId} placeholders
+type Templates struct {
+	HLS  string
+	DASH string
+}
+
+// LiveURL makes camera live stream URL of requested format, HLS by default
+func (t Templates) LiveURL(format, mediaserverIP, applicationName, deviceID string) (string, error) {
+	if len(mediaserverIP) == 0 || len(applicationName) == 0 {
+		return "", errors.New("no mediaserver params defined")
+	}
+
+	template := t.HLS
+	switch format {
+	case "", FormatHLS:
+		if len(template) == 0 {
+			template = "https://{mediaserverIp}/{applicationName}/{deviceId}/playlist.m3u8"
+		}
+	case FormatDASH:
+		template = t.DASH
+		if len(template) == 0 {
+			template = "https://{mediaserverIp}/{applicationName}/{deviceId}/manifest.mpd"
+		}
+	default:
+		return "", errors.New("unsupported playback format: " + format)
+	}
+
+	return strings.NewReplacer(
+		"{mediaserverIp}", mediaserverIP,
+		"{applicationName}", applicationName,
+		"{deviceId}", deviceID,
+	).Replace(template), nil
+}
+
+// IsFormat checks playback format name, empty one means default format
+func IsFormat(format string) bool {
+	return format == "" || format == FormatHLS || format == FormatDASH
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Roles of REST API callers, each next role includes rights of previous ones
+const (
+	// RoleReadOnly can only read data of users in its scope
+	RoleReadOnly = "readonly"
+	// RoleIntegrator can read and command gateways of users in its scope
+	RoleIntegrator = "integrator"
+	// RoleOperator can read and command gateways of all users
+	RoleOperator = "operator"
+	// RoleAdmin has full access including maintenance endpoints
+	RoleAdmin = "admin"
+)
+
+// principalKey is the gin context key of authenticated caller
+const principalKey = "principal"
+
+var roleLevels = map[string]int{
+	RoleReadOnly:   1,
+	RoleIntegrator: 2,
+	RoleOperator:   3,
+	RoleAdmin:      4,
+}
+
+// isValidRole checks that role name is known
+func isValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// principal describes authenticated REST API caller
+type principal struct {
+	Name    string
+	Role    string
+	UserIDs []uint64
+}
+
+// hasRole checks that principal role includes rights of required role
+func (p *principal) hasRole(role string) bool {
+	return roleLevels[p.Role] >= roleLevels[role]
+}
+
+// unscoped tells that principal may access data of any user.
+// Operators and admins are unscoped unless user list is defined for them.
+func (p *principal) unscoped() bool {
+	return p.hasRole(RoleOperator) && len(p.UserIDs) == 0
+}
+
+// canAccessUser checks that user is in principal scope
+func (p *principal) canAccessUser(userID uint64) bool {
+	if p.unscoped() {
+		return true
+	}
+	for _, id := range p.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenClaims holds JWT bearer token payload
+type tokenClaims struct {
+	Role  string   `json:"role"`
+	Users []uint64 `json:"users,omitempty"`
+	jwt.StandardClaims
+}
+
+// authenticate is a middleware resolving caller by API key, JWT bearer token
+// or configured basic account. Basic account has admin role.
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, err := s.resolvePrincipal(c.Request)
+		if err != nil {
+			logger.Error("error authenticating request", "error", err, "caller", "authenticate")
+			abortWithError(c, http.StatusInternalServerError, codeInternalError, "failed checking credentials")
+			return
+		}
+		if p == nil {
+			c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			abortWithError(c, http.StatusUnauthorized, codeUnauthorized, "wrong or missing credentials")
+			return
+		}
+		c.Set(principalKey, p)
+		c.Set(gin.AuthUserKey, p.Name)
+		c.Next()
+	}
+}
+
+// requireRole is a middleware rejecting callers without required role
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := getPrincipal(c); p == nil || !p.hasRole(role) {
+			abortWithError(c, http.StatusForbidden, codeForbidden, "operation is not permitted for role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// getPrincipal returns authenticated caller from request context
+func getPrincipal(c *gin.Context) *principal {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	p, _ := value.(*principal)
+	return p
+}
+
+// resolvePrincipal checks request credentials.
+// Returns nil if credentials are missing or wrong.
+func (s *Server) resolvePrincipal(r *http.Request) (*principal, error) {
+	if key := r.Header.Get("X-API-Key"); len(key) > 0 {
+		return s.findAPIKey(key)
+	}
+
+	header := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(header, "Bearer "):
+		token := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		if strings.Count(token, ".") == 2 {
+			return parseBearerToken(token), nil
+		}
+		return s.findAPIKey(token)
+
+	case strings.HasPrefix(header, "Basic "):
+		return checkBasicAccount(strings.TrimPrefix(header, "Basic ")), nil
+	}
+	return nil, nil
+}
+
+// checkBasicAccount compares basic credentials with configured account
+func checkBasicAccount(encoded string) *principal {
+	user := viper.GetString("rest.user")
+	if len(user) == 0 {
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	expected := user + ":" + viper.GetString("rest.password")
+	if subtle.ConstantTimeCompare(decoded, []byte(expected)) != 1 {
+		return nil
+	}
+	return &principal{Name: user, Role: RoleAdmin}
+}
+
+// parseBearerToken verifies HS256 signed token with configured secret.
+// Returns nil if token is wrong, expired or JWT is not configured.
+func parseBearerToken(token string) *principal {
+	secret := viper.GetString("rest.jwt.secret")
+	if len(secret) == 0 {
+		return nil
+	}
+
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		logger.Debug("Bearer token rejected", "error", err)
+		return nil
+	}
+	if issuer := viper.GetString("rest.jwt.issuer"); len(issuer) > 0 && !claims.VerifyIssuer(issuer, true) {
+		return nil
+	}
+	if audience := viper.GetString("rest.jwt.audience"); len(audience) > 0 && !claims.VerifyAudience(audience, true) {
+		return nil
+	}
+	if !isValidRole(claims.Role) || len(claims.Subject) == 0 {
+		return nil
+	}
+	return &principal{
+		Name:    claims.Subject,
+		Role:    claims.Role,
+		UserIDs: claims.Users,
+	}
+}
+
+// authorizeUser checks that user is in caller scope and writes error response if needed
+func authorizeUser(c *gin.Context, userID uint64) bool {
+	if p := getPrincipal(c); p == nil || !p.canAccessUser(userID) {
+		respondError(c, http.StatusForbidden, codeForbidden, "user is out of credentials scope")
+		return false
+	}
+	return true
+}
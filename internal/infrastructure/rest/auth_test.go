@@ -0,0 +1,247 @@
+package rest
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+func TestRoleOrdering(t *testing.T) {
+	roles := []string{RoleReadOnly, RoleIntegrator, RoleOperator, RoleAdmin}
+	for i, role := range roles {
+		for j, required := range roles {
+			p := &principal{Role: role}
+			if got, want := p.hasRole(required), i >= j; got != want {
+				t.Errorf("%s.hasRole(%s) = %v, want %v", role, required, got, want)
+			}
+		}
+	}
+
+	unknown := &principal{Role: "superuser"}
+	if unknown.hasRole(RoleReadOnly) {
+		t.Error("unknown role has readonly rights")
+	}
+	if isValidRole("superuser") || isValidRole("") {
+		t.Error("unknown role is valid")
+	}
+}
+
+func TestPrincipalScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        principal
+		unscoped bool
+		allowed  []uint64
+		denied   []uint64
+	}{
+		{
+			name:     "admin without users is unscoped",
+			p:        principal{Role: RoleAdmin},
+			unscoped: true,
+			allowed:  []uint64{1, 649},
+		},
+		{
+			name:     "operator without users is unscoped",
+			p:        principal{Role: RoleOperator},
+			unscoped: true,
+			allowed:  []uint64{1, 649},
+		},
+		{
+			name:    "operator with users is scoped",
+			p:       principal{Role: RoleOperator, UserIDs: []uint64{5}},
+			allowed: []uint64{5},
+			denied:  []uint64{6},
+		},
+		{
+			name:    "integrator is scoped by users",
+			p:       principal{Role: RoleIntegrator, UserIDs: []uint64{5, 6}},
+			allowed: []uint64{5, 6},
+			denied:  []uint64{7},
+		},
+		{
+			name:   "integrator without users accesses nobody",
+			p:      principal{Role: RoleIntegrator},
+			denied: []uint64{1, 649},
+		},
+		{
+			name:    "readonly is scoped by users",
+			p:       principal{Role: RoleReadOnly, UserIDs: []uint64{5}},
+			allowed: []uint64{5},
+			denied:  []uint64{6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.unscoped(); got != tt.unscoped {
+				t.Errorf("unscoped() = %v, want %v", got, tt.unscoped)
+			}
+			for _, id := range tt.allowed {
+				if !tt.p.canAccessUser(id) {
+					t.Errorf("canAccessUser(%d) = false, want true", id)
+				}
+			}
+			for _, id := range tt.denied {
+				if tt.p.canAccessUser(id) {
+					t.Errorf("canAccessUser(%d) = true, want false", id)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBearerToken(t *testing.T) {
+	viper.Set("rest.jwt.secret", "jwtsecret")
+	viper.Set("rest.jwt.issuer", "veedo")
+	defer viper.Set("rest.jwt.secret", "")
+	defer viper.Set("rest.jwt.issuer", "")
+
+	valid := func() tokenClaims {
+		return tokenClaims{
+			Role:  RoleIntegrator,
+			Users: []uint64{5},
+			StandardClaims: jwt.StandardClaims{
+				Subject:   "crm",
+				Issuer:    "veedo",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		secret string
+		claims func(c *tokenClaims)
+		want   *principal
+	}{
+		{
+			name:   "valid token",
+			method: jwt.SigningMethodHS256,
+			secret: "jwtsecret",
+			claims: func(c *tokenClaims) {},
+			want:   &principal{Name: "crm", Role: RoleIntegrator, UserIDs: []uint64{5}},
+		},
+		{
+			name:   "wrong secret",
+			method: jwt.SigningMethodHS256,
+			secret: "othersecret",
+			claims: func(c *tokenClaims) {},
+		},
+		{
+			name:   "other signing method",
+			method: jwt.SigningMethodHS512,
+			secret: "jwtsecret",
+			claims: func(c *tokenClaims) {},
+		},
+		{
+			name:   "expired token",
+			method: jwt.SigningMethodHS256,
+			secret: "jwtsecret",
+			claims: func(c *tokenClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() },
+		},
+		{
+			name:   "wrong issuer",
+			method: jwt.SigningMethodHS256,
+			secret: "jwtsecret",
+			claims: func(c *tokenClaims) { c.Issuer = "other" },
+		},
+		{
+			name:   "unknown role",
+			method: jwt.SigningMethodHS256,
+			secret: "jwtsecret",
+			claims: func(c *tokenClaims) { c.Role = "superuser" },
+		},
+		{
+			name:   "missing subject",
+			method: jwt.SigningMethodHS256,
+			secret: "jwtsecret",
+			claims: func(c *tokenClaims) { c.Subject = "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.claims(&claims)
+			token, err := jwt.NewWithClaims(tt.method, claims).SignedString([]byte(tt.secret))
+			if err != nil {
+				t.Fatalf("SignedString() error = %v", err)
+			}
+			if got := parseBearerToken(token); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBearerToken() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePrincipal(t *testing.T) {
+	viper.Set("rest.user", "bandersnatch")
+	viper.Set("rest.password", "si3nYPzjyN")
+	defer viper.Set("rest.user", "")
+	defer viper.Set("rest.password", "")
+
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+	integrator := &principal{Name: "crm", Role: RoleIntegrator, UserIDs: []uint64{5, 6}}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    *principal
+	}{
+		{
+			name:    "basic account is admin",
+			headers: map[string]string{"Authorization": basic("bandersnatch:si3nYPzjyN")},
+			want:    &principal{Name: "bandersnatch", Role: RoleAdmin},
+		},
+		{
+			name:    "wrong basic password",
+			headers: map[string]string{"Authorization": basic("bandersnatch:wrong")},
+		},
+		{
+			name:    "API key header",
+			headers: map[string]string{"X-API-Key": "integrator-key"},
+			want:    integrator,
+		},
+		{
+			name:    "API key as bearer token",
+			headers: map[string]string{"Authorization": "Bearer integrator-key"},
+			want:    integrator,
+		},
+		{
+			name:    "API key takes precedence",
+			headers: map[string]string{"X-API-Key": "integrator-key", "Authorization": basic("bandersnatch:si3nYPzjyN")},
+			want:    integrator,
+		},
+		{
+			name:    "unknown API key",
+			headers: map[string]string{"X-API-Key": "wrong-key"},
+		},
+		{
+			name:    "API key with unknown role",
+			headers: map[string]string{"X-API-Key": "unknown-role"},
+		},
+		{
+			name: "missing credentials",
+		},
+	}
+	s := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v3/gateways", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			got, err := s.resolvePrincipal(r)
+			if err != nil {
+				t.Fatalf("resolvePrincipal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolvePrincipal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of REST API responses, they are listed in OpenAPI specification
+const (
+	codeInvalidRequest     = "invalidRequest"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "notFound"
+	codeGatewayUnavailable = "gatewayUnavailable"
+	codeUpstreamFailed     = "upstreamFailed"
+	codeInternalError      = "internalError"
+)
+
+// errorResponse structure of REST API error
+type errorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+	Field string `json:"field,omitempty"`
+}
+
+// fieldError describes request validation failure of one field
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// respondError writes JSON error response
+func respondError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, errorResponse{Code: code, Error: message})
+}
+
+// abortWithError writes JSON error response and stops middleware chain
+func abortWithError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, errorResponse{Code: code, Error: message})
+}
+
+// respondFieldError writes JSON error response for failed request validation
+func respondFieldError(c *gin.Context, err *fieldError) {
+	c.JSON(http.StatusBadRequest, errorResponse{
+		Code:  codeInvalidRequest,
+		Error: err.Message,
+		Field: err.Field,
+	})
+}
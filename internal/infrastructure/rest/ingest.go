@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/broker"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	ingestMaxBodySize    = 1 << 20
+	ingestDefaultBatch   = 100
+	ingestDeviceProtocol = "http"
+)
+
+// Ingest readings of direct-to-cloud devices. Body holds single message or array of messages.
+// Messages are processed by business logic of device gateway, usually virtual one.
+// Test with:
+// curl -ki -X POST -H "Content-Type: application/json" -H "Authorization: Bearer 3f6c0b1e..." -d '[{"messageType": "sensorData", "sensorType": "temperature", "label": "temperature", "sensorData": "21.5", "units": "C"}]' http://127.0.0.1:2020/api/v3/ingest
+func (s *Server) handleIngest(c *gin.Context) {
+
+	// Authenticate device by its token
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if len(token) == 0 {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "missing device token")
+		return
+	}
+	owner, err := s.findDeviceToken(token)
+	if err != nil {
+		logger.Error("error checking device token", "error", err, "caller", "handleIngest")
+		respondError(c, http.StatusInternalServerError, codeInternalError, "failed checking device token")
+		return
+	}
+	if owner == nil {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "wrong device token")
+		return
+	}
+
+	// Parse and validate messages
+	list, err := parseIngestBody(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	for i, message := range list {
+		if err := prepareIngestMessage(message, owner); err != nil {
+			respondFieldError(c, &fieldError{Field: fmt.Sprintf("[%d]", i), Message: err.Error()})
+			return
+		}
+	}
+
+	// Process messages in order of arrival
+	for _, message := range list {
+		err := s.mgr.IngestMessage(message)
+		if errors.Cause(err) == broker.ErrGatewayNotConnected {
+			respondError(c, http.StatusNotFound, codeGatewayUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Error("error ingesting message", "error", err,
+				"device", owner.DeviceID, "caller", "handleIngest")
+			respondError(c, http.StatusInternalServerError, codeInternalError, "failed processing messages")
+			return
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"accepted": len(list)})
+}
+
+// parseIngestBody reads single message or array of messages from request body
+func parseIngestBody(c *gin.Context) ([]*entities.IotMessage, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, ingestMaxBodySize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading request body")
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty request body")
+	}
+
+	list := make([]*entities.IotMessage, 0)
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, errors.Wrap(err, "wrong messages array")
+		}
+	} else {
+		message := &entities.IotMessage{}
+		if err := json.Unmarshal(body, message); err != nil {
+			return nil, errors.Wrap(err, "wrong message")
+		}
+		list = append(list, message)
+	}
+
+	maxBatch := viper.GetInt("rest.ingestMaxBatch")
+	if maxBatch <= 0 {
+		maxBatch = ingestDefaultBatch
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no messages in request")
+	}
+	if len(list) > maxBatch {
+		return nil, errors.Errorf("too many messages in request, maximum is %d", maxBatch)
+	}
+	return list, nil
+}
+
+// prepareIngestMessage checks message and binds it to device and its gateway
+func prepareIngestMessage(message *entities.IotMessage, owner *deviceTokenOwner) error {
+	if message == nil {
+		return errors.New("empty message")
+	}
+	if len(message.DeviceId) > 0 && message.DeviceId != owner.DeviceID {
+		return errors.New("message device does not match token")
+	}
+	if len(message.GatewayId) > 0 && message.GatewayId != owner.GatewayID {
+		return errors.New("message gateway does not match token")
+	}
+	if len(message.DeviceType) > 0 && message.DeviceType != "sensor" {
+		return errors.New("only sensor devices can post messages")
+	}
+
+	switch message.MessageType {
+	case "sensorData":
+		if len(message.SensorData) == 0 {
+			return errors.New("no sensor data in message")
+		}
+		if len(message.Label) == 0 && len(message.SensorType) == 0 {
+			return errors.New("no sensor label or type in message")
+		}
+	case "deviceState":
+		if len(message.DeviceState) == 0 {
+			return errors.New("no device state in message")
+		}
+	default:
+		return errors.Errorf("unsupported message type %s", message.MessageType)
+	}
+
+	// Bind message to device and fill missing fields
+	message.DeviceId = owner.DeviceID
+	message.GatewayId = owner.GatewayID
+	message.DeviceType = "sensor"
+	message.Preview = ""
+	if len(message.Protocol) == 0 {
+		message.Protocol = ingestDeviceProtocol
+	}
+	if len(message.Timestamp) == 0 {
+		message.Timestamp = entities.CreateTimestampMs(time.Now().Local())
+	}
+	return nil
+}
@@ -0,0 +1,2224 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Serve OpenAPI specification of REST API
+// Test with:
+// curl -ki -X GET http://127.0.0.1:2020/api/v3/openapi.json
+func (s *Server) handleOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(openAPISpec))
+}
+
+// openAPISpec is OpenAPI 3 document of REST API contract.
+// Only /command and configuration patch bodies are validated against it,
+// other request bodies are checked by their handlers.
+// Command validation in validation.go is loaded from Command schema:
+// x-attributes lists allowed attributes of every command, null means
+// any non-empty attribute up to maxLength; x-deviceCommands require
+// deviceId and x-cameraCommands are addressed to camera.
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Veedo IoT cloud server API",
+    "version": "3.0.0",
+    "description": "Command and ConfigurationPatch request bodies are validated against their schemas. Other request bodies are checked by endpoint handlers, so schemas describe accepted fields but not every rule."
+  },
+  "servers": [
+    {"url": "/api/v3"}
+  ],
+  "security": [
+    {"basicAuth": []},
+    {"bearerAuth": []},
+    {"apiKeyAuth": []}
+  ],
+  "paths": {
+    "/info": {
+      "get": {
+        "summary": "Get server info",
+        "operationId": "getInfo",
+        "responses": {
+          "200": {
+            "description": "Server info",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Info"}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/configure/{gatewayId}": {
+      "get": {
+        "summary": "Get gateway configuration with RPC request to gateway",
+        "operationId": "getGatewayConfigure",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Gateway configuration as returned by gateway",
+            "content": {"application/json": {"schema": {"type": "object"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Set camera configuration fields on gateway, previous configuration is stored for rollback",
+        "operationId": "setGatewayConfigure",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigurationPatch"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Configuration returned by gateway after change",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigurationResult"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/configure/{gatewayId}/rollback": {
+      "post": {
+        "summary": "Restore camera configuration fields changed by last or defined configuration push",
+        "operationId": "rollbackGatewayConfigure",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/UserId"},
+          {
+            "name": "snapshotId",
+            "in": "query",
+            "description": "Snapshot taken by configuration push, last one by default",
+            "schema": {"type": "integer", "format": "int64", "minimum": 1}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Configuration returned by gateway after rollback",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigurationResult"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/configure/{gatewayId}/versions": {
+      "get": {
+        "summary": "List configuration versions reported by gateway, newest first",
+        "operationId": "listGatewayConfigVersions",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/UserId"},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 500, "default": 50}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Configuration versions without configuration itself",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ConfigVersion"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/configure/{gatewayId}/versions/{version}": {
+      "get": {
+        "summary": "Get gateway configuration version",
+        "operationId": "getGatewayConfigVersion",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/ConfigVersion"},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Configuration version with configuration",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigVersion"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/configure/{gatewayId}/versions/{version}/restore": {
+      "post": {
+        "summary": "Send cameras configuration of version to gateway, cameras not present on gateway are skipped",
+        "operationId": "restoreGatewayConfigVersion",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/ConfigVersion"},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Configuration returned by gateway after restore",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigurationResult"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/configure/{gatewayId}/diff": {
+      "get": {
+        "summary": "Compare two gateway configuration versions field by field",
+        "operationId": "diffGatewayConfigVersions",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/UserId"},
+          {"name": "from", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1}},
+          {"name": "to", "in": "query", "description": "The last version by default", "schema": {"type": "integer", "minimum": 1}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Configuration difference",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ConfigDiff"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateways": {
+      "get": {
+        "summary": "List gateways this server holds channels for, operator role is required",
+        "operationId": "listGateways",
+        "responses": {
+          "200": {
+            "description": "Connected gateways ordered by id",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Gateway"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateways/{gatewayId}": {
+      "get": {
+        "summary": "Get connected gateway with its cameras and sensors",
+        "operationId": "getGateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Gateway channel state and devices of its business logic",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewayDetails"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/live": {
+      "parameters": [
+        {"$ref": "#/components/parameters/DeviceId"},
+        {"$ref": "#/components/parameters/UserId"}
+      ],
+      "get": {
+        "summary": "Get camera live stream state with number of viewers",
+        "responses": {
+          "200": {
+            "description": "Live stream state",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LiveStream"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Join camera live view, cloud streaming is started on demand",
+        "parameters": [
+          {"$ref": "#/components/parameters/PlaybackFormat"}
+        ],
+        "description": "Blocks until camera reports it is streaming. Session expires unless heartbeats are sent.",
+        "responses": {
+          "200": {
+            "description": "Viewer session with playback URL",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LiveSession"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/live/{sessionId}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/DeviceId"},
+        {"name": "sessionId", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}},
+        {"$ref": "#/components/parameters/UserId"}
+      ],
+      "put": {
+        "summary": "Prolong viewer session and renew signed playback URL",
+        "parameters": [
+          {"$ref": "#/components/parameters/PlaybackFormat"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Viewer session",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LiveSession"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Leave camera live view",
+        "description": "Streaming started on demand is stopped after idle timeout when nobody watches camera.",
+        "responses": {
+          "204": {"description": "Session removed"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/playback": {
+      "get": {
+        "summary": "Get signed time-limited playback URL of camera streaming now",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"$ref": "#/components/parameters/UserId"},
+          {"$ref": "#/components/parameters/PlaybackFormat"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Playback URL",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Playback"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/tariffs": {
+      "get": {
+        "summary": "List tariffs with their features",
+        "responses": {
+          "200": {
+            "description": "Tariffs",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Tariff"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/policy": {
+      "get": {
+        "summary": "Get tariff features available to user account",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Evaluated tariff policy",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Policy"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/usage": {
+      "get": {
+        "summary": "Get daily usage of user cameras and sensors, current month by default",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserId"},
+          {"$ref": "#/components/parameters/UsageFrom"},
+          {"$ref": "#/components/parameters/UsageTo"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Usage report",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/UsageReport"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/usage/export": {
+      "get": {
+        "summary": "Export daily usage of user cameras and sensors as CSV",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserId"},
+          {"$ref": "#/components/parameters/UsageFrom"},
+          {"$ref": "#/components/parameters/UsageTo"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Usage CSV with day, userId, deviceId, recordingHours, streamingHours and sensorPoints columns",
+            "content": {"text/csv": {"schema": {"type": "string"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/accounts/{userId}/events": {
+      "post": {
+        "summary": "Apply account change made by billing to all gateways of user, admins only",
+        "parameters": [
+          {"name": "userId", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AccountEventRequest"}}}
+        },
+        "responses": {
+          "202": {
+            "description": "Account event accepted",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AccountEvent"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/streams": {
+      "get": {
+        "summary": "List camera streams known to server, operators only",
+        "responses": {
+          "200": {
+            "description": "Live streams",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/LiveStream"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "Get this OpenAPI specification",
+        "operationId": "getOpenAPI",
+        "security": [],
+        "responses": {
+          "200": {
+            "description": "OpenAPI document",
+            "content": {"application/json": {"schema": {"type": "object"}}}
+          }
+        }
+      }
+    },
+    "/ingest": {
+      "post": {
+        "summary": "Ingest readings of direct-to-cloud devices authenticated with device token",
+        "description": "Messages are processed by business logic of device gateway, usually virtual one. Gateway not connected to this server is accepted only if it is flagged as virtual one.",
+        "operationId": "ingest",
+        "security": [
+          {"deviceToken": []}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "oneOf": [
+                  {"$ref": "#/components/schemas/IngestMessage"},
+                  {"type": "array", "items": {"$ref": "#/components/schemas/IngestMessage"}}
+                ]
+              }
+            }
+          }
+        },
+        "responses": {
+          "202": {
+            "description": "Messages accepted",
+            "content": {"application/json": {"schema": {"type": "object", "properties": {"accepted": {"type": "integer"}}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/{gatewayId}/devices": {
+      "get": {
+        "summary": "Get last known gateway devices state from device shadows",
+        "operationId": "getGatewayDevices",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Reported and desired state of gateway devices",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewayDevices"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/{gatewayId}/secret": {
+      "post": {
+        "summary": "Create or rotate gateway secret used for message signatures, gateway owner only",
+        "description": "New secret is returned once. Other servers accept old secret until their secret cache expires.",
+        "operationId": "rotateGatewaySecret",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/UserRequest"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "New gateway secret",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewaySecret"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/{gatewayId}/audit": {
+      "get": {
+        "summary": "Get rejected gateway messages audit log, gateway owner only",
+        "operationId": "getGatewayAudit",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/RequiredUserId"},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 500, "default": 100}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Audit records, newest first",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/GatewayAuditRecord"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/{gatewayId}/shares": {
+      "get": {
+        "summary": "Get users the gateway is shared with, gateway owner only",
+        "operationId": "listGatewayShares",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"},
+          {"$ref": "#/components/parameters/RequiredUserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Gateway shares ordered by user id",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/GatewayShare"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/gateway/{gatewayId}/shares/{shareUserId}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/GatewayId"},
+        {"name": "shareUserId", "in": "path", "required": true, "description": "User the gateway is shared with", "schema": {"type": "integer", "format": "int64", "minimum": 1}}
+      ],
+      "put": {
+        "summary": "Share gateway with other user or change access of that user, gateway owner only",
+        "operationId": "shareGateway",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewayShareRequest"}}}
+        },
+        "responses": {
+          "204": {"description": "Gateway shared"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Revoke gateway access of other user, gateway owner only",
+        "operationId": "unshareGateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/RequiredUserId"}
+        ],
+        "responses": {
+          "204": {"description": "Gateway access revoked"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/sensors/{label}/history": {
+      "get": {
+        "summary": "Get aggregated sensor history, depth is limited by tariff of device owner",
+        "operationId": "getSensorHistory",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"name": "label", "in": "path", "required": true, "schema": {"type": "string"}},
+          {"$ref": "#/components/parameters/RequiredUserId"},
+          {"name": "from", "in": "query", "description": "RFC3339 time or Unix milliseconds, a day before 'to' by default", "schema": {"type": "string"}},
+          {"name": "to", "in": "query", "description": "RFC3339 time or Unix milliseconds, now by default", "schema": {"type": "string"}},
+          {"name": "step", "in": "query", "description": "Downsampling step as Go duration, e.g. 1h; range is split into 500 points by default", "schema": {"type": "string"}},
+          {"name": "agg", "in": "query", "schema": {"type": "string", "enum": ["mean", "min", "max", "last"], "default": "mean"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Sensor history",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/SensorHistory"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/archive": {
+      "get": {
+        "summary": "Get camera local archive segments stored on gateway with RPC request to gateway",
+        "operationId": "listLocalArchive",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"$ref": "#/components/parameters/UserId"},
+          {"$ref": "#/components/parameters/ArchiveFrom"},
+          {"$ref": "#/components/parameters/ArchiveTo"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Local archive segments as reported by gateway",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/LocalArchive"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/archive/uploads": {
+      "get": {
+        "summary": "Get last uploads of camera local archive",
+        "operationId": "listArchiveUploads",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Archive uploads, newest first",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/ArchiveUpload"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Request gateway to upload time range of camera local archive to cloud storage",
+        "description": "Upload progress is reported by gateway and can be followed with upload resource.",
+        "operationId": "createArchiveUpload",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ArchiveUploadRequest"}}}
+        },
+        "responses": {
+          "202": {
+            "description": "Upload accepted by gateway",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ArchiveUpload"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/archive/uploads/{uploadId}": {
+      "get": {
+        "summary": "Get camera local archive upload with its progress",
+        "operationId": "getArchiveUpload",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"name": "uploadId", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}},
+          {"$ref": "#/components/parameters/UserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Archive upload",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ArchiveUpload"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/archive/segments": {
+      "get": {
+        "summary": "Get camera archive segments uploaded to cloud storage with signed playback URLs",
+        "description": "Depth is limited by recordings retention of camera owner tariff.",
+        "operationId": "listArchiveSegments",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"$ref": "#/components/parameters/UserId"},
+          {"$ref": "#/components/parameters/ArchiveFrom"},
+          {"$ref": "#/components/parameters/ArchiveTo"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Cloud archive segments",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CloudArchive"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/tokens": {
+      "get": {
+        "summary": "Get access tokens of direct-to-cloud device",
+        "operationId": "listDeviceTokens",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"$ref": "#/components/parameters/RequiredUserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Device tokens without token values",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/DeviceToken"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create access token for direct-to-cloud device, token is returned once",
+        "operationId": "createDeviceToken",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeviceTokenRequest"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "Created token",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/DeviceTokenCreated"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/devices/{deviceId}/tokens/{tokenId}": {
+      "delete": {
+        "summary": "Revoke access token of direct-to-cloud device",
+        "operationId": "deleteDeviceToken",
+        "parameters": [
+          {"$ref": "#/components/parameters/DeviceId"},
+          {"name": "tokenId", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}},
+          {"$ref": "#/components/parameters/RequiredUserId"}
+        ],
+        "responses": {
+          "204": {"description": "Token revoked"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/rules": {
+      "get": {
+        "summary": "Get automation rules filtered by user and gateway",
+        "operationId": "listRules",
+        "parameters": [
+          {"$ref": "#/components/parameters/UserId"},
+          {"name": "gatewayId", "in": "query", "schema": {"type": "string", "format": "uuid"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Rules ordered by id",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Rule"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create automation rule of user gateway",
+        "operationId": "createRule",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Rule"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "Created rule",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Rule"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/rules/{ruleId}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/RuleId"}
+      ],
+      "get": {
+        "summary": "Get automation rule",
+        "operationId": "getRule",
+        "responses": {
+          "200": {
+            "description": "Rule",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Rule"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Update automation rule, rule user can not be changed",
+        "operationId": "updateRule",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Rule"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Updated rule",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Rule"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Delete automation rule",
+        "operationId": "deleteRule",
+        "responses": {
+          "204": {"description": "Rule deleted"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks": {
+      "get": {
+        "summary": "Get user webhooks",
+        "operationId": "listWebhooks",
+        "parameters": [
+          {"$ref": "#/components/parameters/RequiredUserId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Webhooks",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Webhook"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create user webhook, signing secret is generated if not defined",
+        "operationId": "createWebhook",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Webhook"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "Created webhook with its secret",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/WebhookCreated"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/{webhookId}": {
+      "parameters": [
+        {"$ref": "#/components/parameters/WebhookId"}
+      ],
+      "get": {
+        "summary": "Get user webhook",
+        "operationId": "getWebhook",
+        "responses": {
+          "200": {
+            "description": "Webhook",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Webhook"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "summary": "Update user webhook, stored secret is kept if not defined",
+        "operationId": "updateWebhook",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Webhook"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Updated webhook",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Webhook"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "summary": "Delete user webhook",
+        "operationId": "deleteWebhook",
+        "responses": {
+          "204": {"description": "Webhook deleted"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/webhooks/{webhookId}/deliveries": {
+      "get": {
+        "summary": "Get last delivery attempts of user webhook",
+        "operationId": "listWebhookDeliveries",
+        "parameters": [
+          {"$ref": "#/components/parameters/WebhookId"},
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 500, "default": 100}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Delivery attempts, newest first",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/WebhookDelivery"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/apikeys": {
+      "get": {
+        "summary": "Get REST API keys, admins only",
+        "operationId": "listAPIKeys",
+        "responses": {
+          "200": {
+            "description": "API keys without key values",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/APIKey"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create REST API key, key is returned once, admins only",
+        "operationId": "createAPIKey",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/APIKeyRequest"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "Created API key",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/APIKeyCreated"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/apikeys/{keyId}": {
+      "delete": {
+        "summary": "Revoke REST API key, admins only",
+        "operationId": "deleteAPIKey",
+        "parameters": [
+          {"name": "keyId", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}}
+        ],
+        "responses": {
+          "204": {"description": "API key revoked"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/gateways/{gatewayId}/restart": {
+      "post": {
+        "summary": "Send restart command to gateway, admins only",
+        "operationId": "restartGateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"}
+        ],
+        "responses": {
+          "202": {
+            "description": "Restart command sent",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewayRef"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/gateways/{gatewayId}/reconnect": {
+      "post": {
+        "summary": "Force-close gateway channel and create new one, admins only",
+        "operationId": "reconnectGateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Gateway channel recreated",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewayRef"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/gateways/{gatewayId}/reload": {
+      "post": {
+        "summary": "Reload gateway business logic params and automation rules from database, admins only",
+        "operationId": "reloadGateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/GatewayId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Gateway business logic reloaded",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/GatewayRef"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "502": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/restart": {
+      "post": {
+        "summary": "Send restart command to connected gateways selected by filter, admins only",
+        "description": "Targets are only listed in dry-run mode.",
+        "operationId": "broadcastRestart",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RestartFilter"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Restart results",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RestartResult"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/admin/tariffs/reload": {
+      "post": {
+        "summary": "Reload tariffs from database, new features apply to gateways at once, admins only",
+        "operationId": "reloadTariffs",
+        "responses": {
+          "200": {
+            "description": "Reloaded tariffs",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Tariff"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware": {
+      "get": {
+        "summary": "Get firmware catalog, admins only",
+        "operationId": "listFirmware",
+        "responses": {
+          "200": {
+            "description": "Firmware catalog",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Firmware"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Add firmware to catalog, admins only",
+        "operationId": "createFirmware",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Firmware"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "Added firmware",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Firmware"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/{firmwareId}": {
+      "delete": {
+        "summary": "Remove firmware not used by campaigns from catalog, admins only",
+        "operationId": "deleteFirmware",
+        "parameters": [
+          {"name": "firmwareId", "in": "path", "required": true, "schema": {"type": "integer", "format": "int64"}}
+        ],
+        "responses": {
+          "204": {"description": "Firmware removed"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/campaigns": {
+      "get": {
+        "summary": "Get firmware rollout campaigns, admins only",
+        "operationId": "listCampaigns",
+        "parameters": [
+          {"name": "status", "in": "query", "schema": {"$ref": "#/components/schemas/CampaignStatus"}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Campaigns",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Campaign"}}}}
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "summary": "Create draft firmware rollout campaign, admins only",
+        "description": "Stages are cumulative percentages of target gateways, rollout is halted when failure rate exceeds threshold.",
+        "operationId": "createCampaign",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Campaign"}}}
+        },
+        "responses": {
+          "201": {
+            "description": "Created campaign",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Campaign"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/campaigns/{campaignId}": {
+      "get": {
+        "summary": "Get firmware rollout campaign with its progress, admins only",
+        "operationId": "getCampaign",
+        "parameters": [
+          {"$ref": "#/components/parameters/CampaignId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Campaign with progress",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CampaignDetails"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/campaigns/{campaignId}/updates": {
+      "get": {
+        "summary": "Get gateway updates of campaign, admins only",
+        "operationId": "listCampaignUpdates",
+        "parameters": [
+          {"$ref": "#/components/parameters/CampaignId"},
+          {"name": "status", "in": "query", "schema": {"type": "string", "enum": ["pending", "sent", "downloading", "installing", "completed", "failed", "skipped"]}}
+        ],
+        "responses": {
+          "200": {
+            "description": "Gateway updates",
+            "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/FirmwareUpdate"}}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/campaigns/{campaignId}/start": {
+      "post": {
+        "summary": "Start draft campaign selecting target gateways or resume paused or halted one, admins only",
+        "operationId": "startCampaign",
+        "parameters": [
+          {"$ref": "#/components/parameters/CampaignId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Campaign with progress",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CampaignDetails"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/campaigns/{campaignId}/pause": {
+      "post": {
+        "summary": "Pause running campaign, updates already sent are still tracked, admins only",
+        "operationId": "pauseCampaign",
+        "parameters": [
+          {"$ref": "#/components/parameters/CampaignId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Campaign with progress",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CampaignDetails"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/firmware/campaigns/{campaignId}/cancel": {
+      "post": {
+        "summary": "Cancel campaign skipping updates not sent yet, admins only",
+        "operationId": "cancelCampaign",
+        "parameters": [
+          {"$ref": "#/components/parameters/CampaignId"}
+        ],
+        "responses": {
+          "200": {
+            "description": "Campaign with progress",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CampaignDetails"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/command": {
+      "post": {
+        "summary": "Send command to gateways, media server or push notification service, snapshot is returned synchronously",
+        "operationId": "sendCommand",
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Command"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "Command accepted",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CommandResult"}}}
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "basicAuth": {"type": "http", "scheme": "basic"},
+      "bearerAuth": {"type": "http", "scheme": "bearer", "description": "JWT signed with HS256 or API key"},
+      "apiKeyAuth": {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+      "deviceToken": {"type": "http", "scheme": "bearer", "description": "Device token of direct-to-cloud device, accepted by /ingest only"}
+    },
+    "parameters": {
+      "GatewayId": {
+        "name": "gatewayId",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "string", "format": "uuid"}
+      },
+      "DeviceId": {
+        "name": "deviceId",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "string", "format": "uuid"}
+      },
+      "PlaybackFormat": {
+        "name": "format",
+        "in": "query",
+        "schema": {"type": "string", "enum": ["hls", "dash"], "default": "hls"}
+      },
+      "ConfigVersion": {
+        "name": "version",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "integer", "minimum": 1}
+      },
+      "UserId": {
+        "name": "userId",
+        "in": "query",
+        "description": "User the request is made for, optional for operators and admins",
+        "schema": {"type": "integer", "format": "int64", "minimum": 1}
+      },
+      "UsageFrom": {
+        "name": "from",
+        "in": "query",
+        "description": "First report day, first day of current month by default",
+        "schema": {"type": "string", "format": "date"}
+      },
+      "UsageTo": {
+        "name": "to",
+        "in": "query",
+        "description": "Last report day, today by default",
+        "schema": {"type": "string", "format": "date"}
+      },
+      "RequiredUserId": {
+        "name": "userId",
+        "in": "query",
+        "required": true,
+        "description": "User the request is made for",
+        "schema": {"type": "integer", "format": "int64", "minimum": 1}
+      },
+      "ArchiveFrom": {
+        "name": "from",
+        "in": "query",
+        "description": "Range start, one day before range end by default",
+        "schema": {"type": "string", "format": "date-time"}
+      },
+      "ArchiveTo": {
+        "name": "to",
+        "in": "query",
+        "description": "Range end, now by default",
+        "schema": {"type": "string", "format": "date-time"}
+      },
+      "RuleId": {
+        "name": "ruleId",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "integer", "format": "int64"}
+      },
+      "WebhookId": {
+        "name": "webhookId",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "integer", "format": "int64"}
+      },
+      "CampaignId": {
+        "name": "campaignId",
+        "in": "path",
+        "required": true,
+        "schema": {"type": "integer", "format": "int64"}
+      }
+    },
+    "responses": {
+      "Error": {
+        "description": "Error",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    },
+    "schemas": {
+      "Info": {
+        "type": "object",
+        "properties": {
+          "vendor": {"type": "string"},
+          "version": {"type": "string"},
+          "serviceName": {"type": "string"}
+        }
+      },
+      "Command": {
+        "type": "object",
+        "required": ["command", "attribute", "gatewayIds"],
+        "x-attributes": {
+          "push": ["on", "off"],
+          "switch": ["on", "off"],
+          "setRecording": ["continuous", "motion", "schedule", "off"],
+          "ptzMove": ["up", "down", "left", "right", "zoomIn", "zoomOut", "stop"],
+          "ptzGoToPreset": null,
+          "ptzSetPreset": null,
+          "snapshot": ["return", "store"]
+        },
+        "x-deviceCommands": ["switch", "setRecording", "ptzMove", "ptzGoToPreset", "ptzSetPreset", "snapshot"],
+        "x-cameraCommands": ["ptzMove", "ptzGoToPreset", "ptzSetPreset", "snapshot"],
+        "properties": {
+          "command": {
+            "type": "string",
+            "enum": ["push", "switch", "setRecording", "ptzMove", "ptzGoToPreset", "ptzSetPreset", "snapshot"]
+          },
+          "attribute": {
+            "type": "string",
+            "maxLength": 64,
+            "description": "on or off for push and switch; continuous, motion or schedule for setRecording, off disables recording; up, down, left, right, zoomIn, zoomOut or stop for ptzMove; preset name for ptzGoToPreset and ptzSetPreset; return or store for snapshot, store also saves image as camera preview"
+          },
+          "gatewayIds": {
+            "type": "array",
+            "minItems": 1,
+            "items": {"type": "string", "format": "uuid"}
+          },
+          "deviceId": {
+            "type": "string",
+            "format": "uuid",
+            "description": "Required for every command except push, camera is required for PTZ commands and snapshot"
+          },
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "User the command is sent for, optional for operators and admins"
+          }
+        }
+      },
+      "ConfigurationPatch": {
+        "type": "object",
+        "required": ["cameras"],
+        "properties": {
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "User the configuration is changed for, optional for operators and admins"
+          },
+          "cameras": {
+            "type": "array",
+            "minItems": 1,
+            "items": {
+              "type": "object",
+              "description": "Camera is selected by deviceId or gateway local id, at least one field must be set",
+              "additionalProperties": false,
+              "properties": {
+                "id": {"type": "string"},
+                "deviceId": {"type": "string", "format": "uuid"},
+                "enabled": {"type": "string", "enum": ["on", "off"]},
+                "motionDetector": {"type": "string", "enum": ["on", "off"]},
+                "localArchive": {"type": "string", "enum": ["on", "off"]},
+                "cloudStreamingType": {"type": "string", "enum": ["continuous", "motion", "schedule"]}
+              }
+            }
+          }
+        }
+      },
+      "ConfigurationResult": {
+        "type": "object",
+        "properties": {
+          "snapshotId": {"type": "integer", "format": "int64"},
+          "version": {"type": "integer", "description": "Restored configuration version"},
+          "skipped": {"type": "array", "items": {"type": "string"}, "description": "Cameras of restored version not present on gateway"},
+          "configuration": {"type": "object", "description": "Gateway configuration as returned by gateway"}
+        }
+      },
+      "ConfigVersion": {
+        "type": "object",
+        "properties": {
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "version": {"type": "integer"},
+          "source": {"type": "string", "enum": ["get", "set"]},
+          "createdBy": {"type": "string"},
+          "createdAt": {"type": "string"},
+          "cameras": {"type": "integer"},
+          "zwave": {"type": "integer"},
+          "config": {"type": "object", "description": "Gateway configuration as returned by gateway"}
+        }
+      },
+      "FieldChange": {
+        "type": "object",
+        "properties": {
+          "field": {"type": "string"},
+          "from": {"type": "string"},
+          "to": {"type": "string"}
+        }
+      },
+      "DeviceChange": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "deviceId": {"type": "string"},
+          "changes": {"type": "array", "items": {"$ref": "#/components/schemas/FieldChange"}}
+        }
+      },
+      "ConfigDiff": {
+        "type": "object",
+        "properties": {
+          "from": {"type": "integer"},
+          "to": {"type": "integer"},
+          "gateway": {"type": "array", "items": {"$ref": "#/components/schemas/FieldChange"}},
+          "camerasAdded": {"type": "array", "items": {"type": "object"}},
+          "camerasRemoved": {"type": "array", "items": {"type": "object"}},
+          "camerasChanged": {"type": "array", "items": {"$ref": "#/components/schemas/DeviceChange"}},
+          "zwaveAdded": {"type": "array", "items": {"type": "object"}},
+          "zwaveRemoved": {"type": "array", "items": {"type": "object"}},
+          "zwaveChanged": {"type": "array", "items": {"$ref": "#/components/schemas/DeviceChange"}}
+        }
+      },
+      "Gateway": {
+        "type": "object",
+        "properties": {
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "transport": {"type": "string", "enum": ["amqp", "mqtt", "http"]},
+          "connectedAt": {"type": "string", "format": "date-time"},
+          "lastMessageAt": {"type": "string", "format": "date-time"},
+          "logicLoaded": {"type": "boolean"},
+          "ownerId": {"type": "integer", "format": "int64", "description": "Known when business logic is loaded"}
+        }
+      },
+      "GatewayDetails": {
+        "allOf": [
+          {"$ref": "#/components/schemas/Gateway"},
+          {
+            "type": "object",
+            "properties": {
+              "cameras": {"type": "array", "items": {"$ref": "#/components/schemas/Camera"}},
+              "sensors": {"type": "array", "items": {"$ref": "#/components/schemas/Sensor"}}
+            }
+          }
+        ]
+      },
+      "Camera": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "title": {"type": "string"},
+          "userId": {"type": "integer", "format": "int64"},
+          "recordingMode": {"type": "string", "enum": ["none", "continuous", "motion", "schedule"]},
+          "schedule": {"type": "string"},
+          "motionInProcess": {"type": "boolean"},
+          "recorded": {"type": "boolean", "description": "Camera stream is recorded by cloud"},
+          "mediaserverIp": {"type": "string"},
+          "applicationName": {"type": "string"}
+        }
+      },
+      "Tariff": {
+        "type": "object",
+        "description": "Zero limits mean no limit",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "title": {"type": "string"},
+          "continuousRecording": {"type": "boolean"},
+          "motionRecording": {"type": "boolean"},
+          "scheduleRecording": {"type": "boolean"},
+          "retentionDays": {"type": "integer"},
+          "maxCameras": {"type": "integer"},
+          "pushAllowed": {"type": "boolean"},
+          "sensorHistoryDays": {"type": "integer"},
+          "paid": {"type": "boolean", "description": "Recording requires positive balance"}
+        }
+      },
+      "Policy": {
+        "type": "object",
+        "properties": {
+          "userId": {"type": "integer", "format": "int64"},
+          "tariff": {"$ref": "#/components/schemas/Tariff"},
+          "privileged": {"type": "boolean", "description": "VIP or legal entity recording on any tariff"},
+          "funded": {"type": "boolean"},
+          "recording": {
+            "type": "object",
+            "properties": {
+              "continuous": {"type": "boolean"},
+              "motion": {"type": "boolean"},
+              "schedule": {"type": "boolean"}
+            }
+          },
+          "push": {"type": "boolean"},
+          "retentionDays": {"type": "integer"},
+          "sensorHistoryDays": {"type": "integer"}
+        }
+      },
+      "DailyUsage": {
+        "type": "object",
+        "properties": {
+          "day": {"type": "string", "format": "date"},
+          "userId": {"type": "integer", "format": "int64"},
+          "deviceId": {"type": "string", "format": "uuid"},
+          "recordingSeconds": {"type": "integer", "format": "int64"},
+          "streamingSeconds": {"type": "integer", "format": "int64"},
+          "sensorPoints": {"type": "integer", "format": "int64"}
+        }
+      },
+      "UsageReport": {
+        "type": "object",
+        "properties": {
+          "userId": {"type": "integer", "format": "int64"},
+          "from": {"type": "string", "format": "date"},
+          "to": {"type": "string", "format": "date"},
+          "days": {"type": "array", "items": {"$ref": "#/components/schemas/DailyUsage"}},
+          "devices": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "userId": {"type": "integer", "format": "int64"},
+                "deviceId": {"type": "string", "format": "uuid"},
+                "recordingHours": {"type": "number"},
+                "streamingHours": {"type": "number"},
+                "sensorPoints": {"type": "integer", "format": "int64"}
+              }
+            }
+          }
+        }
+      },
+      "AccountEventRequest": {
+        "type": "object",
+        "required": ["type"],
+        "properties": {
+          "type": {"type": "string", "enum": ["balanceChanged", "blocked", "unblocked", "tariffChanged"]},
+          "money": {"type": "integer", "format": "int64", "description": "New balance, read from database if missing"},
+          "tariffId": {"type": "integer", "format": "int64", "description": "Required for tariffChanged"},
+          "reason": {"type": "string"}
+        }
+      },
+      "AccountEvent": {
+        "type": "object",
+        "properties": {
+          "type": {"type": "string"},
+          "userId": {"type": "integer", "format": "int64"},
+          "money": {"type": "integer", "format": "int64"},
+          "tariffId": {"type": "integer", "format": "int64"},
+          "reason": {"type": "string"},
+          "timestampMs": {"type": "string"}
+        }
+      },
+      "LiveStream": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "state": {"type": "string", "enum": ["starting", "live", "stopped"]},
+          "mediaserverIp": {"type": "string"},
+          "applicationName": {"type": "string"},
+          "onDemand": {"type": "boolean", "description": "Streaming was started for live view"},
+          "viewers": {"type": "integer"},
+          "since": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Playback": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "format": {"type": "string", "enum": ["hls", "dash"]},
+          "url": {"type": "string"},
+          "expiresAt": {"type": "string", "format": "date-time", "description": "Missing if URL signing is not configured"}
+        }
+      },
+      "LiveSession": {
+        "type": "object",
+        "properties": {
+          "sessionId": {"type": "string", "format": "uuid"},
+          "deviceId": {"type": "string", "format": "uuid"},
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "userId": {"type": "integer", "format": "int64"},
+          "playbackUrl": {"type": "string", "description": "Signed if URL signing is configured"},
+          "playbackExpiresAt": {"type": "string", "format": "date-time"},
+          "createdAt": {"type": "string", "format": "date-time"},
+          "lastSeenAt": {"type": "string", "format": "date-time"},
+          "expiresIn": {"type": "integer", "description": "Seconds to send next heartbeat in"}
+        }
+      },
+      "Sensor": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "title": {"type": "string"},
+          "userId": {"type": "integer", "format": "int64"},
+          "values": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "label": {"type": "string"},
+                "description": {"type": "string"},
+                "value": {"type": "string"},
+                "timestamp": {"type": "string", "format": "date-time"},
+                "influx": {"type": "boolean"},
+                "notify": {"type": "boolean"}
+              }
+            }
+          }
+        }
+      },
+      "CommandResult": {
+        "type": "object",
+        "properties": {
+          "status": {"type": "string", "enum": ["OK"]},
+          "gatewayId": {"type": "string", "format": "uuid", "description": "Snapshot only"},
+          "deviceId": {"type": "string", "format": "uuid", "description": "Snapshot only"},
+          "preview": {"type": "string", "description": "Snapshot image as returned by gateway"},
+          "timestampMs": {"type": "string", "description": "Snapshot only"},
+          "stored": {"type": "boolean", "description": "Snapshot is stored as camera preview"}
+        }
+      },
+      "GatewayRef": {
+        "type": "object",
+        "properties": {
+          "gatewayId": {"type": "string", "format": "uuid"}
+        }
+      },
+      "UserRequest": {
+        "type": "object",
+        "properties": {
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "User the request is made for, optional for operators and admins"
+          }
+        }
+      },
+      "GatewayDevices": {
+        "type": "object",
+        "properties": {
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "devices": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "deviceId": {"type": "string", "format": "uuid"},
+                "deviceType": {"type": "string"},
+                "reported": {"$ref": "#/components/schemas/DeviceProperties"},
+                "desired": {"$ref": "#/components/schemas/DeviceProperties"},
+                "updatedAt": {"type": "string", "format": "date-time"}
+              }
+            }
+          }
+        }
+      },
+      "DeviceProperties": {
+        "type": "object",
+        "additionalProperties": {
+          "type": "object",
+          "properties": {
+            "value": {"type": "string"},
+            "timestamp": {"type": "string", "format": "date-time"}
+          }
+        }
+      },
+      "GatewaySecret": {
+        "type": "object",
+        "properties": {
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "secret": {"type": "string", "description": "Returned once, gateway signs messages with it"}
+        }
+      },
+      "GatewayAuditRecord": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "claimedGatewayId": {"type": "string"},
+          "transport": {"type": "string", "enum": ["amqp", "mqtt", "http"]},
+          "reason": {"type": "string"},
+          "messageType": {"type": "string"},
+          "deviceId": {"type": "string"},
+          "createdAt": {"type": "string"}
+        }
+      },
+      "GatewayShare": {
+        "type": "object",
+        "properties": {
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "userId": {"type": "integer", "format": "int64"},
+          "access": {"type": "string", "enum": ["read", "full"]},
+          "createdAt": {"type": "string"}
+        }
+      },
+      "GatewayShareRequest": {
+        "type": "object",
+        "required": ["userId", "access"],
+        "properties": {
+          "userId": {"type": "integer", "format": "int64", "description": "User the gateway is shared with"},
+          "access": {"type": "string", "enum": ["read", "full"]}
+        }
+      },
+      "SensorHistory": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "label": {"type": "string"},
+          "from": {"type": "string", "format": "date-time"},
+          "to": {"type": "string", "format": "date-time"},
+          "step": {"type": "string"},
+          "agg": {"type": "string", "enum": ["mean", "min", "max", "last"]},
+          "points": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "timestampMs": {"type": "string"},
+                "value": {"type": "number"}
+              }
+            }
+          }
+        }
+      },
+      "LocalArchive": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "from": {"type": "string", "format": "date-time"},
+          "to": {"type": "string", "format": "date-time"},
+          "segments": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "start": {"type": "string"},
+                "end": {"type": "string"},
+                "size": {"type": "integer", "format": "int64"},
+                "url": {"type": "string"}
+              }
+            }
+          }
+        }
+      },
+      "ArchiveUploadRequest": {
+        "type": "object",
+        "required": ["from", "to"],
+        "properties": {
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "User the upload is requested for, optional for operators and admins"
+          },
+          "from": {"type": "string", "format": "date-time"},
+          "to": {"type": "string", "format": "date-time"}
+        }
+      },
+      "ArchiveUpload": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string", "format": "uuid"},
+          "deviceId": {"type": "string", "format": "uuid"},
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "userId": {"type": "integer", "format": "int64"},
+          "rangeStart": {"type": "integer", "format": "int64", "description": "Unix milliseconds"},
+          "rangeEnd": {"type": "integer", "format": "int64", "description": "Unix milliseconds"},
+          "status": {"type": "string", "enum": ["requested", "uploading", "completed", "failed"]},
+          "progress": {"type": "integer", "minimum": 0, "maximum": 100},
+          "segments": {"type": "integer"},
+          "error": {"type": "string"},
+          "createdAt": {"type": "string"},
+          "updatedAt": {"type": "string"}
+        }
+      },
+      "CloudArchive": {
+        "type": "object",
+        "properties": {
+          "deviceId": {"type": "string", "format": "uuid"},
+          "from": {"type": "string", "format": "date-time"},
+          "to": {"type": "string", "format": "date-time"},
+          "segments": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "uploadId": {"type": "string", "format": "uuid"},
+                "deviceId": {"type": "string", "format": "uuid"},
+                "start": {"type": "string", "format": "date-time"},
+                "end": {"type": "string", "format": "date-time"},
+                "size": {"type": "integer", "format": "int64"},
+                "url": {"type": "string", "description": "Signed if URL signing is configured"},
+                "expiresAt": {"type": "string", "format": "date-time"}
+              }
+            }
+          }
+        }
+      },
+      "DeviceToken": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "deviceId": {"type": "string", "format": "uuid"},
+          "title": {"type": "string"},
+          "createdAt": {"type": "string"},
+          "lastUsedAt": {"type": "string"}
+        }
+      },
+      "DeviceTokenRequest": {
+        "type": "object",
+        "properties": {
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "User the token is created for, optional for operators and admins"
+          },
+          "title": {"type": "string"}
+        }
+      },
+      "DeviceTokenCreated": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "deviceId": {"type": "string", "format": "uuid"},
+          "title": {"type": "string"},
+          "token": {"type": "string", "description": "Returned once, only token hash is stored"}
+        }
+      },
+      "IngestMessage": {
+        "type": "object",
+        "required": ["messageType"],
+        "description": "Device and gateway ids are taken from device token when missing",
+        "properties": {
+          "messageType": {"type": "string", "enum": ["sensorData", "deviceState"]},
+          "timestampMs": {"type": "string"},
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "deviceId": {"type": "string", "format": "uuid"},
+          "deviceType": {"type": "string", "enum": ["sensor"]},
+          "deviceState": {"type": "string"},
+          "sensorType": {"type": "string"},
+          "sensorData": {"type": "string"},
+          "label": {"type": "string"},
+          "units": {"type": "string"}
+        }
+      },
+      "Rule": {
+        "type": "object",
+        "required": ["gatewayId", "trigger", "actions"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64", "readOnly": true},
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "Rule owner, optional for operators and admins"
+          },
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "title": {"type": "string"},
+          "enabled": {"type": "boolean"},
+          "timezone": {
+            "type": "string",
+            "description": "IANA timezone schedule triggers and time range conditions are evaluated in, UTC if empty"
+          },
+          "trigger": {
+            "type": "object",
+            "required": ["type"],
+            "properties": {
+              "type": {"type": "string", "enum": ["sensorValue", "motion", "gatewayOffline", "schedule"]},
+              "deviceId": {"type": "string", "format": "uuid"},
+              "label": {"type": "string"},
+              "operator": {"$ref": "#/components/schemas/RuleOperator"},
+              "value": {"type": "string"},
+              "time": {"type": "string", "description": "HH:MM for schedule trigger"},
+              "weekdays": {
+                "type": "array",
+                "description": "0 is Sunday, empty means every day",
+                "items": {"type": "integer", "minimum": 0, "maximum": 6}
+              }
+            }
+          },
+          "conditions": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["type"],
+              "properties": {
+                "type": {"type": "string", "enum": ["deviceState", "timeRange"]},
+                "deviceId": {"type": "string", "format": "uuid"},
+                "property": {"type": "string"},
+                "operator": {"$ref": "#/components/schemas/RuleOperator"},
+                "value": {"type": "string"},
+                "from": {"type": "string", "description": "HH:MM for time range condition"},
+                "to": {"type": "string", "description": "HH:MM for time range condition"}
+              }
+            }
+          },
+          "actions": {
+            "type": "array",
+            "minItems": 1,
+            "items": {
+              "type": "object",
+              "required": ["type"],
+              "properties": {
+                "type": {"type": "string", "enum": ["gatewayCommand", "startRecording", "stopRecording", "push", "webhook"]},
+                "deviceId": {"type": "string", "format": "uuid"},
+                "deviceType": {"type": "string"},
+                "protocol": {"type": "string"},
+                "command": {"type": "string"},
+                "attribute": {"type": "string"},
+                "title": {"type": "string"},
+                "content": {"type": "string"},
+                "webhookId": {"type": "integer", "format": "int64", "description": "Rule owner webhook the rule.fired event is delivered to"}
+              }
+            }
+          }
+        }
+      },
+      "RuleOperator": {
+        "type": "string",
+        "enum": ["eq", "ne", "gt", "ge", "lt", "le"]
+      },
+      "Webhook": {
+        "type": "object",
+        "required": ["url"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64", "readOnly": true},
+          "userId": {
+            "type": "integer",
+            "format": "int64",
+            "description": "Webhook owner, optional for operators and admins"
+          },
+          "url": {"type": "string", "format": "uri", "description": "Public HTTP or HTTPS address"},
+          "secret": {
+            "type": "string",
+            "writeOnly": true,
+            "description": "Deliveries are signed with HMAC-SHA256 of it, returned only when webhook is created"
+          },
+          "eventTypes": {"type": "array", "items": {"type": "string"}, "description": "Every event type if empty"},
+          "enabled": {"type": "boolean"},
+          "failures": {"type": "integer", "readOnly": true}
+        }
+      },
+      "WebhookCreated": {
+        "allOf": [
+          {"$ref": "#/components/schemas/Webhook"},
+          {
+            "type": "object",
+            "properties": {
+              "secret": {"type": "string", "description": "Returned once on webhook creation"}
+            }
+          }
+        ]
+      },
+      "WebhookDelivery": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "webhookId": {"type": "integer", "format": "int64"},
+          "eventId": {"type": "string"},
+          "eventType": {"type": "string"},
+          "attempt": {"type": "integer"},
+          "statusCode": {"type": "integer"},
+          "error": {"type": "string"},
+          "durationMs": {"type": "integer", "format": "int64"},
+          "createdAt": {"type": "string"}
+        }
+      },
+      "APIKey": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "name": {"type": "string"},
+          "role": {"$ref": "#/components/schemas/Role"},
+          "userIds": {"type": "array", "items": {"type": "integer", "format": "int64"}, "description": "Users the key is scoped to"},
+          "enabled": {"type": "boolean"},
+          "createdAt": {"type": "string"},
+          "lastUsedAt": {"type": "string"}
+        }
+      },
+      "APIKeyRequest": {
+        "type": "object",
+        "required": ["name", "role"],
+        "properties": {
+          "name": {"type": "string"},
+          "role": {"$ref": "#/components/schemas/Role"},
+          "userIds": {"type": "array", "items": {"type": "integer", "format": "int64"}, "description": "Users the key is scoped to, operator and admin keys are unscoped if empty"}
+        }
+      },
+      "APIKeyCreated": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "name": {"type": "string"},
+          "role": {"$ref": "#/components/schemas/Role"},
+          "userIds": {"type": "array", "items": {"type": "integer", "format": "int64"}},
+          "key": {"type": "string", "description": "Returned once, only key hash is stored"}
+        }
+      },
+      "Role": {
+        "type": "string",
+        "enum": ["readonly", "integrator", "operator", "admin"]
+      },
+      "RestartFilter": {
+        "type": "object",
+        "description": "Gateways matching every defined filter are restarted, all is required to restart every connected gateway",
+        "properties": {
+          "gatewayIds": {"type": "array", "items": {"type": "string", "format": "uuid"}},
+          "ownerId": {"type": "integer", "format": "int64"},
+          "versions": {"type": "array", "items": {"type": "string"}},
+          "all": {"type": "boolean"},
+          "dryRun": {"type": "boolean"}
+        }
+      },
+      "RestartResult": {
+        "type": "object",
+        "properties": {
+          "dryRun": {"type": "boolean"},
+          "targets": {"type": "array", "items": {"$ref": "#/components/schemas/Gateway"}},
+          "restarted": {"type": "array", "items": {"type": "string", "format": "uuid"}},
+          "failed": {"type": "array", "items": {"type": "string", "format": "uuid"}}
+        }
+      },
+      "Firmware": {
+        "type": "object",
+        "required": ["version", "url", "checksum"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64", "readOnly": true},
+          "version": {"type": "string"},
+          "url": {"type": "string", "format": "uri"},
+          "checksum": {"type": "string"},
+          "models": {"type": "array", "items": {"type": "string"}, "description": "Every model if empty"},
+          "notes": {"type": "string"},
+          "createdAt": {"type": "string", "readOnly": true}
+        }
+      },
+      "CampaignStatus": {
+        "type": "string",
+        "enum": ["draft", "running", "paused", "halted", "completed", "cancelled"]
+      },
+      "Campaign": {
+        "type": "object",
+        "required": ["firmwareId", "stages"],
+        "properties": {
+          "id": {"type": "integer", "format": "int64", "readOnly": true},
+          "firmwareId": {"type": "integer", "format": "int64"},
+          "title": {"type": "string"},
+          "stages": {
+            "type": "array",
+            "description": "Ascending cumulative percentages of target gateways, last one is 100",
+            "items": {"type": "integer", "minimum": 1, "maximum": 100}
+          },
+          "stage": {"type": "integer", "readOnly": true},
+          "failureThreshold": {"type": "number", "minimum": 0, "maximum": 100, "description": "Percentage of failed updates rollout is halted above"},
+          "ownerId": {"type": "integer", "format": "int64", "description": "Only gateways of owner are targeted"},
+          "fromVersions": {"type": "array", "items": {"type": "string"}, "description": "Only gateways with these versions are targeted"},
+          "status": {"$ref": "#/components/schemas/CampaignStatus"},
+          "reason": {"type": "string", "readOnly": true},
+          "createdAt": {"type": "string", "readOnly": true},
+          "updatedAt": {"type": "string", "readOnly": true}
+        }
+      },
+      "CampaignDetails": {
+        "allOf": [
+          {"$ref": "#/components/schemas/Campaign"},
+          {
+            "type": "object",
+            "properties": {
+              "progress": {
+                "type": "object",
+                "description": "Number of gateway updates by status",
+                "additionalProperties": {"type": "integer"}
+              }
+            }
+          }
+        ]
+      },
+      "FirmwareUpdate": {
+        "type": "object",
+        "properties": {
+          "campaignId": {"type": "integer", "format": "int64"},
+          "gatewayId": {"type": "string", "format": "uuid"},
+          "fromVersion": {"type": "string"},
+          "status": {"type": "string", "enum": ["pending", "sent", "downloading", "installing", "completed", "failed", "skipped"]},
+          "error": {"type": "string"},
+          "updatedAt": {"type": "string"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "required": ["code", "error"],
+        "properties": {
+          "code": {
+            "type": "string",
+            "enum": ["invalidRequest", "unauthorized", "forbidden", "notFound",
+              "gatewayUnavailable", "upstreamFailed", "internalError"]
+          },
+          "error": {"type": "string", "description": "Human readable error message"},
+          "field": {"type": "string", "description": "Request field failed validation"}
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,185 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// deviceInfo holds device data required for access checks and history requests
+type deviceInfo struct {
+	GatewayID  string
+	UserID     uint64
+	DeviceType string
+}
+
+// getDeviceInfo searches sensor or camera in database.
+// Returns nil if device not found.
+func (s *Server) getDeviceInfo(deviceID string) (*deviceInfo, error) {
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	queryText :=
+		`SELECT dev.gateway_id, dev.user_id, 'sensor' AS device_type
+		FROM v3_devices AS dev
+		WHERE dev.device_id = ?
+		UNION ALL
+		SELECT cam.gateway_id, cam.uid, 'camera' AS device_type
+		FROM camers AS cam
+		WHERE cam.stream_id = ?
+		LIMIT 1;`
+	info := &deviceInfo{}
+	err := s.conn.Db.QueryRowContext(ctx, queryText, deviceID, deviceID).
+		Scan(&info.GatewayID, &info.UserID, &info.DeviceType)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed searching device in database")
+	}
+	return info, nil
+}
+
+// Access levels of user to gateway and its devices
+const (
+	accessNone  = ""
+	accessRead  = "read"
+	accessFull  = "full"
+	accessOwner = "owner"
+)
+
+var accessLevels = map[string]int{
+	accessNone:  0,
+	accessRead:  1,
+	accessFull:  2,
+	accessOwner: 3,
+}
+
+// getGatewayAccess returns access level of user to gateway granted
+// by ownership or sharing. Found flag is false if gateway does not exist.
+func (s *Server) getGatewayAccess(gatewayID string, userID uint64) (access string, found bool, err error) {
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	queryText :=
+		`SELECT gw.user_id, IFNULL(sh.access, '')
+		FROM v3_gateways AS gw
+			LEFT JOIN v3_gateway_shares AS sh
+				ON sh.gateway_id = gw.gateway_id AND sh.user_id = ?
+		WHERE gw.gateway_id = ?;`
+	var ownerID uint64
+	err = s.conn.Db.QueryRowContext(ctx, queryText, userID, gatewayID).Scan(&ownerID, &access)
+	if err == sql.ErrNoRows {
+		return accessNone, false, nil
+	}
+	if err != nil {
+		return accessNone, false, errors.Wrap(err, "failed checking gateway access")
+	}
+	if ownerID == userID {
+		return accessOwner, true, nil
+	}
+	return access, true, nil
+}
+
+// checkGatewayAccess checks that user has required access to gateway
+// and writes error response if needed. Zero user means unscoped service call.
+func (s *Server) checkGatewayAccess(c *gin.Context, gatewayID string, userID uint64, need string) bool {
+	if userID == 0 {
+		return true
+	}
+	access, found, err := s.getGatewayAccess(gatewayID, userID)
+	if err != nil {
+		logger.Error("error checking gateway access", "error", err, "gateway", gatewayID)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "failed checking gateway access")
+		return false
+	}
+	if !found {
+		respondError(c, http.StatusNotFound, codeNotFound, "gateway not found")
+		return false
+	}
+	if accessLevels[access] < accessLevels[need] {
+		logger.Warn("Access to gateway denied", "gateway", gatewayID, "user", userID,
+			"access", access, "need", need)
+		respondError(c, http.StatusForbidden, codeForbidden, "no access to gateway")
+		return false
+	}
+	return true
+}
+
+// checkDeviceAccess checks that user has required access to device gateway
+// and writes error response if needed. Devices without gateway are checked by owner.
+func (s *Server) checkDeviceAccess(c *gin.Context, deviceID string, userID uint64, need string) (*deviceInfo, bool) {
+	info, err := s.getDeviceInfo(deviceID)
+	if err != nil {
+		logger.Error("error getting device info", "error", err, "device", deviceID)
+		respondError(c, http.StatusInternalServerError, codeInternalError, "failed getting device info")
+		return nil, false
+	}
+	if info == nil {
+		respondError(c, http.StatusNotFound, codeNotFound, "device not found")
+		return nil, false
+	}
+	if userID == 0 {
+		return info, true
+	}
+	if len(info.GatewayID) == 0 {
+		if info.UserID != userID {
+			respondError(c, http.StatusForbidden, codeForbidden, "device is not owned by user")
+			return nil, false
+		}
+		return info, true
+	}
+	if !s.checkGatewayAccess(c, info.GatewayID, userID, need) {
+		return nil, false
+	}
+	return info, true
+}
+
+// requestUser validates id of user the request is made for.
+// Only unscoped callers may omit user, zero is returned then.
+func requestUser(c *gin.Context, userID uint64) (uint64, bool) {
+	if userID == 0 {
+		if p := getPrincipal(c); p != nil && p.unscoped() {
+			return 0, true
+		}
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "wrong or missing userId")
+		return 0, false
+	}
+	if !authorizeUser(c, userID) {
+		return 0, false
+	}
+	return userID, true
+}
+
+// queryUser parses optional userId query param and validates it with requestUser
+func queryUser(c *gin.Context) (uint64, bool) {
+	var userID uint64
+	if value := c.Query("userId"); len(value) > 0 {
+		var err error
+		if userID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "wrong userId")
+			return 0, false
+		}
+	}
+	return requestUser(c, userID)
+}
+
+// containsString checks that list holds value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package rest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("fatal", os.DevNull, false)
+	gin.SetMode(gin.TestMode)
+	viper.Set("db.cloud.timeout", time.Second)
+	sql.Register("resttest", fakeDriver{})
+	os.Exit(m.Run())
+}
+
+// Test data served by fake database
+var (
+	testGatewayOwners = map[string]int64{"gw-1": 10}
+	testGatewayShares = map[string]map[int64]string{"gw-1": {20: accessRead, 30: accessFull}}
+	testAPIKeys       = map[string][]driver.Value{
+		hashDeviceToken("integrator-key"): {int64(1), "crm", RoleIntegrator, "[5,6]"},
+		hashDeviceToken("unknown-role"):   {int64(2), "legacy", "superuser", "[]"},
+	}
+)
+
+// newTestServer makes server with fake database serving test data
+func newTestServer(t *testing.T) *Server {
+	db, err := sql.Open("resttest", "")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	return &Server{conn: &database.Connection{Db: sqlx.NewDb(db, "mysql")}}
+}
+
+func TestCheckGatewayAccess(t *testing.T) {
+	tests := []struct {
+		name      string
+		gatewayID string
+		userID    uint64
+		need      string
+		want      bool
+		status    int
+	}{
+		{"service call skips check", "gw-2", 0, accessOwner, true, http.StatusOK},
+		{"owner has owner access", "gw-1", 10, accessOwner, true, http.StatusOK},
+		{"owner has full access", "gw-1", 10, accessFull, true, http.StatusOK},
+		{"read share reads", "gw-1", 20, accessRead, true, http.StatusOK},
+		{"read share can not command", "gw-1", 20, accessFull, false, http.StatusForbidden},
+		{"full share commands", "gw-1", 30, accessFull, true, http.StatusOK},
+		{"full share is not owner", "gw-1", 30, accessOwner, false, http.StatusForbidden},
+		{"stranger can not read", "gw-1", 40, accessRead, false, http.StatusForbidden},
+		{"unknown gateway", "gw-2", 10, accessRead, false, http.StatusNotFound},
+	}
+	s := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if got := s.checkGatewayAccess(c, tt.gatewayID, tt.userID, tt.need); got != tt.want {
+				t.Errorf("checkGatewayAccess() = %v, want %v", got, tt.want)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+// fakeDriver answers queries of access checks with test data,
+// so they are tested without MySQL server
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query: query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows := &fakeRows{}
+	switch {
+	case strings.Contains(s.query, "v3_gateway_shares"):
+		rows.columns = []string{"user_id", "access"}
+		userID, gatewayID := args[0].(int64), args[1].(string)
+		if owner, ok := testGatewayOwners[gatewayID]; ok {
+			rows.values = append(rows.values, []driver.Value{owner, testGatewayShares[gatewayID][userID]})
+		}
+	case strings.Contains(s.query, "v3_api_keys"):
+		rows.columns = []string{"id", "name", "role", "user_ids"}
+		if key, ok := testAPIKeys[args[0].(string)]; ok {
+			rows.values = append(rows.values, key)
+		}
+	default:
+		return nil, errors.Errorf("unexpected query %q", s.query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
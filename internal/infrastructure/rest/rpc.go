@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/broker"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// deviceRPC sends RPC request for gateway device and writes error response
+// if gateway is not connected, does not respond or reports failure
+func (s *Server) deviceRPC(c *gin.Context, request *entities.IotMessage, failText string) (*entities.IotMessage, bool) {
+	response, err := s.mgr.DoGatewayRPC(request.GatewayId, request)
+	if errors.Cause(err) == broker.ErrGatewayNotConnected {
+		respondError(c, http.StatusNotFound, codeGatewayUnavailable, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		errorText := "gateway RPC request failed"
+		logger.Error(errorText, "error", err, "gateway", request.GatewayId,
+			"device", request.DeviceId, "command", request.Command)
+		respondError(c, http.StatusBadGateway, codeGatewayUnavailable, errorText)
+		return nil, false
+	}
+	if response == nil {
+		errorText := "no response returned by gateway"
+		logger.Error(errorText, "gateway", request.GatewayId,
+			"device", request.DeviceId, "command", request.Command)
+		respondError(c, http.StatusBadGateway, codeGatewayUnavailable, errorText)
+		return nil, false
+	}
+	if response.Status == "failed" {
+		errorText := failText
+		if len(response.Content) > 0 {
+			errorText += ": " + response.Content
+		}
+		logger.Error(errorText, "gateway", request.GatewayId, "device", request.DeviceId)
+		respondError(c, http.StatusBadGateway, codeUpstreamFailed, errorText)
+		return nil, false
+	}
+	return response, true
+}
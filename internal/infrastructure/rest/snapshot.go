@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tasks"
+	"github.com/gin-gonic/gin"
+)
+
+// takeSnapshot requests still image from camera with RPC and writes it in
+// response. Image is stored as camera preview if requested.
+func (s *Server) takeSnapshot(c *gin.Context, gatewayID, deviceID string, store bool) {
+
+	// Create RPC request for gateway
+	request := entities.CreateCloudIotMessage(gatewayID, deviceID)
+	request.DeviceType = "camera"
+	request.Protocol = "onvif"
+	request.MessageType = "command"
+	request.Command = "snapshot"
+
+	response, ok := s.deviceRPC(c, request, "camera failed taking snapshot")
+	if !ok {
+		return
+	}
+	if len(response.Preview) == 0 {
+		errorText := "no snapshot returned"
+		logger.Error(errorText, "gateway", gatewayID, "device", deviceID)
+		respondError(c, http.StatusBadGateway, codeGatewayUnavailable, errorText)
+		return
+	}
+
+	if store {
+		// Store snapshot as camera preview before responding
+		preview := entities.CreateCloudIotMessage(gatewayID, deviceID)
+		preview.MessageType = "preview"
+		preview.Preview = response.Preview
+		tasks.NewStorePreviewTask(s.conn).Run(preview)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "OK",
+		"gatewayId":   gatewayID,
+		"deviceId":    deviceID,
+		"preview":     response.Preview,
+		"timestampMs": response.Timestamp,
+		"stored":      store,
+	})
+}
@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/gatewayconfig"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Command validation rules loaded from OpenAPI specification
+var (
+	// Commands accepted by /command endpoint with their allowed attributes.
+	// Any non-empty attribute is allowed for commands without list.
+	commandAttributes map[string][]string
+	// Commands addressed to device and requiring deviceId
+	deviceCommands map[string]bool
+	// Commands addressed to camera
+	cameraCommands map[string]bool
+	// Max length of attribute without list, e.g. PTZ preset name
+	maxAttributeLength int
+)
+
+// commandSchema holds validation rules of Command schema in OpenAPI specification
+type commandSchema struct {
+	Attributes     map[string][]string `json:"x-attributes"`
+	DeviceCommands []string            `json:"x-deviceCommands"`
+	CameraCommands []string            `json:"x-cameraCommands"`
+	Properties     struct {
+		Attribute struct {
+			MaxLength int `json:"maxLength"`
+		} `json:"attribute"`
+	} `json:"properties"`
+}
+
+func init() {
+	var spec struct {
+		Components struct {
+			Schemas struct {
+				Command commandSchema `json:"Command"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal([]byte(openAPISpec), &spec); err != nil {
+		panic(errors.Wrap(err, "failed parsing OpenAPI specification"))
+	}
+	schema := &spec.Components.Schemas.Command
+	if len(schema.Attributes) == 0 || schema.Properties.Attribute.MaxLength == 0 {
+		panic("no command validation rules in OpenAPI specification")
+	}
+
+	commandAttributes = schema.Attributes
+	deviceCommands = stringSet(schema.DeviceCommands)
+	cameraCommands = stringSet(schema.CameraCommands)
+	maxAttributeLength = schema.Properties.Attribute.MaxLength
+}
+
+// stringSet converts list to set
+func stringSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, value := range list {
+		set[value] = true
+	}
+	return set
+}
+
+// validate checks command data against OpenAPI specification
+func (d *commandData) validate() *fieldError {
+	attributes, ok := commandAttributes[d.Command]
+	if !ok {
+		if len(d.Command) == 0 {
+			return &fieldError{Field: "command", Message: "missing command"}
+		}
+		return &fieldError{Field: "command", Message: "unknown command " + d.Command}
+	}
+	switch {
+	case attributes == nil && len(d.Attribute) == 0:
+		return &fieldError{Field: "attribute", Message: "missing attribute"}
+	case attributes == nil && len(d.Attribute) > maxAttributeLength:
+		return &fieldError{Field: "attribute", Message: "attribute is too long"}
+	case attributes != nil && !containsString(attributes, d.Attribute):
+		return &fieldError{Field: "attribute",
+			Message: "attribute must be one of " + strings.Join(attributes, ", ")}
+	}
+
+	if len(d.GatewayIds) == 0 {
+		return &fieldError{Field: "gatewayIds", Message: "no gateways defined"}
+	}
+	for _, gatewayID := range d.GatewayIds {
+		if !isValidUUID(gatewayID) {
+			return &fieldError{Field: "gatewayIds", Message: "wrong gateway id " + gatewayID}
+		}
+	}
+
+	if deviceCommands[d.Command] && len(d.DeviceID) == 0 {
+		return &fieldError{Field: "deviceId", Message: "deviceId is required for " + d.Command}
+	}
+	if len(d.DeviceID) > 0 && !isValidUUID(d.DeviceID) {
+		return &fieldError{Field: "deviceId", Message: "wrong device id"}
+	}
+	return nil
+}
+
+// validate checks that only remotely settable camera fields are defined
+// with allowed values
+func (d *configurationPatch) validate() *fieldError {
+	if len(d.Cameras) == 0 {
+		return &fieldError{Field: "cameras", Message: "no cameras defined"}
+	}
+	for i := range d.Cameras {
+		camera := &d.Cameras[i]
+		field := fmt.Sprintf("cameras[%d]", i)
+		if len(camera.DeviceID) == 0 && len(camera.ID) == 0 {
+			return &fieldError{Field: field + ".deviceId", Message: "deviceId or id is required"}
+		}
+		if len(camera.DeviceID) > 0 && !isValidUUID(camera.DeviceID) {
+			return &fieldError{Field: field + ".deviceId", Message: "wrong device id"}
+		}
+		if *camera != gatewayconfig.CameraPatch(camera) {
+			return &fieldError{Field: field,
+				Message: "only " + strings.Join(gatewayconfig.CameraFields, ", ") + " can be set"}
+		}
+		values := gatewayconfig.SettableFields(camera)
+		defined := 0
+		for _, name := range gatewayconfig.CameraFields {
+			if len(values[name]) == 0 {
+				continue
+			}
+			defined++
+			allowed := gatewayconfig.CameraFieldValues[name]
+			if !containsString(allowed, values[name]) {
+				return &fieldError{Field: field + "." + name,
+					Message: name + " must be one of " + strings.Join(allowed, ", ")}
+			}
+		}
+		if defined == 0 {
+			return &fieldError{Field: field, Message: "no configuration fields defined"}
+		}
+	}
+	return nil
+}
+
+// isValidUUID checks that value is UUID in canonical form
+func isValidUUID(value string) bool {
+	if len(value) != 36 {
+		return false
+	}
+	_, err := uuid.Parse(value)
+	return err == nil
+}
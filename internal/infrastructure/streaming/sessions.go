@@ -0,0 +1,549 @@
+package streaming
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/broker"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Stream states
+const (
+	StateStarting = "starting"
+	StateLive     = "live"
+	StateStopped  = "stopped"
+)
+
+var (
+	// ErrStreamNotStarted is returned when camera did not start streaming in time
+	ErrStreamNotStarted = errors.New("camera did not start streaming")
+	// ErrStreamStopped is returned when camera stopped streaming while viewer watched it
+	ErrStreamStopped = errors.New("camera stopped streaming")
+	// ErrStreamingRejected is returned when gateway failed cloud streaming command
+	ErrStreamingRejected = errors.New("gateway rejected cloud streaming command")
+	// ErrSessionNotFound is returned for unknown or expired viewer session
+	ErrSessionNotFound = errors.New("viewer session not found")
+)
+
+// abortedStartTTL is time camera may still report streaming started on demand
+// after viewer gave up waiting for it, such stream is stopped when idle
+const abortedStartTTL = 2 * time.Minute
+
+// Config holds parameters for live stream sessions
+type Config struct {
+	StartTimeout time.Duration
+	IdleTimeout  time.Duration
+	SessionTTL   time.Duration
+}
+
+// Session structure to represent viewer of camera live stream.
+// Playback URL is made by caller from mediaserver params.
+type Session struct {
+	ID                string     `json:"sessionId"`
+	DeviceID          string     `json:"deviceId"`
+	GatewayID         string     `json:"gatewayId"`
+	UserID            uint64     `json:"userId"`
+	PlaybackURL       string     `json:"playbackUrl"`
+	PlaybackExpiresAt *time.Time `json:"playbackExpiresAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	LastSeenAt        time.Time  `json:"lastSeenAt"`
+	ExpiresIn         int64      `json:"expiresIn"`
+	MediaserverIP     string     `json:"-"`
+	ApplicationName   string     `json:"-"`
+}
+
+// Stream structure to represent camera cloud streaming state with its viewers
+type Stream struct {
+	DeviceID        string    `json:"deviceId"`
+	GatewayID       string    `json:"gatewayId"`
+	State           string    `json:"state"`
+	MediaserverIP   string    `json:"mediaserverIp,omitempty"`
+	ApplicationName string    `json:"applicationName,omitempty"`
+	OnDemand        bool      `json:"onDemand"`
+	Viewers         int       `json:"viewers"`
+	Since           time.Time `json:"since"`
+}
+
+type stream struct {
+	Stream
+	sessions map[string]*Session
+	ready    chan struct{}
+	idle     *time.Timer
+}
+
+// Manager starts camera cloud streaming on viewer request, counts viewers
+// and stops streaming started on demand when nobody watches it
+type Manager struct {
+	cfg     Config
+	mgr     *broker.Manager
+	mx      sync.Mutex
+	streams map[string]*stream
+	aborted map[string]time.Time // expiration of aborted on-demand starts by device id
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewManager constructs Manager structure
+func NewManager(mgr *broker.Manager, cfg Config) *Manager {
+	// Set defaults for missing params
+	if cfg.StartTimeout <= 0 {
+		cfg.StartTimeout = 15 * time.Second
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = time.Minute
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = 90 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		cfg:     cfg,
+		mgr:     mgr,
+		streams: make(map[string]*stream),
+		aborted: make(map[string]time.Time),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start makes goroutine expiring sessions of viewers stopped sending heartbeats
+func (m *Manager) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.cfg.SessionTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				m.expireSessions()
+			}
+		}
+	}()
+	logger.Info("Live stream sessions manager started", "idleTimeout", m.cfg.IdleTimeout)
+}
+
+// Close stops manager and its idle timers
+func (m *Manager) Close() error {
+	m.cancel()
+	m.wg.Wait()
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for _, st := range m.streams {
+		if st.idle != nil {
+			st.idle.Stop()
+		}
+	}
+	return nil
+}
+
+// Track follows camera cloud streaming state reported by gateways
+func (m *Manager) Track(message *entities.IotMessage) {
+	if message == nil || message.DeviceType != "camera" || len(message.DeviceId) == 0 {
+		return
+	}
+	if message.MessageType != "deviceState" && message.MessageType != "cloudStreaming" {
+		return
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	st := m.streams[message.DeviceId]
+	switch message.DeviceState {
+	case "streamingOn":
+		if st == nil {
+			// Camera streams by itself, e.g. for recording, or started
+			// streaming late for viewer gave up waiting for it
+			onDemand := m.isAborted(message.DeviceId)
+			st = m.newStream(message.GatewayId, message.DeviceId, onDemand)
+			m.setLive(st, message.MediaserverIp, message.ApplicationName)
+			if onDemand {
+				m.scheduleStop(st)
+			}
+			return
+		}
+		m.setLive(st, message.MediaserverIp, message.ApplicationName)
+	case "streamingOff":
+		if st == nil {
+			return
+		}
+		logger.Info("Camera stopped streaming", "device", st.DeviceID, "viewers", len(st.sessions))
+		if len(st.sessions) == 0 {
+			m.removeStream(st)
+			return
+		}
+		st.State = StateStopped
+		st.Since = time.Now()
+	}
+}
+
+// Join adds viewer session for camera live stream. Cloud streaming is started
+// if camera does not stream yet and call blocks until camera reports it.
+func (m *Manager) Join(gatewayID, deviceID string, userID uint64) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		ID:         uuid.New().String(),
+		DeviceID:   deviceID,
+		GatewayID:  gatewayID,
+		UserID:     userID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	m.mx.Lock()
+	st := m.streams[deviceID]
+	if st == nil {
+		st = m.newStream(gatewayID, deviceID, true)
+	}
+	st.sessions[session.ID] = session
+	st.Viewers = len(st.sessions)
+	if st.idle != nil {
+		st.idle.Stop()
+		st.idle = nil
+	}
+	start := st.State == StateStopped
+	if start {
+		st.State = StateStarting
+		st.OnDemand = true
+		st.Since = now
+		st.ready = make(chan struct{})
+	}
+	if st.State == StateLive {
+		defer m.mx.Unlock()
+		return m.sessionView(st, session), nil
+	}
+	ready := st.ready
+	m.mx.Unlock()
+
+	if start {
+		if err := m.sendStreaming(gatewayID, deviceID, true); err != nil {
+			// Camera may start streaming if gateway got command but response was lost
+			m.abortStart(st, ready, err != ErrStreamingRejected)
+			m.leave(deviceID, session.ID)
+			return nil, err
+		}
+	}
+
+	timer := time.NewTimer(m.cfg.StartTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+	case <-timer.C:
+		m.abortStart(st, ready, true)
+		m.leave(deviceID, session.ID)
+		return nil, ErrStreamNotStarted
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if st.State != StateLive {
+		delete(st.sessions, session.ID)
+		st.Viewers = len(st.sessions)
+		if len(st.sessions) == 0 {
+			m.scheduleStop(st)
+		}
+		return nil, ErrStreamNotStarted
+	}
+	return m.sessionView(st, session), nil
+}
+
+// Heartbeat prolongs viewer session
+func (m *Manager) Heartbeat(deviceID, sessionID string) (*Session, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	st := m.streams[deviceID]
+	if st == nil {
+		return nil, ErrSessionNotFound
+	}
+	session, ok := st.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if st.State == StateStopped {
+		// Viewer should join again to restart streaming
+		delete(st.sessions, sessionID)
+		st.Viewers = len(st.sessions)
+		if len(st.sessions) == 0 {
+			m.scheduleStop(st)
+		}
+		return nil, ErrStreamStopped
+	}
+	session.LastSeenAt = time.Now()
+	return m.sessionView(st, session), nil
+}
+
+// Leave removes viewer session. Stream is stopped after idle timeout
+// when the last viewer leaves.
+func (m *Manager) Leave(deviceID, sessionID string) error {
+	if !m.leave(deviceID, sessionID) {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// GetStream returns camera stream state. Returns nil if camera is not streaming
+// and nobody watches it.
+func (m *Manager) GetStream(deviceID string) *Stream {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	st := m.streams[deviceID]
+	if st == nil {
+		return nil
+	}
+	view := st.Stream
+	return &view
+}
+
+// ListStreams returns state of all known camera streams ordered by device id
+func (m *Manager) ListStreams() []Stream {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	list := make([]Stream, 0, len(m.streams))
+	for _, st := range m.streams {
+		list = append(list, st.Stream)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeviceID < list[j].DeviceID })
+	return list
+}
+
+// newStream adds stream state, must be called under lock
+func (m *Manager) newStream(gatewayID, deviceID string, onDemand bool) *stream {
+	st := &stream{
+		Stream: Stream{
+			DeviceID:  deviceID,
+			GatewayID: gatewayID,
+			State:     StateStopped,
+			OnDemand:  onDemand,
+			Since:     time.Now(),
+		},
+		sessions: make(map[string]*Session),
+	}
+	m.streams[deviceID] = st
+	delete(m.aborted, deviceID)
+	return st
+}
+
+// removeStream forgets stream state, must be called under lock
+func (m *Manager) removeStream(st *stream) {
+	if st.idle != nil {
+		st.idle.Stop()
+		st.idle = nil
+	}
+	if m.streams[st.DeviceID] == st {
+		delete(m.streams, st.DeviceID)
+	}
+}
+
+// setLive stores mediaserver params and wakes up viewers waiting for stream,
+// must be called under lock
+func (m *Manager) setLive(st *stream, mediaserverIP, applicationName string) {
+	if len(mediaserverIP) > 0 {
+		st.MediaserverIP = mediaserverIP
+	}
+	if len(applicationName) > 0 {
+		st.ApplicationName = applicationName
+	}
+	if st.State != StateLive {
+		st.State = StateLive
+		st.Since = time.Now()
+		logger.Info("Camera started streaming", "device", st.DeviceID, "onDemand", st.OnDemand)
+	}
+	if st.ready != nil {
+		close(st.ready)
+		st.ready = nil
+	}
+}
+
+// abortStart resets stream which has not started in time so next viewer could retry.
+// Late start is remembered for a while, so stream is stopped when camera reports it.
+func (m *Manager) abortStart(st *stream, ready chan struct{}, late bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if st.State == StateStarting && st.ready == ready {
+		st.State = StateStopped
+		st.Since = time.Now()
+		close(st.ready)
+		st.ready = nil
+		if late {
+			m.aborted[st.DeviceID] = st.Since.Add(abortedStartTTL)
+		}
+	}
+}
+
+// isAborted checks that on-demand start of camera was aborted recently,
+// must be called under lock
+func (m *Manager) isAborted(deviceID string) bool {
+	expires, ok := m.aborted[deviceID]
+	return ok && time.Now().Before(expires)
+}
+
+// leave removes viewer session and schedules idle stream stop
+func (m *Manager) leave(deviceID, sessionID string) bool {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	st := m.streams[deviceID]
+	if st == nil {
+		return false
+	}
+	if _, ok := st.sessions[sessionID]; !ok {
+		return false
+	}
+	delete(st.sessions, sessionID)
+	st.Viewers = len(st.sessions)
+	if len(st.sessions) == 0 {
+		m.scheduleStop(st)
+	}
+	return true
+}
+
+// scheduleStop starts idle timer for stream nobody watches, must be called under lock
+func (m *Manager) scheduleStop(st *stream) {
+	if st.State == StateStopped {
+		m.removeStream(st)
+		return
+	}
+	if st.idle != nil {
+		st.idle.Stop()
+	}
+	st.idle = time.AfterFunc(m.cfg.IdleTimeout, func() { m.stopIdle(st) })
+}
+
+// stopIdle stops streaming started on demand if nobody watches it and
+// camera is not recorded, otherwise only viewer accounting is cleared
+func (m *Manager) stopIdle(st *stream) {
+	m.mx.Lock()
+	if m.streams[st.DeviceID] != st || len(st.sessions) > 0 || m.ctx.Err() != nil {
+		m.mx.Unlock()
+		return
+	}
+	st.idle = nil
+	stop := st.OnDemand && st.State != StateStopped
+	if !stop {
+		m.mx.Unlock()
+		return
+	}
+	m.mx.Unlock()
+
+	if m.isRecorded(st.GatewayID, st.DeviceID) {
+		m.mx.Lock()
+		st.OnDemand = false
+		m.mx.Unlock()
+		return
+	}
+	if err := m.sendStreaming(st.GatewayID, st.DeviceID, false); err != nil {
+		// Streaming state is unknown, so it is forgotten until camera reports it again
+		logger.Error("error stopping camera streaming", "error", err,
+			"device", st.DeviceID, "caller", "Manager")
+	} else {
+		logger.Info("Idle camera streaming stopped", "device", st.DeviceID, "gateway", st.GatewayID)
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if len(st.sessions) == 0 {
+		m.removeStream(st)
+	}
+}
+
+// expireSessions removes sessions of viewers stopped sending heartbeats
+// and forgets expired aborted starts
+func (m *Manager) expireSessions() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	now := time.Now()
+	for deviceID, expires := range m.aborted {
+		if now.After(expires) {
+			delete(m.aborted, deviceID)
+		}
+	}
+
+	deadline := now.Add(-m.cfg.SessionTTL)
+	for _, st := range m.streams {
+		expired := 0
+		for id, session := range st.sessions {
+			if session.LastSeenAt.Before(deadline) {
+				delete(st.sessions, id)
+				expired++
+			}
+		}
+		if expired == 0 {
+			continue
+		}
+		st.Viewers = len(st.sessions)
+		logger.Debug("Viewer sessions expired", "device", st.DeviceID, "expired", expired)
+		if len(st.sessions) == 0 {
+			m.scheduleStop(st)
+		}
+	}
+}
+
+// isRecorded checks that camera stream is recorded by cloud, so it should not be stopped
+func (m *Manager) isRecorded(gatewayID, deviceID string) bool {
+	details := m.mgr.GetGatewayDetails(gatewayID)
+	if details == nil {
+		return false
+	}
+	for _, camera := range details.Cameras {
+		if camera.DeviceID == deviceID {
+			return camera.Recorded
+		}
+	}
+	return false
+}
+
+// sendStreaming requests gateway to turn camera cloud streaming on or off
+func (m *Manager) sendStreaming(gatewayID, deviceID string, on bool) error {
+	request := entities.CreateCloudIotMessage(gatewayID, deviceID)
+	request.DeviceType = "camera"
+	request.Protocol = "onvif"
+	request.MessageType = "command"
+	request.Command = "cloudStreaming"
+	request.Attribute = "off"
+	if on {
+		request.Attribute = "on"
+	}
+
+	response, err := m.mgr.DoGatewayRPC(gatewayID, request)
+	if err != nil {
+		return err
+	}
+	if response == nil || response.Status == "failed" {
+		return ErrStreamingRejected
+	}
+
+	// Gateway may respond with mediaserver params at once
+	if on && response.DeviceState == "streamingOn" {
+		m.mx.Lock()
+		if st := m.streams[deviceID]; st != nil {
+			m.setLive(st, response.MediaserverIp, response.ApplicationName)
+		}
+		m.mx.Unlock()
+	}
+	return nil
+}
+
+// sessionView returns session copy with mediaserver params, must be called under lock
+func (m *Manager) sessionView(st *stream, session *Session) *Session {
+	view := *session
+	view.MediaserverIP = st.MediaserverIP
+	view.ApplicationName = st.ApplicationName
+	view.ExpiresIn = int64(m.cfg.SessionTTL / time.Second)
+	return &view
+}
@@ -0,0 +1,55 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+)
+
+// AuditGatewayTrafficTask writes rejected or suspicious gateway message to audit log
+type AuditGatewayTrafficTask struct {
+	conn      *database.Connection
+	gatewayID string
+	transport string
+	reason    string
+}
+
+// NewAuditGatewayTrafficTask constructs task for gateway channel, transport and rejection reason
+func NewAuditGatewayTrafficTask(conn *database.Connection, gatewayID, transport, reason string) interfaces.Task {
+	if conn == nil {
+		logger.Error("database connection is nil", "caller", "AuditGatewayTrafficTask")
+	}
+	return &AuditGatewayTrafficTask{
+		conn:      conn,
+		gatewayID: gatewayID,
+		transport: transport,
+		reason:    reason,
+	}
+}
+
+func (t *AuditGatewayTrafficTask) Run(message *entities.IotMessage) {
+	logger.Warn("Gateway message rejected",
+		"gateway", t.gatewayID, "claimed", message.GatewayId,
+		"transport", t.transport, "reason", t.reason,
+		"caller", "AuditGatewayTrafficTask")
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	insertQueryText :=
+		`INSERT INTO v3_gateway_audit
+			(gateway_id, claimed_gateway_id, transport, reason, message_type, device_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, now());`
+	_, err := t.conn.Db.ExecContext(ctx, insertQueryText,
+		t.gatewayID, message.GatewayId, t.transport, t.reason, message.MessageType, message.DeviceId)
+	if err != nil {
+		logger.Error("error writing gateway audit record",
+			"error", err, "gateway", t.gatewayID, "caller", "AuditGatewayTrafficTask")
+	}
+}
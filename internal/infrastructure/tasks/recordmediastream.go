@@ -11,23 +11,35 @@ import (
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
 	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tlsutil"
 	"github.com/spf13/viper"
 )
 
 // RecordMediaStreamTask structure
 type RecordMediaStreamTask struct {
+	scheme   string
 	username string
 	password string
 	port     int
+	meter    interfaces.UsageMeter
+	userID   uint64
 }
 
 // NewRecordMediaStreamTask constructs RecordMediaStreamTask
-// and returns task interface
-func NewRecordMediaStreamTask() interfaces.Task {
+// and returns task interface. Recording time is metered for user
+// if meter is defined.
+func NewRecordMediaStreamTask(meter interfaces.UsageMeter, userID uint64) interfaces.Task {
+	scheme := viper.GetString("wowza.scheme")
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
 	return &RecordMediaStreamTask{
+		scheme:   scheme,
 		username: viper.GetString("wowza.user"),
 		password: viper.GetString("wowza.password"),
 		port:     viper.GetInt("wowza.port"),
+		meter:    meter,
+		userID:   userID,
 	}
 }
 
@@ -42,10 +54,16 @@ func (t *RecordMediaStreamTask) Run(message *entities.IotMessage) {
 
 	recOn := message.Recording == "on"
 
+	// Stopped recording is not metered any more whatever Wowza responds
+	// or if it is not reachable at all
+	if !recOn && t.meter != nil {
+		t.meter.End(entities.UsageRecording, t.userID, message.DeviceId)
+	}
+
 	// Make Wowza RESTful API recording URI
 	uri := fmt.Sprintf(
-		"http://%s:%d/v2/servers/_defaultServer_/vhosts/_defaultVHost_/applications/%s/instances/_definst_/streamrecorders/%s",
-		message.MediaserverIp, t.port, message.ApplicationName, message.DeviceId)
+		"%s://%s:%d/v2/servers/_defaultServer_/vhosts/_defaultVHost_/applications/%s/instances/_definst_/streamrecorders/%s",
+		t.scheme, message.MediaserverIp, t.port, message.ApplicationName, message.DeviceId)
 	if !recOn {
 		uri += "/actions/stopRecording"
 	}
@@ -106,8 +124,11 @@ func (t *RecordMediaStreamTask) Run(message *entities.IotMessage) {
 	request.Header.Set("Accept", "application/json; charset=utf-8")
 
 	// Create HTTP client
-	client := http.Client{
-		Timeout: 5 * time.Second,
+	client, err := tlsutil.HTTPClient("wowza.tls", 5*time.Second)
+	if err != nil {
+		logger.Error("failed creating http client",
+			"error", err, "caller", "RecordMediaStreamTask")
+		return
 	}
 
 	// Send request
@@ -131,4 +152,10 @@ func (t *RecordMediaStreamTask) Run(message *entities.IotMessage) {
 		return
 	}
 	logger.Debug("Wowza response", "response", string(respBody), "caller", "RecordMediaStreamTask")
+
+	// Meter recording time started by Wowza
+	if recOn && t.meter != nil &&
+		resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		t.meter.Begin(entities.UsageRecording, t.userID, message.DeviceId)
+	}
 }
@@ -10,10 +10,10 @@ import (
 )
 
 type SendGatewayMessageTask struct {
-	gatewayChannel io.ReadWriteCloser
+	gatewayChannel io.Writer
 }
 
-func NewSendGatewayMessageTask(gatewayChannel io.ReadWriteCloser) interfaces.Task {
+func NewSendGatewayMessageTask(gatewayChannel io.Writer) interfaces.Task {
 	return &SendGatewayMessageTask{gatewayChannel: gatewayChannel}
 }
 
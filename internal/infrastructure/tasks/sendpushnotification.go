@@ -14,6 +14,7 @@ import (
 	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/tlsutil"
 )
 
 // SendPushNotificationTask structure
@@ -63,12 +64,19 @@ func NewSendPushNotificationTask(conn *database.Connection) interfaces.Task {
 }
 
 func (t *SendPushNotificationTask) Run(message *entities.IotMessage) {
-	// Check input data
-	if message.DeviceTableId == 0 {
-		logger.Error("no sender defined", "caller", "SendPushNotificationTask")
-		return
-	}
-	if message.DeviceType != "camera" && message.DeviceType != "sensor" {
+	// Check input data, account notifications have no sender device
+	switch message.DeviceType {
+	case "camera", "sensor":
+		if message.DeviceTableId == 0 {
+			logger.Error("no sender defined", "caller", "SendPushNotificationTask")
+			return
+		}
+	case "account":
+		if message.UserId == 0 {
+			logger.Error("no user defined", "caller", "SendPushNotificationTask")
+			return
+		}
+	default:
 		logger.Error("wrong device type", "deviceType", message.DeviceType,
 			"caller", "SendPushNotificationTask")
 		return
@@ -145,8 +153,11 @@ func (t *SendPushNotificationTask) Run(message *entities.IotMessage) {
 	request.Header.Set("Authorization", "Basic "+t.restApiKey)
 
 	// Create HTTP client
-	client := http.Client{
-		Timeout: 5 * time.Second,
+	client, err := tlsutil.HTTPClient("push.tls", 5*time.Second)
+	if err != nil {
+		logger.Error("failed creating http client",
+			"error", err, "caller", "SendPushNotificationTask")
+		return
 	}
 
 	// Send request
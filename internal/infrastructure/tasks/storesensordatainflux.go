@@ -1,40 +1,29 @@
 package tasks
 
 import (
-	"fmt"
-	"strconv"
-	"strings"
-	"time"
-
 	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
 	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
 	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
-	"github.com/spf13/viper"
-
-	_ "github.com/influxdata/influxdb1-client" // this is important because of the bug in go mod
-	client "github.com/influxdata/influxdb1-client/v2"
 )
 
 // StoreSensorDataInfluxTask structure
 type StoreSensorDataInfluxTask struct {
-	connURL  string
-	username string
-	password string
+	sink   interfaces.SensorSink
+	meter  interfaces.UsageMeter
+	userID uint64
 }
 
 // NewStoreSensorDataInfluxTask constructs StoreSensorDataInfluxTask
-// and returns task interface
-func NewStoreSensorDataInfluxTask() interfaces.Task {
-	return &StoreSensorDataInfluxTask{
-		connURL: fmt.Sprintf("http://%s:%d",
-			viper.GetString("db.sensor.host"),
-			viper.GetInt("db.sensor.port")),
-		username: viper.GetString("db.sensor.username"),
-		password: viper.GetString("db.sensor.password"),
+// and returns task interface. Points are metered for user after they
+// are persisted by sink if meter is defined.
+func NewStoreSensorDataInfluxTask(sink interfaces.SensorSink, meter interfaces.UsageMeter, userID uint64) interfaces.Task {
+	if sink == nil {
+		logger.Error("sensor sink is nil", "caller", "NewStoreSensorDataInfluxTask")
 	}
+	return &StoreSensorDataInfluxTask{sink: sink, meter: meter, userID: userID}
 }
 
-// Run extracts data from incoming message and send it via HTTP to InfluxDB database
+// Run extracts data from incoming message and passes it to time-series sensor sink
 func (t *StoreSensorDataInfluxTask) Run(message *entities.IotMessage) {
 	if len(message.GatewayId) == 0 || len(message.DeviceId) == 0 {
 		logger.Error("no sender defined", "caller", "StoreSensorDataInfluxTask")
@@ -45,63 +34,21 @@ func (t *StoreSensorDataInfluxTask) Run(message *entities.IotMessage) {
 			"caller", "StoreSensorDataInfluxTask")
 		return
 	}
-
-	// Create InfluxDB client
-	c, err := client.NewHTTPClient(client.HTTPConfig{
-		Addr:     t.connURL,
-		Username: t.username,
-		Password: t.password,
-	})
-	if err != nil {
-		logger.Error("error creating InfluxDB client", "error", err,
-			"caller", "StoreSensorDataInfluxTask")
+	if t.sink == nil {
+		logger.Error("no sensor sink to store a point", "caller", "StoreSensorDataInfluxTask")
 		return
 	}
-	defer c.Close()
 
-	// Create a new point batch
-	dbName :=
-		"gateway_" + strings.ReplaceAll(message.GatewayId, "-", "_") + "_" +
-			message.DeviceType + "s"
-	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-		Database:  dbName,
-		Precision: "ms",
-	})
-	if err != nil {
-		logger.Error("error creating batch point", "error", err,
-			"caller", "StoreSensorDataInfluxTask")
-		return
+	// Sink writes points in batches, so point is counted when its batch is persisted
+	var written func()
+	if t.meter != nil {
+		meter, userID, deviceID := t.meter, t.userID, message.DeviceId
+		written = func() {
+			meter.Count(entities.UsageSensorPoints, userID, deviceID, 1)
+		}
 	}
-
-	// Create a point and add it to a batch
-	name := "device_" + strings.ReplaceAll(message.DeviceId, "-", "_")
-	tags := map[string]string{
-		"class": message.GetSensorType(),
-		"label": message.GetLabel()}
-	if len(message.Units) != 0 {
-		tags["units"] = message.Units
-	}
-	fields := map[string]interface{}{}
-	if floatValue, err := strconv.ParseFloat(message.SensorData, 64); err != nil {
-		fields["value"] = message.SensorData
-	} else {
-		fields["value_float"] = floatValue
-	}
-	//logger.Debug("Point fields", "fields", fields, "caller", "StoreSensorDataInfluxTask")
-	pt, err := client.NewPoint(name, tags, fields, time.Now())
-	if err != nil {
-		logger.Error("error creating new point", "error", err,
-			"caller", "StoreSensorDataInfluxTask")
-		return
-	}
-	logger.Debug("New point value", "value", pt,
-		"caller", "StoreSensorDataInfluxTask")
-	bp.AddPoint(pt)
-
-	// Write the batch
-	err = c.Write(bp)
-	if err != nil {
-		logger.Error("error writing point to InfluxDB", "error", err,
+	if err := t.sink.Store(message, written); err != nil {
+		logger.Error("error storing sensor data", "error", err,
 			"caller", "StoreSensorDataInfluxTask")
 	}
 }
@@ -0,0 +1,85 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/domain/interfaces"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/archive"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/spf13/viper"
+)
+
+type UpdateArchiveUploadTask struct {
+	conn   *database.Connection
+	events interfaces.EventPublisher
+	userID uint64
+}
+
+// NewUpdateArchiveUploadTask constructs task following archive upload progress.
+// Progress of known upload is published as event of gateway owner.
+func NewUpdateArchiveUploadTask(conn *database.Connection, events interfaces.EventPublisher, userID uint64) interfaces.Task {
+	if conn == nil {
+		logger.Error("database connection is nil", "caller", "UpdateArchiveUploadTask")
+	}
+	return &UpdateArchiveUploadTask{conn: conn, events: events, userID: userID}
+}
+
+func (t *UpdateArchiveUploadTask) Run(message *entities.IotMessage) {
+	if len(message.GatewayId) == 0 || len(message.DeviceId) == 0 || len(message.UploadId) == 0 {
+		logger.Error("no sender or upload defined", "caller", "UpdateArchiveUploadTask")
+		return
+	}
+	switch message.Status {
+	case archive.UploadUploading, archive.UploadCompleted, archive.UploadFailed:
+	default:
+		logger.Error("wrong archive upload status", "status", message.Status,
+			"upload", message.UploadId, "caller", "UpdateArchiveUploadTask")
+		return
+	}
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	upload, err := archive.GetUpload(ctx, t.conn, message.UploadId)
+	if err != nil {
+		logger.Error("error getting archive upload", "error", err, "caller", "UpdateArchiveUploadTask")
+		return
+	}
+	if upload == nil || upload.GatewayID != message.GatewayId || upload.DeviceID != message.DeviceId {
+		logger.Warn("Unknown archive upload reported", "upload", message.UploadId,
+			"gateway", message.GatewayId, "device", message.DeviceId)
+		return
+	}
+	if archive.IsFinished(upload.Status) {
+		return
+	}
+
+	// Index segments uploaded so far
+	if _, err := archive.AddSegments(ctx, t.conn, upload, viper.GetString("archive.uploadUrl"),
+		message.Segments); err != nil {
+		logger.Error("error indexing archive segments", "error", err,
+			"upload", upload.ID, "caller", "UpdateArchiveUploadTask")
+	}
+
+	progress, reason := message.Progress, ""
+	switch message.Status {
+	case archive.UploadCompleted:
+		progress = 100
+	case archive.UploadFailed:
+		reason = message.Content
+	}
+	if progress < 0 || progress > 100 {
+		progress = upload.Progress
+	}
+	if err := archive.UpdateUpload(ctx, t.conn, upload.ID, message.Status, progress, reason); err != nil {
+		logger.Error("error updating archive upload", "error", err,
+			"upload", upload.ID, "caller", "UpdateArchiveUploadTask")
+	}
+
+	if t.events != nil && t.userID != 0 {
+		t.events.Publish(entities.NewEvent(entities.EventArchiveUpload, t.userID, message))
+	}
+}
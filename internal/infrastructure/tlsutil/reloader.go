@@ -0,0 +1,95 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+)
+
+const reloadCheckInterval = 10 * time.Second
+
+// CertReloader serves server certificate and reloads it
+// when certificate or key file is changed on disk
+type CertReloader struct {
+	certFile  string
+	keyFile   string
+	mx        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads certificate and constructs CertReloader structure
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		mx:       sync.Mutex{},
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns current certificate, it is used as tls.Config callback
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	// Check files not often than once per interval
+	if time.Since(r.checkedAt) > reloadCheckInterval {
+		r.checkedAt = time.Now()
+		if modTime := r.lastModified(); modTime.After(r.modTime) {
+			if err := r.loadLocked(); err != nil {
+				// Keep serving previous certificate
+				logger.Error("failed reloading TLS certificate", "error", err,
+					"cert", r.certFile, "caller", "CertReloader")
+			} else {
+				logger.Info("TLS certificate reloaded", "cert", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// ServerConfig makes TLS configuration for server with certificate reloading
+func (r *CertReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+func (r *CertReloader) load() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.loadLocked()
+}
+
+func (r *CertReloader) loadLocked() error {
+	modTime := r.lastModified()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed loading server certificate")
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// lastModified returns latest modification time of certificate and key files
+func (r *CertReloader) lastModified() time.Time {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,105 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Config holds TLS parameters of one connection type
+type Config struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// FromViper reads TLS parameters from configuration section, e.g. "amqp.tls"
+func FromViper(section string) Config {
+	return Config{
+		Enabled:            viper.GetBool(section + ".enabled"),
+		CAFile:             viper.GetString(section + ".caFile"),
+		CertFile:           viper.GetString(section + ".certFile"),
+		KeyFile:            viper.GetString(section + ".keyFile"),
+		ServerName:         viper.GetString(section + ".serverName"),
+		InsecureSkipVerify: viper.GetBool(section + ".insecureSkipVerify"),
+	}
+}
+
+// ClientConfig makes TLS configuration for client connections.
+// Returns nil if TLS is disabled. Custom CA bundle is added to system pool,
+// client certificate is loaded if defined.
+func (c Config) ClientConfig() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if len(c.CAFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading CA bundle")
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA bundle %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(c.CertFile) > 0 || len(c.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed loading client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+var (
+	clientsMx sync.Mutex
+	clients   = make(map[string]*http.Client)
+)
+
+// HTTPClient returns HTTP client for configuration section with TLS parameters.
+// Clients are cached per section to reuse connections between requests.
+func HTTPClient(section string, timeout time.Duration) (*http.Client, error) {
+	key := section + "/" + timeout.String()
+
+	clientsMx.Lock()
+	defer clientsMx.Unlock()
+	if client, ok := clients[key]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := FromViper(section).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "wrong TLS configuration in %s", section)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+	clients[key] = client
+	return client, nil
+}
@@ -0,0 +1,354 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ahamtat/iot-cloud-server/internal/domain/entities"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/logger"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Webhook request headers
+const (
+	HeaderEvent     = "X-Veedo-Event"
+	HeaderDelivery  = "X-Veedo-Delivery"
+	HeaderTimestamp = "X-Veedo-Timestamp"
+	HeaderSignature = "X-Veedo-Signature"
+)
+
+// Config holds parameters for webhook dispatcher
+type Config struct {
+	// Workers is number of concurrent deliveries, every worker
+	// delivers event to subscribed webhooks one by one
+	Workers      int
+	QueueSize    int
+	QueueTimeout time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	RetryBackoff time.Duration
+	MaxFailures  int
+	CacheTTL     time.Duration
+	// AllowPrivate permits delivery to loopback and private network
+	// addresses, should be used for testing only
+	AllowPrivate bool
+}
+
+// job is event queued for delivery. Event is sent to one user webhook
+// if webhook id is set and to all subscribed user webhooks otherwise.
+// Attempt is number of failed deliveries made before.
+type job struct {
+	event     *entities.Event
+	webhookID uint64
+	attempt   int
+}
+
+type cachedSubscriptions struct {
+	subs    []*Subscription
+	expires time.Time
+}
+
+// Dispatcher delivers platform events to user webhooks
+type Dispatcher struct {
+	cfg    Config
+	conn   *database.Connection
+	client *http.Client
+	queue  chan job
+	mx     sync.Mutex
+	cache  map[uint64]cachedSubscriptions
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher constructs Dispatcher structure
+func NewDispatcher(conn *database.Connection, cfg Config) *Dispatcher {
+	// Set defaults for missing params
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 10
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		cfg:  cfg,
+		conn: conn,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: newTransport(cfg.AllowPrivate),
+		},
+		queue:  make(chan job, cfg.QueueSize),
+		mx:     sync.Mutex{},
+		cache:  make(map[uint64]cachedSubscriptions),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start makes worker goroutines for event delivery
+func (d *Dispatcher) Start() {
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-d.ctx.Done():
+					return
+				case j := <-d.queue:
+					d.dispatch(j)
+				}
+			}
+		}()
+	}
+	logger.Info("Webhook dispatcher started", "workers", d.cfg.Workers)
+}
+
+// Close stops workers and waits for pending deliveries
+func (d *Dispatcher) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	return nil
+}
+
+// Publish puts event to delivery queue. Event is dropped if queue stays full
+// for queue timeout.
+func (d *Dispatcher) Publish(event *entities.Event) {
+	d.enqueue(job{event: event})
+}
+
+// PublishTo puts event to delivery queue for one webhook of event user.
+// Webhook gets event whatever event types it is subscribed for.
+func (d *Dispatcher) PublishTo(webhookID uint64, event *entities.Event) {
+	if webhookID == 0 {
+		return
+	}
+	d.enqueue(job{event: event, webhookID: webhookID})
+}
+
+// enqueue puts job to delivery queue. If queue is full publisher waits
+// for free slot for queue timeout and drops job after that.
+func (d *Dispatcher) enqueue(j job) {
+	event := j.event
+	if event == nil || event.UserID == 0 {
+		return
+	}
+	select {
+	case d.queue <- j:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(d.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case d.queue <- j:
+	case <-d.ctx.Done():
+	case <-timer.C:
+		logger.Error("webhook queue is full, event dropped",
+			"event", event.Type, "user", event.UserID, "webhook", j.webhookID, "caller", "Dispatcher")
+	}
+}
+
+// retry puts job to delivery queue again after exponential backoff.
+// Retry is never dropped, it waits for free queue slot until shutdown.
+func (d *Dispatcher) retry(j job) {
+	backoff := d.cfg.RetryBackoff << uint(j.attempt-1)
+	time.AfterFunc(backoff, func() {
+		select {
+		case d.queue <- j:
+		case <-d.ctx.Done():
+		}
+	})
+}
+
+// Invalidate drops cached user subscriptions after they were changed
+func (d *Dispatcher) Invalidate(userID uint64) {
+	d.mx.Lock()
+	delete(d.cache, userID)
+	d.mx.Unlock()
+}
+
+// dispatch sends event to every enabled user webhook subscribed for it
+// or to enabled user webhook job is targeted to. Webhooks are called
+// by worker goroutine, so workers number bounds concurrent deliveries.
+func (d *Dispatcher) dispatch(j job) {
+	event := j.event
+	subs, err := d.getSubscriptions(event.UserID)
+	if err != nil {
+		logger.Error("error getting webhooks", "error", err,
+			"user", event.UserID, "caller", "Dispatcher")
+		return
+	}
+
+	var body []byte
+	for _, sub := range subs {
+		if !sub.Enabled {
+			continue
+		}
+		if j.webhookID != 0 && sub.ID != j.webhookID {
+			continue
+		}
+		if j.webhookID == 0 && !sub.Accepts(event.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(event); err != nil {
+				logger.Error("could not marshal event", "error", err, "caller", "Dispatcher")
+				return
+			}
+		}
+		d.deliver(sub, j, body)
+	}
+}
+
+// getSubscriptions returns cached user subscriptions or reads them from database
+func (d *Dispatcher) getSubscriptions(userID uint64) ([]*Subscription, error) {
+	d.mx.Lock()
+	cached, ok := d.cache[userID]
+	d.mx.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.subs, nil
+	}
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	subs, err := ListSubscriptions(ctx, d.conn, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mx.Lock()
+	d.cache[userID] = cachedSubscriptions{subs: subs, expires: time.Now().Add(d.cfg.CacheTTL)}
+	d.mx.Unlock()
+	return subs, nil
+}
+
+// deliver posts event to webhook once. Failed delivery is queued again
+// for this webhook, so worker does not wait for retry backoff.
+// Webhook result is registered after success or last attempt.
+func (d *Dispatcher) deliver(sub *Subscription, j job, body []byte) {
+	attempt := j.attempt + 1
+	delivery := d.post(sub, j.event, body)
+	delivery.Attempt = attempt
+	d.log(delivery)
+
+	success := len(delivery.Error) == 0
+	if !success && attempt < d.cfg.MaxAttempts {
+		d.retry(job{event: j.event, webhookID: sub.ID, attempt: attempt})
+		return
+	}
+
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	disabled, err := registerResult(ctx, d.conn, sub.ID, success, d.cfg.MaxFailures)
+	if err != nil {
+		logger.Error("error registering webhook result", "error", err,
+			"webhook", sub.ID, "caller", "Dispatcher")
+		return
+	}
+	if disabled {
+		logger.Warn("Webhook disabled after repeated failures",
+			"webhook", sub.ID, "user", sub.UserID, "url", sub.URL, "caller", "Dispatcher")
+		d.Invalidate(sub.UserID)
+	}
+}
+
+// post sends one delivery request
+func (d *Dispatcher) post(sub *Subscription, event *entities.Event, body []byte) *Delivery {
+	delivery := &Delivery{
+		WebhookID: sub.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+	}
+	start := time.Now()
+	defer func() {
+		delivery.DurationMs = int64(time.Since(start) / time.Millisecond)
+	}()
+
+	// Create request
+	request, err := http.NewRequest("POST", sub.URL, bytes.NewBuffer(body))
+	if err != nil {
+		delivery.Error = errors.Wrap(err, "failed to create http request").Error()
+		return delivery
+	}
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	request.Header.Set(HeaderEvent, event.Type)
+	request.Header.Set(HeaderDelivery, event.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	request.Header.Set(HeaderSignature, "sha256="+Sign(sub.Secret, timestamp, body))
+
+	// Send request
+	resp, err := d.client.Do(request)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode/100 != 2 {
+		delivery.Error = "unexpected status code " + strconv.Itoa(resp.StatusCode)
+	}
+	return delivery
+}
+
+// log stores delivery attempt in database
+func (d *Dispatcher) log(delivery *Delivery) {
+	// Wrap context with timeout value for database interactions
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("db.cloud.timeout"))
+	defer cancel()
+
+	if err := logDelivery(ctx, d.conn, delivery); err != nil {
+		logger.Error("error logging webhook delivery", "error", err,
+			"webhook", delivery.WebhookID, "caller", "Dispatcher")
+	}
+}
+
+// Sign returns hex encoded HMAC-SHA256 of timestamp and body.
+// Receivers should compute the same value to verify request origin.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,28 @@
+package webhooks
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"camera.motion"}`)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		want      bool
+	}{
+		{"same secret, timestamp and body", "whsecret", "1500000000", body, true},
+		{"other secret", "othersecret", "1500000000", body, false},
+		{"other timestamp", "whsecret", "1500000001", body, false},
+		{"other body", "whsecret", "1500000000", []byte(`{"type":"sensor.data"}`), false},
+	}
+	// hex(HMAC-SHA256("whsecret", "1500000000." + body))
+	const want = "1c73b7c1dbd7d4e665f955f49d68b46b78f827272d24eee76e2a8fe0dd338e65"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, tt.body) == want; got != tt.want {
+				t.Errorf("Sign() matches known signature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
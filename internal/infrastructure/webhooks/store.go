@@ -0,0 +1,197 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/ahamtat/iot-cloud-server/internal/infrastructure/database"
+	"github.com/pkg/errors"
+)
+
+// AllEvents subscribes webhook for every event type
+const AllEvents = "*"
+
+// Subscription structure to represent user webhook
+type Subscription struct {
+	ID         uint64   `json:"id"`
+	UserID     uint64   `json:"userId"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"-"`
+	EventTypes []string `json:"eventTypes"`
+	Enabled    bool     `json:"enabled"`
+	Failures   int      `json:"failures"`
+}
+
+// Delivery structure to represent one webhook delivery attempt
+type Delivery struct {
+	ID         uint64 `json:"id" db:"id"`
+	WebhookID  uint64 `json:"webhookId" db:"webhook_id"`
+	EventID    string `json:"eventId" db:"event_id"`
+	EventType  string `json:"eventType" db:"event_type"`
+	Attempt    int    `json:"attempt" db:"attempt"`
+	StatusCode int    `json:"statusCode" db:"status_code"`
+	Error      string `json:"error,omitempty" db:"error"`
+	DurationMs int64  `json:"durationMs" db:"duration_ms"`
+	CreatedAt  string `json:"createdAt" db:"created_at"`
+}
+
+// Accepts checks if webhook is subscribed for event type
+func (s *Subscription) Accepts(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == AllEvents || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// ListSubscriptions reads user webhooks
+func ListSubscriptions(ctx context.Context, conn *database.Connection, userID uint64) ([]*Subscription, error) {
+	queryText :=
+		`SELECT id, user_id, url, secret, events, enabled, failures
+		FROM v3_webhooks
+		WHERE user_id = ?
+		ORDER BY id;`
+	rows, err := conn.Db.QueryContext(ctx, queryText, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query webhooks")
+	}
+	defer func() { _ = rows.Close() }()
+
+	subs := make([]*Subscription, 0)
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// GetSubscription reads webhook by its id. Returns nil if webhook not found.
+func GetSubscription(ctx context.Context, conn *database.Connection, id uint64) (*Subscription, error) {
+	queryText :=
+		`SELECT id, user_id, url, secret, events, enabled, failures
+		FROM v3_webhooks
+		WHERE id = ?;`
+	sub, err := scanSubscription(conn.Db.QueryRowContext(ctx, queryText, id))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// CreateSubscription stores new webhook and sets its id
+func CreateSubscription(ctx context.Context, conn *database.Connection, sub *Subscription) error {
+	insertQueryText :=
+		`INSERT INTO v3_webhooks (user_id, url, secret, events, enabled, failures, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, now(), now());`
+	result, err := conn.Db.ExecContext(ctx, insertQueryText,
+		sub.UserID, sub.URL, sub.Secret, strings.Join(sub.EventTypes, ","), sub.Enabled)
+	if err != nil {
+		return errors.Wrap(err, "failed inserting webhook")
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "failed getting webhook id")
+	}
+	sub.ID = uint64(id)
+	return nil
+}
+
+// UpdateSubscription changes stored webhook. Enabling webhook resets its failures counter.
+func UpdateSubscription(ctx context.Context, conn *database.Connection, sub *Subscription) error {
+	updateQueryText :=
+		`UPDATE v3_webhooks
+			SET url = ?, secret = ?, events = ?, enabled = ?,
+				failures = IF(? = 1, 0, failures), updated_at = now()
+			WHERE id = ?;`
+	_, err := conn.Db.ExecContext(ctx, updateQueryText,
+		sub.URL, sub.Secret, strings.Join(sub.EventTypes, ","), sub.Enabled, sub.Enabled, sub.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed updating webhook")
+	}
+	return nil
+}
+
+// DeleteSubscription removes webhook and its delivery log
+func DeleteSubscription(ctx context.Context, conn *database.Connection, id uint64) error {
+	if _, err := conn.Db.ExecContext(ctx, `DELETE FROM v3_webhook_deliveries WHERE webhook_id = ?;`, id); err != nil {
+		return errors.Wrap(err, "failed deleting webhook deliveries")
+	}
+	if _, err := conn.Db.ExecContext(ctx, `DELETE FROM v3_webhooks WHERE id = ?;`, id); err != nil {
+		return errors.Wrap(err, "failed deleting webhook")
+	}
+	return nil
+}
+
+// ListDeliveries reads last webhook deliveries
+func ListDeliveries(ctx context.Context, conn *database.Connection, webhookID uint64, limit int) ([]*Delivery, error) {
+	queryText :=
+		`SELECT id, webhook_id, event_id, event_type, attempt, status_code, error, duration_ms,
+			DATE_FORMAT(created_at, '%Y-%m-%dT%H:%i:%s') AS created_at
+		FROM v3_webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?;`
+	deliveries := make([]*Delivery, 0)
+	if err := conn.Db.SelectContext(ctx, &deliveries, queryText, webhookID, limit); err != nil {
+		return nil, errors.Wrap(err, "failed to query webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// logDelivery stores delivery attempt
+func logDelivery(ctx context.Context, conn *database.Connection, d *Delivery) error {
+	insertQueryText :=
+		`INSERT INTO v3_webhook_deliveries
+			(webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, now());`
+	_, err := conn.Db.ExecContext(ctx, insertQueryText,
+		d.WebhookID, d.EventID, d.EventType, d.Attempt, d.StatusCode, d.Error, d.DurationMs)
+	if err != nil {
+		return errors.Wrap(err, "failed inserting webhook delivery")
+	}
+	return nil
+}
+
+// registerResult resets failures counter on success or increments it
+// and disables webhook when failures limit reached. Returns true if webhook was disabled.
+func registerResult(ctx context.Context, conn *database.Connection, id uint64, success bool, maxFailures int) (bool, error) {
+	if success {
+		_, err := conn.Db.ExecContext(ctx, `UPDATE v3_webhooks SET failures = 0 WHERE id = ?;`, id)
+		return false, errors.Wrap(err, "failed resetting webhook failures")
+	}
+
+	updateQueryText :=
+		`UPDATE v3_webhooks
+			SET failures = failures + 1, enabled = IF(failures >= ?, 0, enabled)
+			WHERE id = ?;`
+	if _, err := conn.Db.ExecContext(ctx, updateQueryText, maxFailures, id); err != nil {
+		return false, errors.Wrap(err, "failed updating webhook failures")
+	}
+
+	var enabled bool
+	err := conn.Db.QueryRowContext(ctx, `SELECT enabled FROM v3_webhooks WHERE id = ?;`, id).Scan(&enabled)
+	if err != nil {
+		return false, errors.Wrap(err, "failed reading webhook state")
+	}
+	return !enabled, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	sub := &Subscription{}
+	var events string
+	if err := row.Scan(&sub.ID, &sub.UserID, &sub.URL, &sub.Secret,
+		&events, &sub.Enabled, &sub.Failures); err != nil {
+		return nil, errors.Wrap(err, "could not read webhook record")
+	}
+	sub.EventTypes = strings.Split(events, ",")
+	return sub, nil
+}